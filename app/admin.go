@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"main/store"
+	"main/web"
+	"os"
+	"strings"
+	"time"
+)
+
+const apiHelp = `Токены API /api/v1 для домашних панелей и скриптов:
+/api new название - выпустить токен
+/api revoke номер - отозвать токен`
+
+// adminURL is public address of the admin panel used in login links, the panel is off without it
+var adminURL = strings.TrimSuffix(os.Getenv("ADMIN_URL"), "/")
+
+// startHTTPServer serves web admin panel and api on HTTP_ADDR (:8080 by default) until context canceled.
+// The server is off unless either HTTP_ADDR or ADMIN_URL is set.
+func startHTTPServer(ctx context.Context, bot *tgbotapi.BotAPI, am *store.ActionManager, db *store.BoltDB) {
+	addr := os.Getenv("HTTP_ADDR")
+	if addr == "" && adminURL == "" {
+		log.Printf("[INFO] http server is disabled, neither HTTP_ADDR nor ADMIN_URL is set")
+		return
+	}
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	srv, err := web.New(am, db, func(notifications []store.Notification) {
+		notify(bot, notifications)
+	})
+	if err != nil {
+		log.Printf("[ERROR] unable to make http server %+v", err)
+		return
+	}
+
+	go func() {
+		if err := srv.Run(ctx, addr); err != nil {
+			log.Printf("[ERROR] http server stopped %+v", err)
+		}
+	}()
+}
+
+// adminLinkView returns one-time login link to the admin panel for the parent
+func adminLinkView(am *store.ActionManager, parentId int64) string {
+	if adminURL == "" {
+		return "Панель управления не настроена"
+	}
+
+	token, err := am.IssueLoginToken(parentId, time.Now())
+	if err != nil {
+		log.Printf("[ERROR] unable to issue login token %+v", err)
+		return "Ошибка. Панель управления доступна только родителям"
+	}
+	return fmt.Sprintf("Панель управления семьей: %s/login?token=%s\n\nСсылка одноразовая и действует %d минут",
+		adminURL, token, int(store.LoginTokenTTL.Minutes()))
+}
+
+// apiTokens issues, lists or revokes api tokens of parent's family
+func apiTokens(am *store.ActionManager, parentId int64, args []string) string {
+	if len(args) > 0 && args[0] == "new" {
+		token, t, err := am.IssueAPIToken(parentId, strings.Join(args[1:], " "), time.Now())
+		if err != nil {
+			log.Printf("[ERROR] unable to issue api token %+v", err)
+			return "Ошибка. Токены доступны только родителям"
+		}
+		return fmt.Sprintf("Токен #%s: %s\n\nСохраните его, больше он показан не будет. "+
+			"Передавайте в заголовке Authorization: Bearer <токен>", t.ID, token)
+	}
+
+	if len(args) == 2 && args[0] == "revoke" {
+		if err := am.RevokeAPIToken(parentId, args[1]); err != nil {
+			log.Printf("[ERROR] unable to revoke api token %+v", err)
+			return "Ошибка. Невозможно отозвать токен\n\n" + apiHelp
+		}
+		return "Токен #" + args[1] + " отозван"
+	}
+
+	tokens, err := am.APITokens(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load api tokens %+v", err)
+		return "Ошибка"
+	}
+
+	var sb strings.Builder
+	for _, t := range tokens {
+		sb.WriteString(fmt.Sprintf("#%s %s, выдан %s\n", t.ID, t.Name, t.Created.Format("02.01.2006")))
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("Токенов нет\n")
+	}
+	sb.WriteString("\n" + apiHelp)
+	return sb.String()
+}
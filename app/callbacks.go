@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"main/store"
+	"strconv"
+	"strings"
+)
+
+// handleCallback processes callbacks with "<action>:<args>" data, returns false if action is unknown
+func handleCallback(bot *tgbotapi.BotAPI, am *store.ActionManager, q *tgbotapi.CallbackQuery, msg *tgbotapi.MessageConfig) bool {
+	if strings.HasPrefix(q.Data, "exp@") {
+		msg.Text = "Выбери период и формат"
+		msg.ReplyMarkup = exportKeyboard(q.Data[3:])
+		return true
+	}
+
+	parts := strings.Split(q.Data, ":")
+
+	switch parts[0] {
+	case "export":
+		// export:<period>:<format>:<@nick>
+		if len(parts) != 4 {
+			log.Printf("[WARN] malformed export request %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		name, data, err := am.ExportHistory(q.From.ID, parts[3], parts[1], parts[2])
+		if err != nil {
+			log.Printf("[ERROR] unable to export history %+v", err)
+			msg.Text = "Ошибка. Невозможно выгрузить историю"
+			return true
+		}
+
+		doc := tgbotapi.NewDocument(q.Message.Chat.ID, tgbotapi.FileBytes{Name: name, Bytes: data})
+		if _, err := bot.Send(doc); err != nil {
+			log.Printf("[ERROR] unable to send document %+v", err)
+			msg.Text = "Ошибка. Невозможно отправить файл"
+			return true
+		}
+		msg.Text = "История " + parts[3] + " выгружена"
+	case "stats":
+		// stats:<period>
+		if len(parts) != 2 {
+			log.Printf("[WARN] malformed statistics request %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		if err := sendStatistics(bot, am, q.Message.Chat.ID, q.From.ID, parts[1]); err != nil {
+			log.Printf("[ERROR] unable to send statistics %+v", err)
+			msg.Text = "Ошибка. Невозможно построить графики"
+			return true
+		}
+		msg.Text = "Графики готовы"
+	case "goalbuy", "goaldel":
+		// goalbuy:<goalId>
+		if len(parts) != 2 {
+			log.Printf("[WARN] malformed goal request %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		if parts[0] == "goaldel" {
+			if err := am.ArchiveGoal(q.From.ID, parts[1]); err != nil {
+				log.Printf("[ERROR] unable to archive goal %+v", err)
+				msg.Text = "Ошибка. Невозможно удалить цель"
+				return true
+			}
+			msg.Text = "Цель удалена"
+			return true
+		}
+
+		notifications, err := am.RequestGoalPurchase(q.From.ID, parts[1])
+		if err != nil {
+			log.Printf("[ERROR] unable to request goal purchase %+v", err)
+			msg.Text = "Ошибка. Невозможно купить цель"
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = "Запрос отправлен родителям. Жди подтверждения"
+	case "goalok", "goalno":
+		// goalok:<childId>:<goalId>
+		if len(parts) != 3 {
+			log.Printf("[WARN] malformed goal approval %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		childId, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			log.Printf("[WARN] malformed goal approval %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		notifications, err := am.ApproveGoalPurchase(q.From.ID, childId, parts[2], parts[0] == "goalok")
+		if err != nil {
+			log.Printf("[ERROR] unable to approve goal purchase %+v", err)
+			msg.Text = "Ошибка. Невозможно обработать покупку цели"
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = "Готово"
+	case "asgok", "asgno":
+		// asgok:<transactionId>
+		if len(parts) != 2 {
+			log.Printf("[WARN] malformed assignment answer %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		notifications, err := am.RespondAssignment(q.From.ID, parts[1], parts[0] == "asgok")
+		if err != nil {
+			log.Printf("[ERROR] unable to respond to assignment %+v", err)
+			msg.Text = "Ошибка. Задание уже не актуально"
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = "Задание отклонено"
+		if parts[0] == "asgok" {
+			msg.Text = "Задание принято. Когда закончишь, завершай его в «Мои задания»"
+		}
+	case "finish", "cancel":
+		// finish:<transactionId>
+		if len(parts) != 2 {
+			log.Printf("[WARN] malformed task request %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		if parts[0] == "cancel" {
+			if err := am.CancelTask(q.From.ID, parts[1]); err != nil {
+				log.Printf("[ERROR] unable to cancel task %+v", err)
+				msg.Text = "Ошибка. Невозможно отменить задание"
+				return true
+			}
+			msg.Text = "Задание отменено"
+			return true
+		}
+
+		notifications, err := am.RequestTaskCompletion(q.From.ID, parts[1])
+		if errors.Is(err, store.ErrPhotoRequired) {
+			msg.Text = photoRequiredText
+			return true
+		}
+		if err != nil {
+			log.Printf("[ERROR] unable to request task completion %+v", err)
+			msg.Text = "Ошибка. Невозможно завершить задание"
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = "Запрос отправлен родителям. Жди подтверждения. Можешь прислать фото выполненного задания"
+	case "taskok", "taskno", "photo":
+		// taskok:<childId>:<transactionId>
+		if len(parts) != 3 {
+			log.Printf("[WARN] malformed task request %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		childId, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			log.Printf("[WARN] malformed task request %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		if parts[0] == "photo" {
+			t, err := am.TransactionPhoto(q.From.ID, childId, parts[2])
+			if err != nil {
+				log.Printf("[ERROR] unable to show photo %+v", err)
+				msg.Text = "Ошибка. Фото не найдено"
+				return true
+			}
+			photo := tgbotapi.NewPhoto(q.Message.Chat.ID, tgbotapi.FileID(t.PhotoID))
+			photo.Caption = describeTransaction(t)
+			if _, err = bot.Send(photo); err != nil {
+				log.Printf("[ERROR] unable to send photo %+v", err)
+				msg.Text = "Ошибка. Невозможно отправить фото"
+				return true
+			}
+			msg.Text = "Фото к заданию " + store.OperationTitle(t.Operation)
+			return true
+		}
+
+		notifications, err := am.DecideTask(q.From.ID, childId, parts[2], parts[0] == "taskok")
+		if errors.Is(err, store.ErrAlreadyConfirmed) {
+			msg.Text = "Задание уже подтверждено, динокоины начислены"
+			return true
+		}
+		if err != nil {
+			log.Printf("[ERROR] unable to decide task %+v", err)
+			msg.Text = "Ошибка. Невозможно обработать задание"
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = "Задание отклонено"
+		if parts[0] == "taskok" {
+			msg.Text = "Задание подтверждено"
+		}
+	case "claim":
+		// claim:<boardTaskId>
+		if len(parts) != 2 {
+			log.Printf("[WARN] malformed board claim %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		t, notifications, err := am.ClaimBoardTask(q.From.ID, parts[1])
+		switch {
+		case errors.Is(err, store.ErrAlreadyClaimed):
+			msg.Text = "Это задание уже взяли"
+			return true
+		case errors.Is(err, store.ErrTooManyTasks):
+			msg.Text = tooManyTasksText
+			return true
+		case err != nil:
+			log.Printf("[ERROR] unable to claim board task %+v", err)
+			msg.Text = "Ошибка. Невозможно взять задание"
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = "Задание " + store.OperationTitle(t.Operation) + " твое. Когда выполнишь, заверши его в «Мои задания»"
+	case "shop":
+		// shop:<rewardId>
+		if len(parts) != 2 {
+			log.Printf("[WARN] malformed shop request %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		notifications, err := am.RequestPurchase(q.From.ID, parts[1])
+		if err != nil {
+			log.Printf("[ERROR] unable to request purchase %+v", err)
+			msg.Text = "Невозможно купить награду: не хватает динокоинов или лимит исчерпан"
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = "Запрос отправлен родителям. Жди подтверждения"
+	case "shopok", "shopno":
+		// shopok:<purchaseId>
+		if len(parts) != 2 {
+			log.Printf("[WARN] malformed purchase approval %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		notifications, err := am.DecidePurchase(q.From.ID, parts[1], parts[0] == "shopok")
+		if err != nil {
+			log.Printf("[ERROR] unable to decide purchase %+v", err)
+			msg.Text = "Ошибка. Невозможно обработать покупку"
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = "Готово"
+	case "wdok", "wdno":
+		// wdok:<withdrawalId>
+		if len(parts) != 2 {
+			log.Printf("[WARN] malformed withdrawal approval %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		w, notifications, err := am.DecideWithdrawal(q.From.ID, parts[1], parts[0] == "wdok")
+		if err != nil {
+			log.Printf("[ERROR] unable to decide withdrawal %+v", err)
+			msg.Text = "Ошибка. Невозможно обработать обмен"
+			return true
+		}
+		notify(bot, notifications)
+
+		msg.Text = "Обмен отклонен"
+		if w.Status == store.WithdrawalApprovedStatus {
+			msg.Text = "Обмен одобрен. Выплатите " + store.FormatRubles(w.Kopecks)
+			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Выплачено", "wdpaid:"+w.ID)))
+		}
+	case "wdpaid":
+		// wdpaid:<withdrawalId>
+		if len(parts) != 2 {
+			log.Printf("[WARN] malformed withdrawal payment %s", q.Data)
+			msg.Text = "Ошибка"
+			return true
+		}
+
+		w, err := am.MarkWithdrawalPaid(q.From.ID, parts[1])
+		if err != nil {
+			log.Printf("[ERROR] unable to mark withdrawal paid %+v", err)
+			msg.Text = "Ошибка. Невозможно отметить выплату"
+			return true
+		}
+		msg.Text = "Выплата " + store.FormatRubles(w.Kopecks) + " отмечена"
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,259 @@
+// Package charts renders simple PNG charts with the standard library only. Charts have no text,
+// labels and legends are expected in the message caption, Palette and Marks help to match colors.
+package charts
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+const (
+	width  = 800
+	height = 400
+	margin = 24
+	lines  = 5 // horizontal grid lines
+)
+
+// Palette is the series colors, Marks are emoji squares of the same colors for captions
+var (
+	Palette = []color.RGBA{
+		{R: 0x3b, G: 0x82, B: 0xf6, A: 0xff},
+		{R: 0xef, G: 0x44, B: 0x44, A: 0xff},
+		{R: 0x22, G: 0xc5, B: 0x5e, A: 0xff},
+		{R: 0xea, G: 0xb3, B: 0x08, A: 0xff},
+		{R: 0xa8, G: 0x55, B: 0xf7, A: 0xff},
+		{R: 0xf9, G: 0x73, B: 0x16, A: 0xff},
+	}
+	Marks = []string{"🟦", "🟥", "🟩", "🟨", "🟪", "🟧"}
+)
+
+var (
+	background = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	gridColor  = color.RGBA{R: 0xe5, G: 0xe7, B: 0xeb, A: 0xff}
+	axisColor  = color.RGBA{R: 0x37, G: 0x41, B: 0x51, A: 0xff}
+)
+
+// Mark returns caption mark of the i-th series
+func Mark(i int) string {
+	return Marks[i%len(Marks)]
+}
+
+func seriesColor(i int) color.RGBA {
+	return Palette[i%len(Palette)]
+}
+
+// Bars renders grouped bar chart, groups[i][j] is the value of series j in category i.
+// Returns PNG and the value of one grid step.
+func Bars(groups [][]int) ([]byte, int, error) {
+	lo, hi := 0, 0
+	for _, g := range groups {
+		for _, v := range g {
+			lo, hi = minInt(lo, v), maxInt(hi, v)
+		}
+	}
+
+	c := newCanvas(lo, hi)
+	if len(groups) > 0 {
+		slot := float64(width-2*margin) / float64(len(groups))
+		for i, g := range groups {
+			if len(g) == 0 {
+				continue
+			}
+			barWidth := slot * 0.8 / float64(len(g))
+			for j, v := range g {
+				x0 := margin + int(slot*float64(i)+slot*0.1+barWidth*float64(j))
+				c.rect(x0, c.y(0), x0+maxInt(int(barWidth)-1, 1), c.y(v), seriesColor(j))
+			}
+		}
+	}
+
+	return c.encode()
+}
+
+// Stacked renders one bar per item, stacks[i][j] is the segment j of the bar i, negative values are ignored.
+// Returns PNG and the value of one grid step.
+func Stacked(stacks [][]int) ([]byte, int, error) {
+	hi := 0
+	for _, s := range stacks {
+		total := 0
+		for _, v := range s {
+			total += maxInt(v, 0)
+		}
+		hi = maxInt(hi, total)
+	}
+
+	c := newCanvas(0, hi)
+	if len(stacks) > 0 {
+		slot := float64(width-2*margin) / float64(len(stacks))
+		for i, s := range stacks {
+			x0 := margin + int(slot*float64(i)+slot*0.2)
+			x1 := margin + int(slot*float64(i+1)-slot*0.2)
+			base := 0
+			for j, v := range s {
+				if v <= 0 {
+					continue
+				}
+				c.rect(x0, c.y(base), x1, c.y(base+v), seriesColor(j))
+				base += v
+			}
+		}
+	}
+
+	return c.encode()
+}
+
+// Lines renders line chart, series[j][i] is the i-th point of series j.
+// Returns PNG and the value of one grid step.
+func Lines(series [][]int) ([]byte, int, error) {
+	lo, hi, points := 0, 0, 0
+	for _, s := range series {
+		points = maxInt(points, len(s))
+		for _, v := range s {
+			lo, hi = minInt(lo, v), maxInt(hi, v)
+		}
+	}
+
+	c := newCanvas(lo, hi)
+	x := func(i int) int {
+		if points < 2 {
+			return width / 2
+		}
+		return margin + i*(width-2*margin)/(points-1)
+	}
+	for j, s := range series {
+		for i := range s {
+			if i > 0 {
+				c.line(x(i-1), c.y(s[i-1]), x(i), c.y(s[i]), seriesColor(j))
+			}
+			c.rect(x(i)-3, c.y(s[i])-3, x(i)+3, c.y(s[i])+3, seriesColor(j))
+		}
+	}
+
+	return c.encode()
+}
+
+// canvas maps values in [lo, hi] to the image height with grid lines every step
+type canvas struct {
+	img    *image.RGBA
+	lo, hi int
+	step   int
+}
+
+func newCanvas(lo, hi int) *canvas {
+	step := niceStep(hi - lo)
+	c := &canvas{img: image.NewRGBA(image.Rect(0, 0, width, height)), step: step,
+		lo: floorTo(lo, step), hi: ceilTo(hi, step)}
+	if c.hi == c.lo {
+		c.hi = c.lo + step
+	}
+
+	draw.Draw(c.img, c.img.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+	for v := c.lo; v <= c.hi; v += step {
+		c.rect(margin, c.y(v), width-margin, c.y(v)+1, gridColor)
+	}
+	c.rect(margin, c.y(0), width-margin, c.y(0)+2, axisColor)
+	c.rect(margin, margin, margin+2, height-margin, axisColor)
+	return c
+}
+
+// y returns pixel row of the value
+func (c *canvas) y(v int) int {
+	return height - margin - (v-c.lo)*(height-2*margin)/(c.hi-c.lo)
+}
+
+// rect fills rectangle between two corners in any order
+func (c *canvas) rect(x0, y0, x1, y1 int, col color.Color) {
+	r := image.Rect(x0, y0, x1, y1).Canon()
+	if r.Dy() == 0 {
+		r.Max.Y++
+	}
+	draw.Draw(c.img, r, &image.Uniform{C: col}, image.Point{}, draw.Over)
+}
+
+// line draws 3px wide segment with Bresenham's algorithm
+func (c *canvas) line(x0, y0, x1, y1 int, col color.Color) {
+	dx, dy := absInt(x1-x0), -absInt(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	e := dx + dy
+	for {
+		c.rect(x0-1, y0-1, x0+2, y0+2, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func (c *canvas) encode() ([]byte, int, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.img); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), c.step, nil
+}
+
+// niceStep returns 1, 2 or 5 times power of ten splitting the span into about `lines` steps
+func niceStep(span int) int {
+	step := 1
+	for {
+		for _, m := range []int{1, 2, 5} {
+			if step*m*lines >= span {
+				return step * m
+			}
+		}
+		step *= 10
+	}
+}
+
+func floorTo(v, step int) int {
+	if v >= 0 {
+		return v / step * step
+	}
+	return -ceilTo(-v, step)
+}
+
+func ceilTo(v, step int) int {
+	if v <= 0 {
+		return -floorTo(-v, step)
+	}
+	return (v + step - 1) / step * step
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
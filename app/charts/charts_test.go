@@ -0,0 +1,54 @@
+package charts
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestBars(t *testing.T) {
+	data, step, err := Bars([][]int{{10, 40}, {25, 0}, {-5, 15}})
+	require.NoError(t, err)
+	assert.Equal(t, 10, step)
+
+	img := decode(t, data)
+	assert.Equal(t, image.Rect(0, 0, width, height), img.Bounds())
+	assert.Equal(t, color.RGBAModel.Convert(Palette[1]), color.RGBAModel.Convert(img.At(200, 165)),
+		"second bar of the first group")
+	assert.Equal(t, color.RGBAModel.Convert(background), color.RGBAModel.Convert(img.At(35, 100)), "gap before the first group")
+}
+
+func TestStackedAndLines(t *testing.T) {
+	data, step, err := Stacked([][]int{{3, 2, 1}, {}, {7}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, step)
+	decode(t, data)
+
+	data, step, err = Lines([][]int{{0, 10, 35, 20}, {-12}})
+	require.NoError(t, err)
+	assert.Equal(t, 10, step)
+	decode(t, data)
+
+	_, step, err = Lines(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, step, "empty chart is still rendered")
+}
+
+func TestNiceStep(t *testing.T) {
+	for span, step := range map[int]int{0: 1, 4: 1, 6: 2, 10: 2, 11: 5, 25: 5, 26: 10, 480: 100, 501: 200} {
+		assert.Equal(t, step, niceStep(span), "span %d", span)
+	}
+	assert.Equal(t, -20, floorTo(-15, 10))
+	assert.Equal(t, 20, ceilTo(15, 10))
+	assert.Equal(t, -10, ceilTo(-15, 10))
+}
+
+func decode(t *testing.T, data []byte) image.Image {
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	return img
+}
@@ -0,0 +1,984 @@
+package main
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"main/store"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const choreHelp = `Регулярные задания:
+/chore @ник операция daily 09:00 - каждый день
+/chore @ник операция weekdays 18:00 - по будням
+/chore @ник операция weekly mon,thu 10:00 - по дням недели
+/chore @ник операция every 3 08:00 - раз в N дней
+/delchore номер - удалить
+
+Операции: walk_dog, free_dish, dirty_dish, go_to_shop, wash_floor_in_flat`
+
+const adjustmentHelp = `Бонусы и штрафы:
+/bonus @ник сумма причина - начислить бонус
+/fine @ник сумма причина - списать штраф`
+
+const goalHelp = `Новая цель: /goal название сумма [дата ДД.ММ.ГГГГ]
+Например: /goal Велосипед 500 31.12.2026`
+
+const rewardHelp = `Магазин наград:
+/reward цена название [stock=N] [limit=N] - добавить (N штук всего, N раз в неделю)
+/delreward номер - удалить
+Например: /reward 50 30 минут игр limit=3`
+
+const assignHelp = `Задание ребенку:
+/assign @ник операция [награда] [ДД.ММ.ГГГГ] [ЧЧ:ММ] [penalty=N] - награда по умолчанию из стоимости,
+срок по желанию, штраф списывается, если задание не выполнено в срок
+Например: /assign @ник wash_floor_in_flat 40 31.12.2026 18:00 penalty=10
+Своё задание одним словом с наградой: /assign @ник уборка_комнаты 25`
+
+const boardHelp = `Доска заданий для всех детей, задание достается тому, кто возьмет его первым:
+/board операция [награда] - выложить задание
+/delboard номер - убрать свободное задание
+Например: /board уборка_гаража 30`
+
+const allowanceHelp = `Карманные деньги:
+/allowance @ник сумма день время - каждую неделю, например /allowance @ник 50 sun 10:00
+/allowance @ник 0 - отключить`
+
+const digestHelp = `Еженедельный отчет по детям:
+/digest день время - например /digest sun 20:00
+/digest now - отчет за последние 7 дней
+/digest off - отключить`
+
+const photoRequiredText = "Для этого задания нужно фото. Пришли фотографию выполненного задания"
+
+const tooManyTasksText = "У тебя слишком много незавершенных заданий. Сначала заверши или отмени одно из них"
+
+// handleCommand processes slash commands, returns false if command is unknown
+func handleCommand(bot *tgbotapi.BotAPI, am *store.ActionManager, db *store.BoltDB, m *tgbotapi.Message,
+	msg *tgbotapi.MessageConfig) bool {
+	args := strings.Fields(m.CommandArguments())
+
+	switch m.Command() {
+	case "chore":
+		if len(args) < 4 {
+			msg.Text = choreHelp
+			return true
+		}
+
+		c, err := am.AddChore(m.From.ID, args[0], args[1], args[2:])
+		if err != nil {
+			log.Printf("[ERROR] unable to add chore %+v", err)
+			msg.Text = "Ошибка. Невозможно добавить задание\n\n" + choreHelp
+			return true
+		}
+		msg.Text = "Добавлено регулярное задание " + describeChore(db, c)
+	case "chores":
+		msg.Text = listChores(db, m.From.ID)
+	case "delchore":
+		if len(args) != 1 {
+			msg.Text = choreHelp
+			return true
+		}
+
+		if err := db.DeleteChore(m.From.ID, args[0]); err != nil {
+			log.Printf("[ERROR] unable to delete chore %+v", err)
+			msg.Text = "Ошибка. Невозможно удалить задание"
+			return true
+		}
+		msg.Text = "Регулярное задание удалено"
+	case "bonus", "fine":
+		if len(args) < 3 {
+			msg.Text = adjustmentHelp
+			return true
+		}
+
+		amount, err := strconv.Atoi(args[1])
+		if err != nil {
+			msg.Text = "Ошибка. Неверная сумма\n\n" + adjustmentHelp
+			return true
+		}
+
+		reason := strings.Join(args[2:], " ")
+		var notifications []store.Notification
+		if m.Command() == "bonus" {
+			notifications, err = am.GrantBonus(m.From.ID, args[0], amount, reason)
+		} else {
+			notifications, err = am.Fine(m.From.ID, args[0], amount, reason)
+		}
+		if err != nil {
+			log.Printf("[ERROR] unable to change balance %+v", err)
+			msg.Text = "Ошибка. Невозможно изменить баланс\n\n" + adjustmentHelp
+			return true
+		}
+
+		notify(bot, notifications)
+		msg.Text = "Готово. " + args[0] + " получил уведомление"
+	case "goal":
+		g, err := am.AddGoal(m.From.ID, args)
+		if err != nil {
+			log.Printf("[ERROR] unable to add goal %+v", err)
+			msg.Text = "Ошибка. Невозможно добавить цель\n\n" + goalHelp
+			return true
+		}
+		msg.Text = fmt.Sprintf("Цель «%s» добавлена", g.Name)
+	case "reward":
+		r, err := am.AddReward(m.From.ID, args)
+		if err != nil {
+			log.Printf("[ERROR] unable to add reward %+v", err)
+			msg.Text = "Ошибка. Невозможно добавить награду\n\n" + rewardHelp
+			return true
+		}
+		msg.Text = fmt.Sprintf("Награда «%s» добавлена в магазин", r.Name)
+	case "delreward":
+		if len(args) != 1 {
+			msg.Text = rewardHelp
+			return true
+		}
+		if err := am.DeleteReward(m.From.ID, args[0]); err != nil {
+			log.Printf("[ERROR] unable to delete reward %+v", err)
+			msg.Text = "Ошибка. Невозможно удалить награду"
+			return true
+		}
+		msg.Text = "Награда удалена"
+	case "allowance":
+		if len(args) < 2 {
+			msg.Text = listAllowances(am, db, m.From.ID)
+			return true
+		}
+		a, err := am.SetAllowance(m.From.ID, args[0], args[1:])
+		if err != nil {
+			log.Printf("[ERROR] unable to set allowance %+v", err)
+			msg.Text = "Ошибка. Невозможно настроить карманные деньги\n\n" + allowanceHelp
+			return true
+		}
+		if a.Amount == 0 {
+			msg.Text = "Карманные деньги для " + args[0] + " отключены"
+			return true
+		}
+		msg.Text = "Карманные деньги: " + describeAllowance(db, a)
+	case "interest":
+		msg.Text = setInterest(am, m.From.ID, args)
+	case "rate":
+		msg.Text = setRate(am, m.From.ID, args)
+	case "cashout":
+		if len(args) != 1 {
+			msg.Text = cashOutView(am, db, m.From.ID)
+			return true
+		}
+		coins, err := strconv.Atoi(args[0])
+		if err != nil {
+			msg.Text = "Ошибка. Неверная сумма\n\n" + cashOutView(am, db, m.From.ID)
+			return true
+		}
+		notifications, err := am.RequestWithdrawal(m.From.ID, coins)
+		if err != nil {
+			log.Printf("[ERROR] unable to request withdrawal %+v", err)
+			msg.Text = "Невозможно обменять динокоины\n\n" + cashOutView(am, db, m.From.ID)
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = "Запрос отправлен родителям. Жди подтверждения"
+	case "reminders":
+		msg.Text = setReminders(am, m.From.ID, args)
+	case "photo":
+		msg.Text = setPhotoRequired(am, m.From.ID, args)
+	case "assign":
+		if len(args) < 2 {
+			msg.Text = assignmentsView(am, db, m.From.ID)
+			return true
+		}
+
+		t, notifications, err := am.AssignTask(m.From.ID, args, time.Now())
+		if err != nil {
+			log.Printf("[ERROR] unable to assign task %+v", err)
+			msg.Text = "Ошибка. Невозможно назначить задание\n\n" + assignHelp
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = fmt.Sprintf("Задание %s назначено %s, ждем ответа", store.OperationTitle(t.Operation), args[0])
+	case "cost":
+		msg.Text = setCost(am, m.From.ID, args)
+	case "admin":
+		msg.Text = adminLinkView(am, m.From.ID)
+		msg.DisableWebPagePreview = true
+	case "api":
+		msg.Text = apiTokens(am, m.From.ID, args)
+	case "maxtasks":
+		msg.Text = setMaxOpenTasks(am, m.From.ID, args)
+	case "digest":
+		msg.Text = setDigest(am, db, m.From.ID, args)
+	case "badgebonus":
+		msg.Text = setBadgeBonus(am, m.From.ID, args)
+	case "competition":
+		msg.Text = setCompetitionPrize(am, m.From.ID, args)
+	case "board":
+		if len(args) == 0 {
+			msg.Text = listBoard(am, db, m.From.ID)
+			return true
+		}
+
+		bt, notifications, err := am.PostBoardTask(m.From.ID, args)
+		if err != nil {
+			log.Printf("[ERROR] unable to post board task %+v", err)
+			msg.Text = "Ошибка. Невозможно выложить задание\n\n" + boardHelp
+			return true
+		}
+		notify(bot, notifications)
+		msg.Text = fmt.Sprintf("Задание %s выложено на доску", store.OperationTitle(bt.Operation))
+	case "delboard":
+		if len(args) != 1 {
+			msg.Text = boardHelp
+			return true
+		}
+		if err := am.DeleteBoardTask(m.From.ID, args[0]); err != nil {
+			log.Printf("[ERROR] unable to delete board task %+v", err)
+			msg.Text = "Ошибка. Невозможно убрать задание, возможно его уже взяли"
+			return true
+		}
+		msg.Text = "Задание убрано с доски"
+	default:
+		return false
+	}
+
+	return true
+}
+
+// setReminders changes reminder delays if they are passed and reports current ones
+func setReminders(am *store.ActionManager, parentId int64, args []string) string {
+	const help = "\n\nИзменить: /reminders 2h 6h (ребенку о задании, родителю о подтверждении, 0 - выключить)"
+
+	if len(args) == 2 {
+		childAfter, errChild := time.ParseDuration(args[0])
+		parentAfter, errParent := time.ParseDuration(args[1])
+		if errChild != nil || errParent != nil {
+			return "Ошибка. Неверный формат времени" + help
+		}
+
+		if err := am.SetReminders(parentId, childAfter, parentAfter); err != nil {
+			log.Printf("[ERROR] unable to set reminders %+v", err)
+			return "Ошибка. Невозможно изменить напоминания" + help
+		}
+	}
+
+	settings, err := am.FamilySettings(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load family settings %+v", err)
+		return "Ошибка"
+	}
+
+	return fmt.Sprintf("Напоминание ребенку через %v, родителю через %v", settings.ChildReminderAfter,
+		settings.ParentReminderAfter) + help
+}
+
+// setPhotoRequired makes photo proof mandatory or optional for the operation and reports current settings
+func setPhotoRequired(am *store.ActionManager, parentId int64, args []string) string {
+	const help = "\n\nИзменить: /photo операция on|off, например /photo wash_floor_in_flat on\n" +
+		"Операции: walk_dog, free_dish, dirty_dish, go_to_shop, wash_floor_in_flat"
+
+	if len(args) == 2 {
+		if args[1] != "on" && args[1] != "off" {
+			return "Ошибка. Укажите on или off" + help
+		}
+		if err := am.SetPhotoRequired(parentId, args[0], args[1] == "on"); err != nil {
+			log.Printf("[ERROR] unable to set photo proof %+v", err)
+			return "Ошибка. Невозможно изменить настройку фото" + help
+		}
+	}
+
+	settings, err := am.FamilySettings(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load family settings %+v", err)
+		return "Ошибка"
+	}
+
+	if len(settings.PhotoRequired) == 0 {
+		return "Фото при завершении задания не обязательно" + help
+	}
+	titles := make([]string, 0, len(settings.PhotoRequired))
+	for _, op := range settings.PhotoRequired {
+		titles = append(titles, store.OperationTitle(op))
+	}
+	return "Фото обязательно для заданий: " + strings.Join(titles, ", ") + help
+}
+
+// setMaxOpenTasks changes number of tasks a child can hold at once if it is passed and reports current one
+func setMaxOpenTasks(am *store.ActionManager, parentId int64, args []string) string {
+	const help = "\n\nИзменить: /maxtasks N, например /maxtasks 3"
+
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "Ошибка. Неверное число" + help
+		}
+		if err = am.SetMaxOpenTasks(parentId, n); err != nil {
+			log.Printf("[ERROR] unable to set max open tasks %+v", err)
+			return "Ошибка. Невозможно изменить количество заданий" + help
+		}
+	}
+
+	settings, err := am.FamilySettings(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load family settings %+v", err)
+		return "Ошибка"
+	}
+	return fmt.Sprintf("Ребенок может взять до %d заданий одновременно", settings.MaxOpenTasks) + help
+}
+
+// setCost changes cost of the built-in task in parent's family if it is passed and reports current costs
+func setCost(am *store.ActionManager, parentId int64, args []string) string {
+	const help = "\n\nИзменить: /cost операция сумма, например /cost walk_dog 15"
+
+	if len(args) == 2 {
+		cost, err := strconv.Atoi(args[1])
+		if err != nil {
+			return "Ошибка. Неверная сумма" + help
+		}
+		if err = am.SetOperationCost(parentId, args[0], cost); err != nil {
+			log.Printf("[ERROR] unable to set operation cost %+v", err)
+			return "Ошибка. Невозможно изменить стоимость" + help
+		}
+	} else if len(args) != 0 {
+		return "Ошибка. Нужны операция и сумма" + help
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Стоимость заданий:\n")
+	for _, op := range store.TaskOperations {
+		cost, err := am.OperationCost(parentId, op)
+		if err != nil {
+			log.Printf("[ERROR] unable to load operation cost %+v", err)
+			return "Ошибка"
+		}
+		sb.WriteString(fmt.Sprintf("%s (%s): %d dinocoins\n", store.OperationTitle(op), op, cost))
+	}
+	return strings.TrimSuffix(sb.String(), "\n") + help
+}
+
+// setCompetitionPrize changes prize of the weekly competition if it is passed and reports current one
+func setCompetitionPrize(am *store.ActionManager, parentId int64, args []string) string {
+	const help = "\n\nИзменить: /competition приз, например /competition 20, /competition 0 - отключить"
+
+	if len(args) == 1 {
+		prize, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "Ошибка. Неверная сумма" + help
+		}
+		if err = am.SetCompetitionPrize(parentId, prize); err != nil {
+			log.Printf("[ERROR] unable to set competition prize %+v", err)
+			return "Ошибка. Невозможно изменить приз" + help
+		}
+	}
+
+	settings, err := am.FamilySettings(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load family settings %+v", err)
+		return "Ошибка"
+	}
+	if settings.CompetitionPrize == 0 {
+		return "Соревнование недели отключено, итоги приходят в воскресенье вечером" + help
+	}
+	return fmt.Sprintf("Соревнование недели: победитель получает %d dinocoins в воскресенье вечером",
+		settings.CompetitionPrize) + help
+}
+
+// setDigest changes schedule of the weekly digest if arguments are passed and reports current one
+func setDigest(am *store.ActionManager, db *store.BoltDB, parentId int64, args []string) string {
+	if len(args) == 1 && args[0] == "now" {
+		report, err := am.ParentDigest(parentId, time.Now())
+		if err != nil {
+			log.Printf("[ERROR] unable to build digest %+v", err)
+			return "Ошибка"
+		}
+		if len(report) == 0 {
+			return "Нет детей для отчета"
+		}
+		return store.DigestText(report)
+	}
+
+	if len(args) > 0 {
+		if _, err := am.SetDigest(parentId, args); err != nil {
+			log.Printf("[ERROR] unable to set digest %+v", err)
+			return "Ошибка. Невозможно настроить отчет\n\n" + digestHelp
+		}
+	}
+
+	d, ok, err := db.Digest(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load digest %+v", err)
+		return "Ошибка"
+	}
+	if !ok {
+		return "Еженедельный отчет отключен\n\n" + digestHelp
+	}
+	return fmt.Sprintf("Еженедельный отчет: %s %02d:%02d\n\n%s", strings.ToLower(d.Weekday.String()[:3]),
+		d.Hour, d.Minute, digestHelp)
+}
+
+// setBadgeBonus changes bonus granted with badges if it is passed and reports current one
+func setBadgeBonus(am *store.ActionManager, parentId int64, args []string) string {
+	const help = "\n\nИзменить: /badgebonus сумма, например /badgebonus 10, /badgebonus 0 - отключить"
+
+	if len(args) == 1 {
+		bonus, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "Ошибка. Неверная сумма" + help
+		}
+		if err = am.SetBadgeBonus(parentId, bonus); err != nil {
+			log.Printf("[ERROR] unable to set badge bonus %+v", err)
+			return "Ошибка. Невозможно изменить бонус" + help
+		}
+	}
+
+	settings, err := am.FamilySettings(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load family settings %+v", err)
+		return "Ошибка"
+	}
+	if settings.BadgeBonus == 0 {
+		return "Награды выдаются без бонуса" + help
+	}
+	return fmt.Sprintf("За каждую награду ребенок получает %d dinocoins", settings.BadgeBonus) + help
+}
+
+// badgesView shows child's streak, earned badges and progress towards the rest
+func badgesView(am *store.ActionManager, db *store.BoltDB, childId int64) string {
+	child, err := db.FindUser(childId)
+	if err != nil {
+		log.Printf("[ERROR] unable to find user %+v", err)
+		return "Ошибка"
+	}
+	stats, err := am.AchievementStats(childId, time.Now())
+	if err != nil {
+		log.Printf("[ERROR] unable to load achievements %+v", err)
+		return "Ошибка"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Дней подряд: %d\n", stats.Streak))
+	if len(child.Badges) > 0 {
+		sb.WriteString("\nТвои награды:\n")
+	}
+	for _, b := range child.Badges {
+		if a, ok := store.AchievementByID(b.ID); ok {
+			sb.WriteString(fmt.Sprintf("%s - %s\n", a.Title, b.Awarded.Format("02.01.2006")))
+		}
+	}
+
+	var next []string
+	for _, a := range store.Achievements {
+		if !child.HasBadge(a.ID) {
+			next = append(next, fmt.Sprintf("%s - %d/%d", a.Title, a.Progress(stats), a.Goal))
+		}
+	}
+	if len(next) > 0 {
+		sb.WriteString("\nЕще можно получить:\n" + strings.Join(next, "\n"))
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// leaderboardView shows family standings for the current week and month
+func leaderboardView(am *store.ActionManager, userId int64, now time.Time) string {
+	periods := []struct {
+		title string
+		from  time.Time
+	}{
+		{"Эта неделя", store.WeekStart(now)},
+		{"Этот месяц", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())},
+	}
+
+	var sb strings.Builder
+	for _, p := range periods {
+		standings, err := am.Leaderboard(userId, p.from, now)
+		if err != nil {
+			log.Printf("[ERROR] unable to load leaderboard %+v", err)
+			return "Ошибка"
+		}
+		if len(standings) == 0 {
+			return "В семье пока нет детей"
+		}
+
+		sb.WriteString(p.title + ":\n")
+		for i, s := range standings {
+			sb.WriteString(fmt.Sprintf("%d. @%s - %d dinocoins, заданий %d, %d дн. подряд\n", i+1, s.Child.Nickname,
+				s.Coins, s.Tasks, s.Streak))
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// setInterest changes weekly interest if arguments are passed and reports current one
+func setInterest(am *store.ActionManager, parentId int64, args []string) string {
+	const help = "\n\nИзменить: /interest процент [максимум], например /interest 2 50. Выключить: /interest 0"
+
+	if len(args) == 1 || len(args) == 2 {
+		percent, err := strconv.Atoi(args[0])
+		maxInterest := 0
+		if err == nil && len(args) == 2 {
+			maxInterest, err = strconv.Atoi(args[1])
+		}
+		if err != nil {
+			return "Ошибка. Неверный процент" + help
+		}
+
+		if err = am.SetInterest(parentId, percent, maxInterest); err != nil {
+			log.Printf("[ERROR] unable to set interest %+v", err)
+			return "Ошибка. Невозможно изменить проценты" + help
+		}
+	}
+
+	settings, err := am.FamilySettings(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load family settings %+v", err)
+		return "Ошибка"
+	}
+
+	if settings.InterestPercent == 0 {
+		return "Проценты на накопления выключены" + help
+	}
+	text := fmt.Sprintf("Проценты на накопления: %d%% в неделю от среднего баланса", settings.InterestPercent)
+	if settings.InterestCap > 0 {
+		text += fmt.Sprintf(", не больше %d", settings.InterestCap)
+	}
+	return text + help
+}
+
+// setRate adds exchange rate if arguments are passed and reports rate history
+func setRate(am *store.ActionManager, parentId int64, args []string) string {
+	const help = "\n\nИзменить: /rate рублей_за_динокоин [минимум], например /rate 0.5 100"
+
+	if len(args) == 1 || len(args) == 2 {
+		kopecks, err := store.ParseRubles(args[0])
+		minCashOut := 0
+		if err == nil && len(args) == 2 {
+			minCashOut, err = strconv.Atoi(args[1])
+		}
+		if err != nil {
+			return "Ошибка. Неверный курс" + help
+		}
+
+		if err = am.SetRate(parentId, kopecks, minCashOut); err != nil {
+			log.Printf("[ERROR] unable to set rate %+v", err)
+			return "Ошибка. Невозможно изменить курс" + help
+		}
+	}
+
+	rates, err := am.Rates(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load rates %+v", err)
+		return "Ошибка"
+	}
+	if len(rates) == 0 {
+		return "Курс не установлен" + help
+	}
+
+	var sb strings.Builder
+	sb.WriteString("История курса:\n")
+	for _, r := range rates {
+		sb.WriteString(fmt.Sprintf("с %s: 1 dinocoin = %s, минимум %d\n", r.Since.Format("02.01.2006 15:04"),
+			store.FormatRubles(r.Kopecks), r.MinCashOut))
+	}
+	return sb.String() + help
+}
+
+// cashOutView explains child how many coins can be exchanged
+func cashOutView(am *store.ActionManager, db *store.BoltDB, childId int64) string {
+	rate, err := am.CurrentRate(childId)
+	if err != nil {
+		log.Printf("[WARN] unable to get rate %+v", err)
+		return "Родители еще не установили курс обмена"
+	}
+
+	balance, err := db.Balance(childId)
+	if err != nil {
+		log.Printf("[ERROR] unable to get balance %+v", err)
+		return "Ошибка"
+	}
+
+	return fmt.Sprintf("Баланс: %d dinocoins = %s\nКурс: 1 dinocoin = %s, минимум %d\n\nОбменять: /cashout сумма",
+		balance, store.FormatRubles(balance*rate.Kopecks), store.FormatRubles(rate.Kopecks), rate.MinCashOut)
+}
+
+// cashSummaryView shows money owed and paid to the children
+func cashSummaryView(am *store.ActionManager, db *store.BoltDB, parentId int64) (string, interface{}) {
+	summary, err := am.CashSummary(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to get cash summary %+v", err)
+		return "Ошибка", nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Должны выплатить: %s\nУже выплачено: %s\n", store.FormatRubles(summary.OwedKopecks),
+		store.FormatRubles(summary.PaidKopecks)))
+
+	kbd := tgbotapi.NewInlineKeyboardMarkup()
+	for _, w := range summary.Owed {
+		child := fmt.Sprint(w.ChildID)
+		if u, err := db.FindUser(w.ChildID); err == nil {
+			child = "@" + u.Nickname
+		}
+		sb.WriteString(fmt.Sprintf("#%s %s: %d dinocoins = %s (курс %s)\n", w.ID, child, w.Coins,
+			store.FormatRubles(w.Kopecks), store.FormatRubles(w.RateKopecks)))
+		kbd.InlineKeyboard = append(kbd.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Выплачено #"+w.ID, "wdpaid:"+w.ID)))
+	}
+
+	if len(kbd.InlineKeyboard) == 0 {
+		return sb.String(), nil
+	}
+	return sb.String(), kbd
+}
+
+// listChores returns parent's chores with help
+func listChores(db *store.BoltDB, parentId int64) string {
+	chores, err := db.Chores(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load chores %+v", err)
+		return "Ошибка"
+	}
+
+	var sb strings.Builder
+	for _, c := range chores {
+		sb.WriteString(describeChore(db, c) + "\n")
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("Регулярных заданий нет\n")
+	}
+	sb.WriteString("\n" + choreHelp)
+
+	return sb.String()
+}
+
+// listAllowances returns family's allowances with help
+func listAllowances(am *store.ActionManager, db *store.BoltDB, parentId int64) string {
+	familyId, err := am.FamilyID(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to find family %+v", err)
+		return "Ошибка"
+	}
+
+	allowances, err := db.Allowances(familyId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load allowances %+v", err)
+		return "Ошибка"
+	}
+
+	var sb strings.Builder
+	for _, a := range allowances {
+		sb.WriteString(describeAllowance(db, a) + "\n")
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("Карманные деньги не настроены\n")
+	}
+	sb.WriteString("\n" + allowanceHelp)
+
+	return sb.String()
+}
+
+func describeAllowance(db *store.BoltDB, a store.Allowance) string {
+	child := fmt.Sprint(a.ChildID)
+	if u, err := db.FindUser(a.ChildID); err == nil {
+		child = "@" + u.Nickname
+	}
+	return fmt.Sprintf("%s: %d dinocoins, %s %02d:%02d", child, a.Amount, a.Weekday.String()[:3], a.Hour, a.Minute)
+}
+
+// listRewards returns family's reward catalog with help for parents
+func listRewards(am *store.ActionManager, parentId int64) string {
+	rewards, err := am.Rewards(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load rewards %+v", err)
+		return "Ошибка"
+	}
+
+	var sb strings.Builder
+	for _, r := range rewards {
+		sb.WriteString(fmt.Sprintf("#%s %s - %d dinocoins", r.ID, r.Name, r.Price))
+		if r.Stock != store.UnlimitedStock {
+			sb.WriteString(fmt.Sprintf(", осталось %d", r.Stock))
+		}
+		if r.WeeklyLimit > 0 {
+			sb.WriteString(fmt.Sprintf(", не больше %d в неделю", r.WeeklyLimit))
+		}
+		sb.WriteString("\n")
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("Магазин пуст\n")
+	}
+	sb.WriteString("\n" + rewardHelp)
+
+	return sb.String()
+}
+
+// listBoard returns family's task board with help for parents
+func listBoard(am *store.ActionManager, db *store.BoltDB, parentId int64) string {
+	tasks, err := am.Board(parentId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load board %+v", err)
+		return "Ошибка"
+	}
+
+	var sb strings.Builder
+	for _, bt := range tasks {
+		sb.WriteString(fmt.Sprintf("#%s %s - %d dinocoins%s\n", bt.ID, store.OperationTitle(bt.Operation), bt.Reward,
+			boardTaskOwner(db, bt)))
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("Доска пуста\n")
+	}
+	sb.WriteString("\n" + boardHelp)
+
+	return sb.String()
+}
+
+// boardView shows free board tasks as claim buttons, tasks taken by siblings are listed in the text
+func boardView(am *store.ActionManager, db *store.BoltDB, childId int64) (string, interface{}) {
+	tasks, err := am.Board(childId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load board %+v", err)
+		return "Ошибка", nil
+	}
+
+	var sb strings.Builder
+	kbd := tgbotapi.NewInlineKeyboardMarkup()
+	for _, bt := range tasks {
+		if bt.Status == store.BoardFreeStatus {
+			kbd.InlineKeyboard = append(kbd.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s - %d", store.OperationTitle(bt.Operation), bt.Reward),
+					"claim:"+bt.ID)))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s%s\n", store.OperationTitle(bt.Operation), boardTaskOwner(db, bt)))
+	}
+
+	if len(tasks) == 0 {
+		return "На доске пока нет заданий", nil
+	}
+	if len(kbd.InlineKeyboard) == 0 {
+		return "Все задания уже разобраны:\n" + sb.String(), nil
+	}
+	if sb.Len() > 0 {
+		return "Уже разобраны:\n" + sb.String() + "\nВыбери задание, которое возьмешь", kbd
+	}
+	return "Выбери задание, которое возьмешь", kbd
+}
+
+// boardTaskOwner describes who claimed the board task
+func boardTaskOwner(db *store.BoltDB, bt store.BoardTask) string {
+	if bt.Status != store.BoardClaimedStatus {
+		return ""
+	}
+	child, err := db.FindUser(bt.ClaimedBy)
+	if err != nil {
+		return " - занято"
+	}
+	return " - занято @" + child.Nickname
+}
+
+// shopView shows rewards available to the child as inline buttons
+func shopView(am *store.ActionManager, childId int64) (string, interface{}) {
+	rewards, err := am.Rewards(childId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load rewards %+v", err)
+		return "Ошибка", nil
+	}
+
+	kbd := tgbotapi.NewInlineKeyboardMarkup()
+	for _, r := range rewards {
+		if r.Stock == 0 {
+			continue
+		}
+		kbd.InlineKeyboard = append(kbd.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s - %d", r.Name, r.Price), "shop:"+r.ID)))
+	}
+
+	if len(kbd.InlineKeyboard) == 0 {
+		return "В магазине пока ничего нет. Попроси родителей добавить награды", nil
+	}
+	return "Выбери награду", kbd
+}
+
+// goalsView shows child's goals with progress and purchase buttons
+func goalsView(db *store.BoltDB, childId int64) (string, interface{}) {
+	goals, err := db.Goals(childId)
+	if err != nil {
+		log.Printf("[ERROR] unable to load goals %+v", err)
+		return "Ошибка", nil
+	}
+
+	balance, err := db.Balance(childId)
+	if err != nil {
+		log.Printf("[ERROR] unable to get balance %+v", err)
+		return "Ошибка", nil
+	}
+
+	if len(goals) == 0 {
+		return "Целей пока нет\n\n" + goalHelp, nil
+	}
+
+	var sb strings.Builder
+	kbd := tgbotapi.NewInlineKeyboardMarkup()
+	for _, g := range goals {
+		progress := g.Progress(balance)
+		saved := balance
+		if saved > g.Target {
+			saved = g.Target
+		}
+		bar := strings.Repeat("▓", progress/10) + strings.Repeat("░", 10-progress/10)
+		sb.WriteString(fmt.Sprintf("%s %d/%d %s %d%%", g.Name, saved, g.Target, bar, progress))
+		if !g.Deadline.IsZero() {
+			sb.WriteString(", до " + g.Deadline.Format("02.01.2006"))
+		}
+		if g.Status == store.GoalRequestedStatus {
+			sb.WriteString(", ждет одобрения родителей")
+		}
+		sb.WriteString("\n")
+
+		row := tgbotapi.NewInlineKeyboardRow()
+		if progress == 100 && g.Status == store.GoalActiveStatus {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData("Купить «"+g.Name+"»", "goalbuy:"+g.ID))
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Удалить «"+g.Name+"»", "goaldel:"+g.ID))
+		kbd.InlineKeyboard = append(kbd.InlineKeyboard, row)
+	}
+	sb.WriteString("\n" + goalHelp)
+
+	return sb.String(), kbd
+}
+
+// describeTransaction formats transaction as a history line
+func describeTransaction(t store.Transaction) string {
+	amount := strconv.Itoa(t.Cost)
+	if delta := t.BalanceDelta(); delta > 0 {
+		amount = "+" + strconv.Itoa(delta)
+	} else if delta < 0 {
+		amount = strconv.Itoa(delta)
+	}
+
+	status := t.Status
+	if t.Status == store.ExpiredStatus {
+		status = "⌛ просрочено"
+	}
+
+	fields := []string{store.OperationTitle(t.Operation), t.Timestamp.Format("02.01 15:04"), status, amount}
+	if t.Reason != "" {
+		fields = append(fields, t.Reason)
+	}
+	if t.PhotoID != "" {
+		fields = append(fields, "📷")
+	}
+	return strings.Join(fields, "\t")
+}
+
+// assignmentsView lists tasks assigned by the parent during the last month with their status
+func assignmentsView(am *store.ActionManager, db *store.BoltDB, parentId int64) string {
+	assignments, err := am.Assignments(parentId, time.Now().AddDate(0, -1, 0))
+	if err != nil {
+		log.Printf("[ERROR] unable to load assignments %+v", err)
+		return "Ошибка"
+	}
+	if len(assignments) == 0 {
+		return "Назначенных заданий нет\n\n" + assignHelp
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Назначенные задания:\n")
+	for _, t := range assignments {
+		child, err := db.FindUser(t.UserId)
+		name := fmt.Sprint(t.UserId)
+		if err == nil {
+			name = "@" + child.Nickname
+		}
+		sb.WriteString(fmt.Sprintf("%s %s, %d dinocoins: %s", name, store.OperationTitle(t.Operation), t.Cost,
+			assignmentStatus(t)))
+		if !t.Deadline.IsZero() {
+			sb.WriteString(", до " + t.Deadline.Format("02.01 15:04"))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String() + "\n" + assignHelp
+}
+
+// assignmentStatus describes progress of the assigned task
+func assignmentStatus(t store.Transaction) string {
+	switch t.Status {
+	case store.OpenStatus:
+		if t.AcceptedAt.IsZero() {
+			return "ждет ответа"
+		}
+		return "в работе"
+	case store.PendingStatus:
+		return "на проверке"
+	case store.CompletedStatus, store.ApprovedStatus:
+		return "выполнено"
+	case store.DeclinedStatus:
+		return "отказ"
+	case store.ExpiredStatus:
+		return "просрочено"
+	case store.CanceledStatus:
+		return "отменено"
+	}
+	return t.Status
+}
+
+// openTasksKeyboard builds a row with finish and cancel buttons for each open task of the child
+func openTasksKeyboard(tasks []store.Transaction) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(tasks))
+	for _, t := range tasks {
+		title := store.OperationTitle(t.Operation)
+		if !t.Deadline.IsZero() {
+			title += " до " + t.Deadline.Format("02.01 15:04")
+		}
+		if t.Status == store.PendingStatus {
+			title += " ⏳"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ "+title, "finish:"+t.ID),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отменить", "cancel:"+t.ID)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// approvalKeyboard builds a row with approve and reject buttons for each task the child finished,
+// open tasks are skipped as the child has not asked to check them yet
+func approvalKeyboard(tasks []store.Transaction) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(tasks))
+	for _, t := range tasks {
+		if t.Status != store.PendingStatus {
+			continue
+		}
+		data := fmt.Sprintf("%d:%s", t.UserId, t.ID)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ "+store.OperationTitle(t.Operation), "taskok:"+data),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отклонить", "taskno:"+data)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// historyPhotoKeyboard builds buttons showing photo proofs of the transactions, one per row
+func historyPhotoKeyboard(transactions []store.Transaction) (tgbotapi.InlineKeyboardMarkup, bool) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, t := range transactions {
+		if t.PhotoID == "" {
+			continue
+		}
+		title := "📷 " + store.OperationTitle(t.Operation) + " " + t.Timestamp.Format("02.01 15:04")
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("photo:%d:%s", t.UserId, t.ID))))
+	}
+
+	if len(rows) == 0 {
+		return tgbotapi.InlineKeyboardMarkup{}, false
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...), true
+}
+
+func describeChore(db *store.BoltDB, c store.Chore) string {
+	child := fmt.Sprint(c.ChildID)
+	if u, err := db.FindUser(c.ChildID); err == nil {
+		child = "@" + u.Nickname
+	}
+	return fmt.Sprintf("#%s %s: %s %s", c.ID, child, store.OperationTitle(c.Operation), c.ScheduleString())
+}
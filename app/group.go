@@ -0,0 +1,181 @@
+package main
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"main/store"
+	"strings"
+	"time"
+)
+
+const groupHelp = `Я Дино, бот семейных заданий. В этом чате я пишу о выполненных заданиях, наградах,
+новых заданиях на доске и итогах недели.
+/link - привязать чат к семье (родитель)
+/unlink - отвязать чат
+/top - рейтинг детей
+/board - доска заданий, родитель может выложить задание: /board операция [награда]
+/bonus, /fine, /assign - как в личных сообщениях
+Все остальное, например выплаты и стоимость заданий, - в личных сообщениях со мной`
+
+const privateOnlyText = "Это можно сделать только в личных сообщениях со мной"
+
+// groupCommands work in the family group chat, the rest of commands are private
+var groupCommands = map[string]bool{"link": true, "unlink": true, "top": true, "help": true, "start": true,
+	"board": true, "bonus": true, "fine": true, "assign": true}
+
+// isGroupChat checks if the chat is a group or a supergroup
+func isGroupChat(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+// handleGroupMessage processes commands and mentions of the bot in the group chat, other messages are ignored
+func handleGroupMessage(bot *tgbotapi.BotAPI, am *store.ActionManager, db *store.BoltDB, m *tgbotapi.Message) {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "")
+	msg.ReplyToMessageID = m.MessageID
+
+	switch {
+	case isBotAdded(bot, m):
+		msg.Text = groupHelp
+	case m.IsCommand():
+		groupCommand(bot, am, db, m, &msg)
+	case isMentioned(bot, m):
+		groupMention(am, db, m, &msg)
+	default:
+		return
+	}
+
+	if msg.Text == "" {
+		return
+	}
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("[WARN] unable to send message to group %d: %+v", m.Chat.ID, err)
+	}
+}
+
+// groupCommand handles commands allowed in the group, members must belong to the linked family
+func groupCommand(bot *tgbotapi.BotAPI, am *store.ActionManager, db *store.BoltDB, m *tgbotapi.Message,
+	msg *tgbotapi.MessageConfig) {
+	if !groupCommands[m.Command()] {
+		msg.Text = privateOnlyText
+		return
+	}
+
+	switch m.Command() {
+	case "help", "start":
+		msg.Text = groupHelp
+		return
+	case "link":
+		if err := am.LinkGroupChat(m.From.ID, m.Chat.ID); err != nil {
+			log.Printf("[ERROR] unable to link group chat %+v", err)
+			msg.Text = "Ошибка. Привязать чат может зарегистрированный родитель"
+			return
+		}
+		msg.Text = "Чат привязан к семье. Здесь будут подтвержденные задания, доска заданий, награды и итоги недели"
+		return
+	case "unlink":
+		if err := am.UnlinkGroupChat(m.From.ID, m.Chat.ID); err != nil {
+			log.Printf("[ERROR] unable to unlink group chat %+v", err)
+			msg.Text = "Ошибка. Отвязать чат может родитель из привязанной семьи"
+			return
+		}
+		msg.Text = "Чат отвязан, сообщения будут приходить в личные чаты"
+		return
+	}
+
+	user, ok := groupMember(bot, am, m.Chat.ID, m.From.ID, msg)
+	if !ok {
+		return
+	}
+
+	switch {
+	case m.Command() == "top":
+		msg.Text = leaderboardView(am, user.ID, time.Now())
+	case m.Command() == "board" && m.CommandArguments() == "":
+		msg.Text, msg.ReplyMarkup = boardView(am, db, user.ID)
+	default:
+		handleCommand(bot, am, db, m, msg)
+	}
+}
+
+// groupMention answers messages addressed to the bot: "рейтинг", "доска" or help
+func groupMention(am *store.ActionManager, db *store.BoltDB, m *tgbotapi.Message, msg *tgbotapi.MessageConfig) {
+	text := strings.ToLower(m.Text)
+	if !strings.Contains(text, "рейтинг") && !strings.Contains(text, "доск") {
+		msg.Text = groupHelp
+		return
+	}
+
+	user, err := am.GroupMember(m.Chat.ID, m.From.ID)
+	if err != nil {
+		log.Printf("[DEBUG] group mention by stranger %+v", err)
+		msg.Text = groupHelp
+		return
+	}
+
+	if strings.Contains(text, "рейтинг") {
+		msg.Text = leaderboardView(am, user.ID, time.Now())
+		return
+	}
+	msg.Text, msg.ReplyMarkup = boardView(am, db, user.ID)
+}
+
+// handleGroupCallback processes buttons pressed in the group chat, answers are sent privately.
+// Only board claims are public, the rest of buttons belong to private chats.
+func handleGroupCallback(bot *tgbotapi.BotAPI, am *store.ActionManager, q *tgbotapi.CallbackQuery) {
+	answer := ""
+	defer func() {
+		if _, err := bot.Request(tgbotapi.NewCallback(q.ID, answer)); err != nil {
+			log.Printf("[WARN] unable to answer callback: %+v", err)
+		}
+	}()
+
+	if !strings.HasPrefix(q.Data, "claim:") {
+		answer = privateOnlyText
+		return
+	}
+
+	msg := tgbotapi.NewMessage(q.Message.Chat.ID, "")
+	user, ok := groupMember(bot, am, q.Message.Chat.ID, q.From.ID, &msg)
+	if !ok {
+		answer = msg.Text
+		return
+	}
+
+	msg = tgbotapi.NewMessage(user.ChatID, "")
+	handleCallback(bot, am, q, &msg)
+	answer = msg.Text
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("[WARN] unable to send message to %d: %+v", user.ChatID, err)
+	}
+}
+
+// groupMember maps the sender to the registered family member, explains what to do otherwise
+func groupMember(bot *tgbotapi.BotAPI, am *store.ActionManager, chatId, userId int64,
+	msg *tgbotapi.MessageConfig) (store.User, bool) {
+	user, err := am.GroupMember(chatId, userId)
+	if err != nil {
+		log.Printf("[DEBUG] not a group member %+v", err)
+		msg.Text = "Чат не привязан к твоей семье. Зарегистрируйся в личных сообщениях с @" + bot.Self.UserName +
+			", а родитель пусть отправит тут /link"
+		return store.User{}, false
+	}
+	return user, true
+}
+
+// isBotAdded checks if the message announces the bot joined the group
+func isBotAdded(bot *tgbotapi.BotAPI, m *tgbotapi.Message) bool {
+	for _, u := range m.NewChatMembers {
+		if u.ID == bot.Self.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// isMentioned checks if the message mentions the bot or replies to its message
+func isMentioned(bot *tgbotapi.BotAPI, m *tgbotapi.Message) bool {
+	if m.ReplyToMessage != nil && m.ReplyToMessage.From != nil && m.ReplyToMessage.From.ID == bot.Self.ID {
+		return true
+	}
+	return bot.Self.UserName != "" && strings.Contains(m.Text, "@"+bot.Self.UserName)
+}
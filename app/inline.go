@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"main/store"
+	"strconv"
+	"strings"
+)
+
+// inlineCacheTime is how long Telegram caches personal inline results, in seconds
+const inlineCacheTime = 30
+
+// handleInlineQuery answers "@bot ..." queries with balance, goals and challenges of the querying user
+func handleInlineQuery(bot *tgbotapi.BotAPI, db *store.BoltDB, q *tgbotapi.InlineQuery) {
+	answer := tgbotapi.InlineConfig{InlineQueryID: q.ID, CacheTime: inlineCacheTime, IsPersonal: true,
+		Results: []interface{}{}}
+
+	user, err := db.FindUser(q.From.ID)
+	if err != nil {
+		answer.SwitchPMText = "Зарегистрироваться в Дино"
+		answer.SwitchPMParameter = "start"
+	} else {
+		query := strings.ToLower(strings.TrimSpace(q.Query))
+		for _, r := range inlineResults(db, user) {
+			if query == "" || strings.Contains(strings.ToLower(r.Title), query) {
+				answer.Results = append(answer.Results, r)
+			}
+		}
+	}
+
+	if _, err := bot.Request(answer); err != nil {
+		log.Printf("[WARN] unable to answer inline query %s: %+v", q.ID, err)
+	}
+}
+
+// inlineResults builds articles of the user: balance and goals of the child, children balances for parents
+func inlineResults(db *store.BoltDB, user store.User) []tgbotapi.InlineQueryResultArticle {
+	if user.Type == store.PARENT {
+		children, err := db.FindChildren(user.ID)
+		if err != nil {
+			log.Printf("[ERROR] unable to find children %+v", err)
+			return nil
+		}
+
+		var lines []string
+		for _, nick := range children {
+			child, err := db.FindUserByNickname(strings.TrimPrefix(nick, "@"))
+			if err != nil || child.ID == 0 {
+				continue
+			}
+			balance, _ := db.Balance(child.ID)
+			lines = append(lines, fmt.Sprintf("%s: %d dinocoins", nick, balance))
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+		return []tgbotapi.InlineQueryResultArticle{inlineArticle("balance", "Балансы детей",
+			strings.Join(lines, "\n"))}
+	}
+
+	balance, err := db.Balance(user.ID)
+	if err != nil {
+		log.Printf("[ERROR] unable to get balance %+v", err)
+		return nil
+	}
+	results := []tgbotapi.InlineQueryResultArticle{inlineArticle("balance", "Мой баланс",
+		fmt.Sprintf("У меня %d dinocoins 🦖", balance))}
+
+	goals, err := db.Goals(user.ID)
+	if err != nil {
+		log.Printf("[ERROR] unable to load goals %+v", err)
+	}
+	var lines []string
+	for _, g := range goals {
+		if g.Status == store.GoalActiveStatus {
+			lines = append(lines, fmt.Sprintf("%s - %d%% из %d", g.Name, g.Progress(balance), g.Target))
+		}
+	}
+	if len(lines) > 0 {
+		results = append(results, inlineArticle("goals", "Мои цели", "Коплю на:\n"+strings.Join(lines, "\n")))
+	}
+
+	for _, op := range store.TaskOperations {
+		article := inlineArticle("challenge:"+op, "Вызов: "+store.OperationTitle(op),
+			fmt.Sprintf("@%s бросает вызов: кто быстрее - %s?", user.Nickname, store.OperationTitle(op)))
+		kbd := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Принять вызов", store.ChallengeData(user.ID, op))))
+		article.ReplyMarkup = &kbd
+		results = append(results, article)
+	}
+	return results
+}
+
+func inlineArticle(id, title, text string) tgbotapi.InlineQueryResultArticle {
+	article := tgbotapi.NewInlineQueryResultArticle(id, title, text)
+	article.Description = text
+	return article
+}
+
+// handleInlineCallback processes buttons of messages sent via inline mode, such messages have no chat.
+// The answer is shown to the user as a popup.
+func handleInlineCallback(bot *tgbotapi.BotAPI, am *store.ActionManager, q *tgbotapi.CallbackQuery) {
+	answer := tgbotapi.NewCallbackWithAlert(q.ID, "Ошибка")
+	defer func() {
+		if _, err := bot.Request(answer); err != nil {
+			log.Printf("[WARN] unable to answer callback: %+v", err)
+		}
+	}()
+
+	// challenge:<operation>:<challengerId>
+	parts := strings.Split(q.Data, ":")
+	if len(parts) != 3 || parts[0] != "challenge" {
+		log.Printf("[WARN] unknown inline callback %s", q.Data)
+		return
+	}
+	challengerId, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		log.Printf("[WARN] malformed challenge %s", q.Data)
+		return
+	}
+
+	t, notifications, err := am.AcceptChallenge(q.From.ID, challengerId, parts[1])
+	switch {
+	case errors.Is(err, store.ErrTaskInProgress):
+		answer.Text = "Это задание у тебя уже есть"
+	case errors.Is(err, store.ErrTooManyTasks):
+		answer.Text = tooManyTasksText
+	case err != nil:
+		log.Printf("[ERROR] unable to accept challenge %+v", err)
+		answer.Text = "Вызов могут принять только братья и сестры из Дино"
+	default:
+		notify(bot, notifications)
+		answer.Text = "Вызов принят! Задание " + store.OperationTitle(t.Operation) + " в «Мои задания»"
+	}
+}
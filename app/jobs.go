@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"main/scheduler"
+	"main/store"
+	"time"
+)
+
+// startScheduler registers background jobs and runs them until context canceled
+func startScheduler(ctx context.Context, bot *tgbotapi.BotAPI, am *store.ActionManager) {
+	sch := scheduler.New(scheduler.SystemClock{}, time.Minute)
+
+	sch.Add("chores", func(now time.Time) error {
+		notifications, err := am.MaterializeChores(now)
+		notify(bot, notifications)
+		return err
+	})
+
+	sch.Add("reminders", func(now time.Time) error {
+		notifications, err := am.SendReminders(now)
+		notify(bot, notifications)
+		return err
+	})
+
+	sch.Add("allowances", func(now time.Time) error {
+		notifications, err := am.PayAllowances(now)
+		notify(bot, notifications)
+		return err
+	})
+
+	sch.Add("expiry", func(now time.Time) error {
+		notifications, err := am.ExpireTasks(now)
+		notify(bot, notifications)
+		return err
+	})
+
+	sch.Add("interest", func(now time.Time) error {
+		if err := am.SnapshotBalances(now); err != nil {
+			return err
+		}
+		notifications, err := am.PayInterest(now)
+		notify(bot, notifications)
+		return err
+	})
+
+	sch.Add("competition", func(now time.Time) error {
+		notifications, err := am.FinishCompetitions(now)
+		notify(bot, notifications)
+		return err
+	})
+
+	sch.Add("digests", func(now time.Time) error {
+		notifications, err := am.SendDigests(now)
+		notify(bot, notifications)
+		return err
+	})
+
+	var lastReconcile time.Time
+	sch.Add("reconcile", func(now time.Time) error {
+		if now.Sub(lastReconcile) < time.Hour {
+			return nil
+		}
+		lastReconcile = now
+		return am.ReconcileBalances()
+	})
+
+	sch.Add("processed", func(now time.Time) error {
+		return am.CleanupProcessed(now.Add(-store.ProcessedTTL))
+	})
+
+	go sch.Run(ctx)
+}
+
+// notify sends notifications, failures are logged only
+func notify(bot *tgbotapi.BotAPI, notifications []store.Notification) {
+	for _, n := range notifications {
+		var markup interface{}
+		if len(n.Buttons) > 0 {
+			row := tgbotapi.NewInlineKeyboardRow()
+			for _, b := range n.Buttons {
+				row = append(row, tgbotapi.NewInlineKeyboardButtonData(b.Text, b.Data))
+			}
+			markup = tgbotapi.NewInlineKeyboardMarkup(row)
+		}
+
+		var msg tgbotapi.Chattable
+		if n.PhotoID != "" {
+			photo := tgbotapi.NewPhoto(n.ChatID, tgbotapi.FileID(n.PhotoID))
+			photo.Caption = n.Text
+			photo.ReplyMarkup = markup
+			msg = photo
+		} else {
+			text := tgbotapi.NewMessage(n.ChatID, n.Text)
+			text.ReplyMarkup = markup
+			msg = text
+		}
+
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("[WARN] unable to send notification to %d: %+v", n.ChatID, err)
+		}
+	}
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
 	"main/store"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //var mainKeyboard = tgbotapi.NewInlineKeyboardMarkup(
@@ -37,6 +39,24 @@ var parentKeyBoard = tgbotapi.NewReplyKeyboard(
 	tgbotapi.NewKeyboardButtonRow(
 		tgbotapi.NewKeyboardButton("Редактировать стоимость"),
 		tgbotapi.NewKeyboardButton("Подтвердить задание")),
+	tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("Выгрузить историю"),
+		tgbotapi.NewKeyboardButton("Регулярные задания")),
+	tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("Напоминания"),
+		tgbotapi.NewKeyboardButton("Бонус или штраф")),
+	tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("Магазин наград"),
+		tgbotapi.NewKeyboardButton("Карманные деньги")),
+	tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("Проценты"),
+		tgbotapi.NewKeyboardButton("Выплаты")),
+	tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("Задания детям"),
+		tgbotapi.NewKeyboardButton("Рейтинг")),
+	tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("Статистика"),
+		tgbotapi.NewKeyboardButton("Панель управления")),
 )
 
 var mainKeyboard = tgbotapi.NewReplyKeyboard(
@@ -45,13 +65,25 @@ var mainKeyboard = tgbotapi.NewReplyKeyboard(
 	),
 	tgbotapi.NewKeyboardButtonRow(
 		tgbotapi.NewKeyboardButton("Баланс динокоинов"),
-		tgbotapi.NewKeyboardButton("Завершить Текущее Задание"),
+		tgbotapi.NewKeyboardButton("Мои задания"),
 	),
 
 	tgbotapi.NewKeyboardButtonRow(
 		tgbotapi.NewKeyboardButton("История заданий"),
 		tgbotapi.NewKeyboardButton("Получить деньги"),
 	),
+	tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("Мои цели"),
+		tgbotapi.NewKeyboardButton("Магазин"),
+	),
+	tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("Доска заданий"),
+		tgbotapi.NewKeyboardButton("Рейтинг"),
+	),
+	tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("Мои награды"),
+		tgbotapi.NewKeyboardButton("Статистика"),
+	),
 )
 
 var childAdultKeyboard = tgbotapi.NewInlineKeyboardMarkup(
@@ -75,12 +107,6 @@ var tasksKeyboard = tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardButtonData("Помыть полы в квартире", store.OpWashFloorInFlat)),
 )
 
-var taskCancelationKeyboard = tgbotapi.NewInlineKeyboardMarkup(
-	tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("Отмениить текущее задание", store.OpCancelCurrentTask),
-		tgbotapi.NewInlineKeyboardButtonData("Завершить текущее задание", store.OpFinishCurrentTask),
-	))
-
 func main() {
 	bot, err := tgbotapi.NewBotAPI(os.Getenv("TELEGRAM_APITOKEN"))
 	if err != nil {
@@ -99,6 +125,9 @@ func main() {
 
 	bot.Debug = false
 
+	startScheduler(context.Background(), bot, am)
+	startHTTPServer(context.Background(), bot, am, db)
+
 	// Create a new UpdateConfig struct with an offset of 0. Offsets are used
 	// to make sure Telegram knows we've handled previous values and we don't
 	// need them repeated.
@@ -114,12 +143,56 @@ func main() {
 
 	// Loop through each update.
 	for update := range updates {
+		// Telegram may redeliver an update and users press buttons twice, handle each of them once
+		if !firstDelivery(bot, db, update) {
+			continue
+		}
+
+		if update.InlineQuery != nil {
+			handleInlineQuery(bot, db, update.InlineQuery)
+			continue
+		}
+		if q := update.CallbackQuery; q != nil && q.Message == nil {
+			handleInlineCallback(bot, am, q)
+			continue
+		}
+
+		// Family group chat has its own commands, private flows stay in private chats
+		if update.Message != nil && isGroupChat(update.Message.Chat) {
+			handleGroupMessage(bot, am, db, update.Message)
+			continue
+		}
+		if q := update.CallbackQuery; q != nil && q.Message != nil && isGroupChat(q.Message.Chat) {
+			handleGroupCallback(bot, am, q)
+			continue
+		}
+
 		// Check if we've gotten a message update.
 		if update.Message != nil {
 			// Construct a new message from the given chat ID and containing
 			// the text that we received.
 			msg := tgbotapi.NewMessage(update.Message.Chat.ID, update.Message.Text)
 
+			if len(update.Message.Photo) > 0 {
+				// the last size is the largest one
+				photo := update.Message.Photo[len(update.Message.Photo)-1]
+				notifications, err := am.SubmitPhotoProof(update.Message.From.ID, photo.FileID)
+				if err != nil {
+					log.Printf("[ERROR] unable to submit photo proof %+v", err)
+					msg.Text = "Не понятно, к какому заданию фото. Выбери задание в «Мои задания», нажми ✅ и пришли фото"
+				} else {
+					notify(bot, notifications)
+					msg.Text = "Фото отправлено родителям. Жди подтверждения"
+				}
+				send(bot, msg)
+				continue
+			}
+
+			if update.Message.IsCommand() && handleCommand(bot, am, db, update.Message, &msg) {
+				send(bot, msg)
+				continue
+			}
+
 			// Child add process
 			// TODO: add additional flat to prevent accidental input with @ prefix
 			if strings.HasPrefix(update.Message.Text, "@") {
@@ -139,15 +212,14 @@ func main() {
 			case "Зарегистрироваться":
 				msg.ReplyMarkup = childAdultKeyboard
 			case "Новое Задание":
-				hasOpenTask, err := db.HasOpenTask(update.Message.From.ID)
-				if err != nil {
-					log.Printf("Unable to find open task %+v", err)
+				tasks, err := db.OpenTasks(update.Message.From.ID)
+				settings, errSettings := am.FamilySettings(update.Message.From.ID)
+				if err != nil || errSettings != nil {
+					log.Printf("Unable to find open tasks %+v %+v", err, errSettings)
 					msg.Text = "Ошибка"
-				}
-
-				if hasOpenTask {
-					msg.Text = "У тебя есть незавершенное задание. Сначала заверши его или отмени"
-					msg.ReplyMarkup = taskCancelationKeyboard
+				} else if len(tasks) >= settings.MaxOpenTasks {
+					msg.Text = tooManyTasksText
+					msg.ReplyMarkup = openTasksKeyboard(tasks)
 				} else {
 					msg.ReplyMarkup = tasksKeyboard
 				}
@@ -155,20 +227,16 @@ func main() {
 			case "Баланс динокоинов":
 				balance, _ := db.Balance(update.Message.From.ID)
 				msg.Text = strconv.Itoa(balance) + " dinocoins"
-			case "Завершить Текущее Задание":
-				childId := update.Message.From.ID
-				childName := update.Message.From.UserName
-				op, parentChatid, err := am.SendRequestToCompleteCurrentTask(childId, childName)
+			case "Мои задания", "Завершить Текущее Задание":
+				tasks, err := db.OpenTasks(update.Message.From.ID)
 				if err != nil {
-					log.Printf("Unable to complete task %+v", err)
-					msg.Text = "Ошибка. Невозможно завершить задание"
+					log.Printf("Unable to find open tasks %+v", err)
+					msg.Text = "Ошибка"
+				} else if len(tasks) == 0 {
+					msg.Text = "У тебя нет незавершенных заданий"
 				} else {
-					msgForParent := tgbotapi.NewMessage(parentChatid,
-						"Ребенок с ником "+childName+" отправил запрос на подтверждение задания "+op)
-					if _, err = bot.Send(msgForParent); err != nil {
-						panic(err)
-					}
-					msg.Text = "Запрос отправлен родителям. Жди подтверждения"
+					msg.Text = "Выбери задание, которое нужно завершить или отменить"
+					msg.ReplyMarkup = openTasksKeyboard(tasks)
 				}
 			case "История заданий":
 				transactions, e := db.ShowLastNTransactions(update.Message.From.ID, 30)
@@ -178,7 +246,7 @@ func main() {
 				} else {
 					var str string
 					for _, t := range transactions {
-						str = strings.Join([]string{str, t.Operation, t.Timestamp.Format(store.TSNano), t.Status, strconv.Itoa(t.Cost), "\n"}, "\t")
+						str += describeTransaction(t) + "\n"
 					}
 
 					if str == "" {
@@ -186,8 +254,43 @@ func main() {
 					}
 
 					msg.Text = str
+					if kbd, ok := historyPhotoKeyboard(transactions); ok {
+						msg.ReplyMarkup = kbd
+					}
 				}
 
+			case "Мои цели":
+				msg.Text, msg.ReplyMarkup = goalsView(db, update.Message.From.ID)
+			case "Магазин":
+				msg.Text, msg.ReplyMarkup = shopView(am, update.Message.From.ID)
+			case "Статистика":
+				msg.Text = "Выбери период"
+				msg.ReplyMarkup = statsKeyboard()
+			case "Мои награды":
+				msg.Text = badgesView(am, db, update.Message.From.ID)
+			case "Рейтинг":
+				msg.Text = leaderboardView(am, update.Message.From.ID, time.Now())
+			case "Доска заданий":
+				msg.Text, msg.ReplyMarkup = boardView(am, db, update.Message.From.ID)
+			case "Получить деньги":
+				msg.Text = cashOutView(am, db, update.Message.From.ID)
+			case "Выплаты":
+				text, kbd := cashSummaryView(am, db, update.Message.From.ID)
+				msg.Text = text + "\n" + setRate(am, update.Message.From.ID, nil)
+				msg.ReplyMarkup = kbd
+			case "Проценты":
+				msg.Text = setInterest(am, update.Message.From.ID, nil)
+			case "Карманные деньги":
+				msg.Text = listAllowances(am, db, update.Message.From.ID)
+			case "Магазин наград":
+				msg.Text = listRewards(am, update.Message.From.ID)
+			case "Панель управления":
+				msg.Text = adminLinkView(am, update.Message.From.ID)
+				msg.DisableWebPagePreview = true
+			case "Редактировать стоимость":
+				msg.Text = setCost(am, update.Message.From.ID, nil)
+			case "Задания детям":
+				msg.Text = assignmentsView(am, db, update.Message.From.ID)
 			case "Добавить ребенка":
 				msg.Text = "Пришли никнейм ребенка (@test)"
 			case "Подтвердить задание":
@@ -202,6 +305,23 @@ func main() {
 
 				msg.Text = "Выбери ребенка, которому нужно подтвердить задание"
 				msg.ReplyMarkup = kbdWithChildrenList
+			case "Бонус или штраф":
+				msg.Text = adjustmentHelp
+			case "Напоминания":
+				msg.Text = setReminders(am, update.Message.From.ID, nil)
+			case "Регулярные задания":
+				msg.Text = listChores(db, update.Message.From.ID)
+			case "Выгрузить историю":
+				children, _ := db.FindChildren(update.Message.From.ID)
+				kbdWithChildrenList := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow())
+
+				for _, child := range children {
+					kbdWithChildrenList.InlineKeyboard[0] = append(kbdWithChildrenList.InlineKeyboard[0],
+						tgbotapi.NewInlineKeyboardButtonData(child, "exp"+child))
+				}
+
+				msg.Text = "Выбери ребенка, историю которого нужно выгрузить"
+				msg.ReplyMarkup = kbdWithChildrenList
 			default:
 				isRegistered, e := db.CheckRegistered(update.Message.From.ID)
 
@@ -228,9 +348,7 @@ func main() {
 			}
 
 			// Send the message.
-			if _, err = bot.Send(msg); err != nil {
-				panic(err)
-			}
+			send(bot, msg)
 		} else if update.CallbackQuery != nil {
 			msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "test")
 
@@ -238,9 +356,18 @@ func main() {
 			case store.OpNewTask:
 				msg.ReplyMarkup = tasksKeyboard
 			case store.OpWalkDog, store.OpFreeDish, store.OpDirtyDish, store.OpGoToShop, store.OpWashFloorInFlat:
-				_, e := db.CreateTransaction(update.CallbackData(), update.CallbackQuery.From.ID)
-				if e != nil {
+				_, e := am.StartTask(update.CallbackQuery.From.ID, update.CallbackData())
+				if errors.Is(e, store.ErrTaskInProgress) {
+					msg.Text = "Это задание уже начато, сначала заверши или отмени его"
+				} else if errors.Is(e, store.ErrTooManyTasks) {
+					msg.Text = tooManyTasksText
+					if tasks, err := db.OpenTasks(update.CallbackQuery.From.ID); err == nil {
+						msg.ReplyMarkup = openTasksKeyboard(tasks)
+					}
+				} else if e != nil {
 					log.Printf("Unable to create transaction %+v", e)
+				} else {
+					msg.Text = "Новое задание: " + store.OperationTitle(update.CallbackData())
 				}
 
 			case store.OpParent:
@@ -252,14 +379,14 @@ func main() {
 				}
 				e := db.RegisterUser(user)
 				if e != nil {
-					log.Println("[ERROR] %+v", e)
+					log.Printf("[ERROR] %+v", e)
 				} else {
 					msg.ReplyMarkup = parentKeyBoard
 				}
 			case store.OpChild:
 				hasParent, e := db.HasParent(update.CallbackQuery.From.UserName)
 				if e != nil {
-					log.Println("[ERROR] %+v", e)
+					log.Printf("[ERROR] %+v", e)
 				}
 				if hasParent {
 					user := store.User{
@@ -271,7 +398,7 @@ func main() {
 
 					e := db.RegisterUser(user)
 					if e != nil {
-						log.Println("[ERROR] %+v", e)
+						log.Printf("[ERROR] %+v", e)
 					} else {
 						msg.ReplyMarkup = mainKeyboard
 					}
@@ -279,44 +406,6 @@ func main() {
 					msg.Text = "Попроси сначала зарегистрироваться родителя. Отправь ему никнейм Дино @dinocoins_bot"
 				}
 
-			case store.OpCancelCurrentTask:
-				err := db.CancelCurrentTask(update.CallbackQuery.From.ID)
-				if err != nil {
-					log.Printf("[ERROR] %+v", err)
-					msg.Text = "Ошибка"
-				} else {
-					msg.Text = "Текущее задание отменено"
-				}
-
-			case store.OpFinishCurrentTask:
-				// find parent
-				// find current transaction
-				// send to parent message: I want to finish task blah-bla
-				msg.Text = "Запрос отправлен родителям. Жди подтверждения"
-				parentId, err := db.FindParentIdByChildNickName(update.CallbackQuery.From.UserName)
-				if err != nil {
-					log.Printf("[ERROR] %+v", err)
-					msg.Text = "Ошибка"
-				} else {
-					parent, err := db.FindUser(parentId)
-					if err != nil {
-						log.Printf("[ERROR] %+v", err)
-						msg.Text = "Ошибка"
-					} else {
-						t, err := db.GetCurrentTransaction(update.CallbackQuery.From.ID)
-						if err != nil {
-							log.Printf("[ERROR] %+v", err)
-							msg.Text = "Ошибка"
-						} else {
-							text := fmt.Sprintf("%s закончил задание %s. Подтвердите",
-								update.CallbackQuery.From.UserName, t.Operation)
-							msgForParent := tgbotapi.NewMessage(parent.ChatID, text)
-							if _, err := bot.Send(msgForParent); err != nil {
-								panic(err)
-							}
-						}
-					}
-				}
 			default:
 				if strings.Contains(update.CallbackData(), "cmd@") {
 					childNickName := update.CallbackData()[4:]
@@ -324,29 +413,96 @@ func main() {
 					if childUser.ID == 0 {
 						log.Printf("Unable to find a child with nickname %s %+v", childNickName, err)
 					} else {
-						err = am.ConfirmTransaction(childUser.ID)
+						tasks, err := db.OpenTasks(childUser.ID)
+						var finished []store.Transaction
+						for _, t := range tasks {
+							if t.Status == store.PendingStatus {
+								finished = append(finished, t)
+							}
+						}
 						if err != nil {
-							log.Printf("Unable to confirm transaction %+v", err)
+							log.Printf("Unable to find open tasks %+v", err)
+							msg.Text = "Ошибка"
+						} else if len(finished) == 0 {
+							msg.Text = "У @" + childNickName + " нет заданий для подтверждения"
+						} else {
+							msg.Text = "Выбери задание @" + childNickName + ", которое нужно подтвердить"
+							msg.ReplyMarkup = approvalKeyboard(finished)
 						}
 					}
+				} else if handleCallback(bot, am, update.CallbackQuery, &msg) {
+					break
 				} else {
-					log.Println("[WARN] unknown operation %s", update.CallbackData())
+					log.Printf("[WARN] unknown operation %s", update.CallbackData())
 				}
 			}
 			// Respond to the callback query, telling Telegram to show the user
 			// a message with the data received.
 			callback := tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data)
 			if _, err := bot.Request(callback); err != nil {
-				panic(err)
+				log.Printf("[WARN] unable to answer callback: %+v", err)
 			}
 
 			// And finally, send a message containing the data received.
-			if _, err := bot.Send(msg); err != nil {
-				panic(err)
+			send(bot, msg)
+		}
+	}
+
+}
+
+// firstDelivery records update and callback ids and reports if the update wasn't processed yet,
+// duplicated callbacks are answered to stop the button spinner.
+// Ids are recorded before handling, so handlers must not panic, otherwise the redelivered update is lost.
+func firstDelivery(bot *tgbotapi.BotAPI, db *store.BoltDB, update tgbotapi.Update) bool {
+	now := time.Now()
+	isNew, err := db.MarkProcessed(store.UpdateKey(update.UpdateID), now)
+	if err != nil {
+		log.Printf("[WARN] unable to mark update %d: %+v", update.UpdateID, err)
+		return true
+	}
+
+	if isNew && update.CallbackQuery != nil {
+		if isNew, err = db.MarkProcessed(store.CallbackKey(update.CallbackQuery.ID), now); err != nil {
+			log.Printf("[WARN] unable to mark callback %s: %+v", update.CallbackQuery.ID, err)
+			return true
+		}
+	}
+
+	if !isNew {
+		log.Printf("[DEBUG] duplicated update %d skipped", update.UpdateID)
+		if update.CallbackQuery != nil {
+			if _, err = bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "Уже обработано")); err != nil {
+				log.Printf("[WARN] unable to answer callback: %+v", err)
 			}
 		}
 	}
+	return isNew
+}
+
+// send delivers the reply, failures are logged as the update is already recorded as processed
+func send(bot *tgbotapi.BotAPI, msg tgbotapi.Chattable) {
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("[WARN] unable to send message: %+v", err)
+	}
+}
+
+// exportKeyboard builds period and format choice for the child history export
+func exportKeyboard(childNickName string) tgbotapi.InlineKeyboardMarkup {
+	button := func(title, period, format string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(title, "export:"+period+":"+format+":"+childNickName)
+	}
 
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			button("Неделя CSV", store.PeriodWeek, store.ExportCSV),
+			button("Неделя JSON", store.PeriodWeek, store.ExportJSON)),
+		tgbotapi.NewInlineKeyboardRow(
+			button("Месяц CSV", store.PeriodMonth, store.ExportCSV),
+			button("Месяц JSON", store.PeriodMonth, store.ExportJSON)),
+		tgbotapi.NewInlineKeyboardRow(
+			button("Все время CSV", store.PeriodAll, store.ExportCSV),
+			button("Все время JSON", store.PeriodAll, store.ExportJSON)),
+	)
 }
 
 func addCoinToString(s string) string {
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Clock provides current time, replaced by a fake one in tests
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a Clock backed by time.Now
+type SystemClock struct{}
+
+// Now returns current local time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Job is a named function called by scheduler on every tick.
+// Jobs are responsible for their own catch-up, i.e. they get current time and should
+// process everything that became due since their last persisted run.
+type Job struct {
+	Name string
+	Run  func(now time.Time) error
+}
+
+// Scheduler runs registered jobs periodically
+type Scheduler struct {
+	clock    Clock
+	interval time.Duration
+
+	lock sync.Mutex
+	jobs []Job
+}
+
+// New makes scheduler ticking with the given interval
+func New(clock Clock, interval time.Duration) *Scheduler {
+	return &Scheduler{clock: clock, interval: interval}
+}
+
+// Add registers a job
+func (s *Scheduler) Add(name string, run func(now time.Time) error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.jobs = append(s.jobs, Job{Name: name, Run: run})
+}
+
+// Tick runs all jobs once, errors are logged and don't stop other jobs
+func (s *Scheduler) Tick() {
+	s.lock.Lock()
+	jobs := make([]Job, len(s.jobs))
+	copy(jobs, s.jobs)
+	s.lock.Unlock()
+
+	now := s.clock.Now()
+	for _, job := range jobs {
+		if err := job.Run(now); err != nil {
+			log.Printf("[ERROR] job %s failed: %+v", job.Name, err)
+		}
+	}
+}
+
+// Run ticks immediately to catch up missed runs and then on every interval until context canceled
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Printf("[INFO] scheduler started, interval %v", s.interval)
+	s.Tick()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[INFO] scheduler stopped")
+			return
+		case <-ticker.C:
+			s.Tick()
+		}
+	}
+}
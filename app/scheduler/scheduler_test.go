@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func TestScheduler_Tick(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)}
+	s := New(clock, time.Minute)
+
+	var calls []time.Time
+	s.Add("failing", func(now time.Time) error { return errors.New("boom") })
+	s.Add("recording", func(now time.Time) error {
+		calls = append(calls, now)
+		return nil
+	})
+
+	s.Tick()
+	clock.now = clock.now.Add(time.Hour)
+	s.Tick()
+
+	assert.Equal(t, []time.Time{
+		time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2022, 5, 1, 11, 0, 0, 0, time.UTC),
+	}, calls)
+}
+
+func TestScheduler_Run(t *testing.T) {
+	s := New(SystemClock{}, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 10)
+	s.Add("counter", func(now time.Time) error {
+		calls <- struct{}{}
+		if len(calls) >= 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler didn't stop")
+	}
+	assert.GreaterOrEqual(t, len(calls), 3)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"main/charts"
+	"main/store"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statsKeyboard builds period choice for the statistics charts
+func statsKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Месяц", "stats:"+store.PeriodMonth),
+		tgbotapi.NewInlineKeyboardButtonData("3 месяца", "stats:"+store.PeriodQuarter),
+		tgbotapi.NewInlineKeyboardButtonData("Год", "stats:"+store.PeriodYear)))
+}
+
+// sendStatistics renders earnings, task mix and balance charts of the period and sends them as photos
+func sendStatistics(bot *tgbotapi.BotAPI, am *store.ActionManager, chatId, userId int64, period string) error {
+	s, err := am.Statistics(userId, period, time.Now())
+	if err != nil {
+		return fmt.Errorf("unable to collect statistics: %w", err)
+	}
+	if len(s.Children) == 0 {
+		return fmt.Errorf("no children of %d", userId)
+	}
+
+	dates := s.From.Format("02.01.2006") + " - " + s.To.Format("02.01.2006")
+	var legend []string
+	for i, cs := range s.Children {
+		legend = append(legend, charts.Mark(i)+" @"+cs.Child.Nickname)
+	}
+
+	earnings := make([][]int, len(s.Weeks))
+	for w := range s.Weeks {
+		for _, cs := range s.Children {
+			earnings[w] = append(earnings[w], cs.Earnings[w])
+		}
+	}
+	png, step, err := charts.Bars(earnings)
+	if err != nil {
+		return err
+	}
+	caption := fmt.Sprintf("Заработок по неделям, %s, с %s\nДеление: %d dinocoins\n%s", dates,
+		s.Weeks[0].Format("02.01"), step, strings.Join(legend, " "))
+	if err = sendChart(bot, chatId, "earnings.png", png, caption); err != nil {
+		return err
+	}
+
+	ops := taskMixOperations(s.Children)
+	mix := make([][]int, len(s.Children))
+	for i, cs := range s.Children {
+		for _, op := range ops {
+			mix[i] = append(mix[i], cs.TaskMix[op])
+		}
+	}
+	if png, step, err = charts.Stacked(mix); err != nil {
+		return err
+	}
+	var opLegend []string
+	for i, op := range ops {
+		opLegend = append(opLegend, charts.Mark(i)+" "+store.OperationTitle(op))
+	}
+	var children []string
+	for _, cs := range s.Children {
+		children = append(children, "@"+cs.Child.Nickname)
+	}
+	caption = fmt.Sprintf("Выполненные задания, %s\nСлева направо: %s\nДеление: %d заданий\n%s", dates,
+		strings.Join(children, ", "), step, strings.Join(opLegend, "\n"))
+	if err = sendChart(bot, chatId, "tasks.png", png, caption); err != nil {
+		return err
+	}
+
+	balances := make([][]int, 0, len(s.Children))
+	for _, cs := range s.Children {
+		balances = append(balances, cs.Balance)
+	}
+	if png, step, err = charts.Lines(balances); err != nil {
+		return err
+	}
+	caption = fmt.Sprintf("Баланс по дням, %s\nДеление: %d dinocoins\n%s", dates, step, strings.Join(legend, " "))
+	return sendChart(bot, chatId, "balance.png", png, caption)
+}
+
+func sendChart(bot *tgbotapi.BotAPI, chatId int64, name string, png []byte, caption string) error {
+	photo := tgbotapi.NewPhoto(chatId, tgbotapi.FileBytes{Name: name, Bytes: png})
+	photo.Caption = caption
+	if _, err := bot.Send(photo); err != nil {
+		return fmt.Errorf("unable to send chart %s: %w", name, err)
+	}
+	return nil
+}
+
+// taskMixOperations returns operations done by any of the children, most frequent first
+func taskMixOperations(children []store.ChildStats) []string {
+	total := map[string]int{}
+	for _, cs := range children {
+		for op, n := range cs.TaskMix {
+			total[op] += n
+		}
+	}
+
+	ops := make([]string, 0, len(total))
+	for op := range total {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if total[ops[i]] != total[ops[j]] {
+			return total[ops[i]] > total[ops[j]]
+		}
+		return ops[i] < ops[j]
+	})
+	return ops
+}
@@ -2,8 +2,24 @@ package store
 
 import (
 	"fmt"
+	"log"
+	"strings"
 )
 
+// Notification is a message which should be delivered to the chat
+type Notification struct {
+	ChatID  int64
+	Text    string
+	Buttons []Button // optional inline buttons
+	PhotoID string   // optional telegram file id, Text becomes photo caption
+}
+
+// Button is an inline button attached to the notification
+type Button struct {
+	Text string
+	Data string
+}
+
 type ActionManager struct {
 	db *BoltDB
 }
@@ -12,38 +28,89 @@ func NewActionManager(db *BoltDB) (*ActionManager, error) {
 	return &ActionManager{db: db}, nil
 }
 
-func (am *ActionManager) ConfirmTransaction(childId int64) error {
-	curTransaction, err := am.db.GetCurrentTransaction(childId)
+// withGoalProgress appends goal milestone notifications, failures are logged only as balance already changed
+func (am *ActionManager) withGoalProgress(notifications []Notification, childId int64) []Notification {
+	progress, err := am.GoalProgressNotifications(childId)
 	if err != nil {
-		return fmt.Errorf("unable to find current transaction: %w", err)
+		log.Printf("[WARN] unable to check goals of %d: %+v", childId, err)
 	}
-	err = am.db.UpdateTransactionStatus(curTransaction, CompletedStatus, childId)
+	return append(notifications, progress...)
+}
+
+// findOwnChild returns child user if child with the nickname (@nick) is bound to the parent
+func (am *ActionManager) findOwnChild(parentId int64, childNickName string) (User, error) {
+	children, err := am.db.FindChildren(parentId)
 	if err != nil {
-		return fmt.Errorf("unable to change transaction status %w", err)
+		return User{}, fmt.Errorf("unable to find children: %w", err)
 	}
-	_, err = am.db.ChangeBalance(childId, curTransaction.Cost)
-	if err != nil {
-		return fmt.Errorf("unable to change balance %w", err)
+
+	for _, child := range children {
+		if child != childNickName {
+			continue
+		}
+
+		childUser, err := am.db.FindUserByNickname(strings.TrimPrefix(childNickName, "@"))
+		if err != nil {
+			return User{}, fmt.Errorf("unable to find child %s: %w", childNickName, err)
+		}
+		if childUser.ID == 0 {
+			return User{}, fmt.Errorf("child %s is not registered", childNickName)
+		}
+
+		return childUser, nil
 	}
 
-	return nil
+	return User{}, fmt.Errorf("child %s is not bound to parent %d", childNickName, parentId)
 }
 
-func (am *ActionManager) SendRequestToCompleteCurrentTask(childId int64, childName string) (string, int64, error) {
-	curTrans, err := am.db.GetCurrentTransaction(childId)
+// findOwnChildById returns child user if the child is bound to the parent
+func (am *ActionManager) findOwnChildById(parentId, childId int64) (User, error) {
+	child, err := am.db.FindUser(childId)
 	if err != nil {
-		return "", -1, fmt.Errorf("unable to find current transaction %w", err)
+		return User{}, fmt.Errorf("unable to find child %d: %w", childId, err)
 	}
 
-	parentId, err := am.db.FindParentIdByChildNickName(childName)
+	return am.findOwnChild(parentId, "@"+child.Nickname)
+}
+
+// notifyParents builds the same notification for all parents of the child
+func (am *ActionManager) notifyParents(child User, text string, buttons ...Button) ([]Notification, error) {
+	return am.notifyParentsWithPhoto(child, text, "", buttons...)
+}
+
+// notifyParentsWithPhoto builds notifications with the photo for all parents of the child
+func (am *ActionManager) notifyParentsWithPhoto(child User, text, photoId string, buttons ...Button) ([]Notification, error) {
+	parentIds, err := am.db.FindParentIdsByChildNickName(child.Nickname)
 	if err != nil {
-		return "", -1, fmt.Errorf("unable to find parent by child name @%s %w", childName, err)
+		return nil, fmt.Errorf("unable to find parents of %s: %w", child.Nickname, err)
+	}
+
+	notifications := make([]Notification, 0, len(parentIds))
+	for _, parentId := range parentIds {
+		parent, err := am.db.FindUser(parentId)
+		if err != nil {
+			log.Printf("[WARN] unable to find parent %d: %+v", parentId, err)
+			continue
+		}
+		notifications = append(notifications, Notification{ChatID: parent.ChatID, Text: text, Buttons: buttons,
+			PhotoID: photoId})
 	}
 
-	parUser, err := am.db.FindUser(parentId)
+	if len(notifications) == 0 {
+		return nil, fmt.Errorf("no registered parents of %s", child.Nickname)
+	}
+	return notifications, nil
+}
+
+// familyOfParent returns family of the user, the user must be a parent
+func (am *ActionManager) familyOfParent(userId int64) (int64, error) {
+	user, err := am.db.FindUser(userId)
 	if err != nil {
-		return "", -1, fmt.Errorf("unable to find parent user %w", err)
+		return 0, fmt.Errorf("unable to find user %d: %w", userId, err)
+	}
+	if user.Type != PARENT {
+		return 0, fmt.Errorf("user %d is not a parent", userId)
 	}
 
-	return curTrans.Operation, parUser.ChatID, nil
+	return am.FamilyID(userId)
 }
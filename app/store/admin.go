@@ -0,0 +1,177 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"time"
+)
+
+// LoginTokenTTL is how long the one-time login link of the admin panel is valid
+const LoginTokenTTL = 15 * time.Minute
+
+// loginToken is a one-time admin panel login of the parent
+type loginToken struct {
+	ParentID int64     `json:"parent_id"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Pending is everything waiting for parent's decision
+type Pending struct {
+	Tasks       []Transaction
+	Purchases   []Purchase
+	Withdrawals []Withdrawal
+}
+
+// SaveLoginToken stores one-time login token, tokens expired by now are dropped on the way
+func (b *BoltDB) SaveLoginToken(token string, parentId int64, expires, now time.Time) error {
+	buf, err := json.Marshal(loginToken{ParentID: parentId, Expires: expires})
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(loginTokensBucketName))
+		err := deleteWhere(bkt, func(_, v []byte) bool {
+			var t loginToken
+			return json.Unmarshal(v, &t) != nil || !t.Expires.After(now)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete expired login tokens: %w", err)
+		}
+		return bkt.Put([]byte(token), buf)
+	})
+}
+
+// RedeemLoginToken returns parent of the token and removes it, so the token works once
+func (b *BoltDB) RedeemLoginToken(token string, now time.Time) (parentId int64, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(loginTokensBucketName))
+		v := bkt.Get([]byte(token))
+		if v == nil {
+			return fmt.Errorf("login token not found")
+		}
+		if err := bkt.Delete([]byte(token)); err != nil {
+			return err
+		}
+
+		var t loginToken
+		if err := json.Unmarshal(v, &t); err != nil {
+			return fmt.Errorf("failed to unmarshal: %w", err)
+		}
+		if !t.Expires.After(now) {
+			return fmt.Errorf("login token expired at %s", t.Expires.Format(time.RFC3339))
+		}
+		parentId = t.ParentID
+		return nil
+	})
+
+	return parentId, err
+}
+
+// IssueLoginToken makes one-time admin panel login token of the parent
+func (am *ActionManager) IssueLoginToken(parentId int64, now time.Time) (string, error) {
+	if _, err := am.familyOfParent(parentId); err != nil {
+		return "", err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := am.db.SaveLoginToken(token, parentId, now.Add(LoginTokenTTL), now); err != nil {
+		return "", fmt.Errorf("unable to save login token: %w", err)
+	}
+	return token, nil
+}
+
+// RedeemLoginToken checks one-time login token and returns the parent it was issued to
+func (am *ActionManager) RedeemLoginToken(token string, now time.Time) (User, error) {
+	parentId, err := am.db.RedeemLoginToken(token, now)
+	if err != nil {
+		return User{}, err
+	}
+	if _, err = am.familyOfParent(parentId); err != nil {
+		return User{}, err
+	}
+	return am.db.FindUser(parentId)
+}
+
+// OwnChildren returns registered children bound to the parent
+func (am *ActionManager) OwnChildren(parentId int64) ([]User, error) {
+	nicks, err := am.db.FindChildren(parentId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find children of %d: %w", parentId, err)
+	}
+
+	var children []User
+	for _, nick := range nicks {
+		child, err := am.findOwnChild(parentId, nick)
+		if err != nil {
+			log.Printf("[WARN] skip child %s of %d: %+v", nick, parentId, err)
+			continue
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// Pending returns tasks, purchases and withdrawals of parent's family waiting for decision
+func (am *ActionManager) Pending(parentId int64) (Pending, error) {
+	var p Pending
+
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return p, err
+	}
+
+	children, err := am.OwnChildren(parentId)
+	if err != nil {
+		return p, err
+	}
+	for _, child := range children {
+		tasks, err := am.db.OpenTasks(child.ID)
+		if err != nil {
+			return p, fmt.Errorf("unable to load open tasks of %d: %w", child.ID, err)
+		}
+		for _, t := range tasks {
+			if t.Status == PendingStatus {
+				p.Tasks = append(p.Tasks, t)
+			}
+		}
+	}
+
+	purchases, err := am.db.Purchases(familyId)
+	if err != nil {
+		return p, fmt.Errorf("unable to load purchases: %w", err)
+	}
+	for _, pr := range purchases {
+		if pr.Status == PurchasePendingStatus {
+			p.Purchases = append(p.Purchases, pr)
+		}
+	}
+
+	withdrawals, err := am.db.Withdrawals(familyId)
+	if err != nil {
+		return p, fmt.Errorf("unable to load withdrawals: %w", err)
+	}
+	for _, w := range withdrawals {
+		if w.Status == WithdrawalPendingStatus {
+			p.Withdrawals = append(p.Withdrawals, w)
+		}
+	}
+	return p, nil
+}
+
+// randomToken returns 48 hex symbols secret
+func randomToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("unable to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestActionManager_LoginToken(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	_, err = am.IssueLoginToken(2, time.Now())
+	assert.Error(t, err, "children have no admin panel")
+
+	now := time.Now()
+	token, err := am.IssueLoginToken(1, now)
+	require.NoError(t, err)
+	assert.Len(t, token, 48)
+
+	user, err := am.RedeemLoginToken(token, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), user.ID)
+	_, err = am.RedeemLoginToken(token, now.Add(time.Minute))
+	assert.Error(t, err, "token works once")
+
+	token, err = am.IssueLoginToken(1, now)
+	require.NoError(t, err)
+	_, err = am.RedeemLoginToken(token, now.Add(LoginTokenTTL))
+	assert.Error(t, err, "token expired")
+}
+
+func TestBoltDB_SaveLoginToken(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	for _, token := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, db.SaveLoginToken(token, 1, now.Add(time.Minute), now))
+	}
+	require.NoError(t, db.SaveLoginToken("e", 1, now.Add(time.Hour), now.Add(time.Minute)))
+
+	for _, token := range []string{"a", "b", "c", "d"} {
+		_, err := db.RedeemLoginToken(token, now)
+		assert.Error(t, err, "expired token %s is dropped", token)
+	}
+	parentId, err := db.RedeemLoginToken("e", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), parentId)
+}
+
+func TestActionManager_Pending(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	require.NoError(t, am.SetOperationCost(1, OpWalkDog, 25))
+	assert.Error(t, am.SetOperationCost(1, "unknown", 25))
+	assert.Error(t, am.SetOperationCost(1, OpWalkDog, 0))
+	cost, err := am.OperationCost(2, OpWalkDog)
+	require.NoError(t, err)
+	assert.Equal(t, 25, cost, "family cost")
+	cost, err = am.OperationCost(2, OpFreeDish)
+	require.NoError(t, err)
+	assert.Equal(t, defaultFreeDish, cost, "default cost")
+
+	walk, err := am.StartTask(2, OpWalkDog)
+	require.NoError(t, err)
+	assert.Equal(t, 25, walk.Cost)
+	_, err = am.RequestTaskCompletion(2, walk.ID)
+	require.NoError(t, err)
+	_, err = am.StartTask(2, OpFreeDish)
+	require.NoError(t, err)
+
+	_, err = am.AddReward(1, []string{"10", "мультики"})
+	require.NoError(t, err)
+	require.NoError(t, am.SetRate(1, 100, 1))
+	_, err = db.PostTransaction(Transaction{Operation: KindBonus, Kind: KindBonus, Cost: 50, UserId: 2})
+	require.NoError(t, err)
+	_, err = am.RequestPurchase(2, "1")
+	require.NoError(t, err)
+	_, err = am.RequestWithdrawal(2, 5)
+	require.NoError(t, err)
+
+	_, err = am.Pending(2)
+	assert.Error(t, err)
+	pending, err := am.Pending(1)
+	require.NoError(t, err)
+	require.Len(t, pending.Tasks, 1, "open tasks are not pending")
+	assert.Equal(t, walk.ID, pending.Tasks[0].ID)
+	assert.Len(t, pending.Purchases, 1)
+	assert.Len(t, pending.Withdrawals, 1)
+}
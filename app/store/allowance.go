@@ -0,0 +1,176 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const KindAllowance = "allowance" // weekly allowance transaction
+
+// Allowance is a weekly amount credited to the child automatically
+type Allowance struct {
+	ChildID  int64        `json:"child_id"`
+	FamilyID int64        `json:"family_id"`
+	Amount   int          `json:"amount"`
+	Weekday  time.Weekday `json:"weekday"`
+	Hour     int          `json:"hour"`
+	Minute   int          `json:"minute"`
+	Created  time.Time    `json:"created"`
+}
+
+// scheduledAt returns payment time in the week of t
+func (a Allowance) scheduledAt(t time.Time) time.Time {
+	return weeklyAt(t, a.Weekday, a.Hour, a.Minute)
+}
+
+// weeklyAt returns time of the week day in the week of t
+func weeklyAt(t time.Time, day time.Weekday, hour, minute int) time.Time {
+	d := WeekStart(t).AddDate(0, 0, (int(day)+6)%7)
+	return time.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, 0, t.Location())
+}
+
+// periodKey returns ISO week of t, e.g. 2022-W18
+func periodKey(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// SaveAllowance creates or replaces child's allowance
+func (b *BoltDB) SaveAllowance(a Allowance) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		buf, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(allowancesBucketName)).Put(itob64(a.ChildID), buf)
+	})
+}
+
+// DeleteAllowance stops child's allowance
+func (b *BoltDB) DeleteAllowance(childId int64) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(allowancesBucketName)).Delete(itob64(childId))
+	})
+}
+
+// Allowances returns all allowances, filtered by family if familyId is not 0
+func (b *BoltDB) Allowances(familyId int64) (allowances []Allowance, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(allowancesBucketName)).ForEach(func(k, v []byte) error {
+			var a Allowance
+			if err := json.Unmarshal(v, &a); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if familyId == 0 || a.FamilyID == familyId {
+				allowances = append(allowances, a)
+			}
+			return nil
+		})
+	})
+
+	return allowances, err
+}
+
+// PostPeriodicTransaction posts transaction once per period, key identifies job, subject and period.
+// Returns false if the transaction for the key was posted before.
+func (b *BoltDB) PostPeriodicTransaction(key string, t Transaction) (posted bool, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(periodicRunsBucketName))
+		if bkt.Get([]byte(key)) != nil {
+			return nil
+		}
+
+		stored, err := postTransaction(tx, t)
+		if err != nil {
+			return err
+		}
+
+		posted = true
+		return bkt.Put([]byte(key), []byte(stored.ID))
+	})
+
+	return posted, err
+}
+
+// SetAllowance configures weekly allowance of the parent's child, args are amount, week day and time.
+// Zero amount stops the allowance.
+func (am *ActionManager) SetAllowance(parentId int64, childNickName string, args []string) (Allowance, error) {
+	child, err := am.findOwnChild(parentId, childNickName)
+	if err != nil {
+		return Allowance{}, err
+	}
+
+	if len(args) == 1 && args[0] == "0" {
+		return Allowance{}, am.db.DeleteAllowance(child.ID)
+	}
+
+	if len(args) != 3 {
+		return Allowance{}, fmt.Errorf("amount, week day and time are required")
+	}
+
+	a := Allowance{ChildID: child.ID, Created: time.Now()}
+	if a.Amount, err = strconv.Atoi(args[0]); err != nil || a.Amount <= 0 {
+		return Allowance{}, fmt.Errorf("invalid amount %s", args[0])
+	}
+
+	day, ok := weekdayNames[strings.ToLower(args[1])]
+	if !ok {
+		return Allowance{}, fmt.Errorf("unknown week day %s", args[1])
+	}
+	a.Weekday = day
+
+	if a.Hour, a.Minute, err = parseClock(args[2]); err != nil {
+		return Allowance{}, err
+	}
+
+	if a.FamilyID, err = am.FamilyID(child.ID); err != nil {
+		return Allowance{}, err
+	}
+
+	return a, am.db.SaveAllowance(a)
+}
+
+// PayAllowances credits allowances scheduled in the current week, each allowance is paid once per week.
+// Payment of the previous week missed while the bot was down is made up as well.
+func (am *ActionManager) PayAllowances(now time.Time) ([]Notification, error) {
+	allowances, err := am.db.Allowances(0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load allowances: %w", err)
+	}
+
+	var notifications []Notification
+	for _, a := range allowances {
+		for _, scheduled := range []time.Time{a.scheduledAt(now.AddDate(0, 0, -7)), a.scheduledAt(now)} {
+			if now.Before(scheduled) || !scheduled.After(a.Created) {
+				continue
+			}
+
+			period := periodKey(scheduled)
+			key := fmt.Sprintf("%s:%d:%s", KindAllowance, a.ChildID, period)
+			posted, err := am.db.PostPeriodicTransaction(key, Transaction{Operation: KindAllowance, Kind: KindAllowance,
+				Cost: a.Amount, UserId: a.ChildID, Reason: "Карманные деньги " + period, Ref: period})
+			if err != nil {
+				return notifications, fmt.Errorf("unable to pay allowance of %d: %w", a.ChildID, err)
+			}
+			if !posted {
+				continue
+			}
+
+			child, err := am.db.FindUser(a.ChildID)
+			if err != nil {
+				log.Printf("[WARN] unable to find child %d: %+v", a.ChildID, err)
+				continue
+			}
+			notifications = append(notifications, Notification{ChatID: child.ChatID,
+				Text: fmt.Sprintf("Карманные деньги: +%d dinocoins", a.Amount)})
+			notifications = am.withGoalProgress(notifications, a.ChildID)
+		}
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestActionManager_PayAllowances(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	_, err = am.SetAllowance(1, "@kid", []string{"50", "someday", "10:00"})
+	assert.Error(t, err)
+	_, err = am.SetAllowance(2, "@kid", []string{"50", "sun", "10:00"})
+	assert.Error(t, err, "only parent can set allowance")
+
+	a, err := am.SetAllowance(1, "@kid", []string{"50", "sun", "10:00"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), a.FamilyID)
+	a.Created = time.Date(2022, 5, 2, 12, 0, 0, 0, time.Local) // monday
+	require.NoError(t, db.SaveAllowance(a))
+
+	notifications, err := am.PayAllowances(time.Date(2022, 5, 8, 9, 0, 0, 0, time.Local))
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "not scheduled yet")
+
+	notifications, err = am.PayAllowances(time.Date(2022, 5, 8, 10, 1, 0, 0, time.Local))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(200), notifications[0].ChatID)
+
+	// restart in the same week doesn't pay twice
+	notifications, err = am.PayAllowances(time.Date(2022, 5, 8, 22, 0, 0, 0, time.Local))
+	require.NoError(t, err)
+	assert.Empty(t, notifications)
+
+	_, err = am.PayAllowances(time.Date(2022, 5, 15, 11, 0, 0, 0, time.Local))
+	require.NoError(t, err)
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 100, balance)
+
+	transactions, err := db.ShowLastNTransactions(2, 10)
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, KindAllowance, transactions[0].Kind)
+	assert.Equal(t, "2022-W19", transactions[0].Ref)
+
+	_, err = am.SetAllowance(1, "@kid", []string{"0"})
+	require.NoError(t, err)
+	allowances, err := db.Allowances(0)
+	require.NoError(t, err)
+	assert.Empty(t, allowances)
+}
+
+func TestActionManager_PayAllowancesAfterDowntime(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	a, err := am.SetAllowance(1, "@kid", []string{"50", "sun", "10:00"})
+	require.NoError(t, err)
+	a.Created = time.Date(2022, 5, 9, 12, 0, 0, 0, time.Local) // monday
+	require.NoError(t, db.SaveAllowance(a))
+
+	// the bot was down over the whole sunday and starts next monday
+	notifications, err := am.PayAllowances(time.Date(2022, 5, 16, 9, 0, 0, 0, time.Local))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1, "missed payment is made up")
+
+	notifications, err = am.PayAllowances(time.Date(2022, 5, 22, 10, 1, 0, 0, time.Local))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1, "payment of the previous week is not repeated")
+
+	transactions, err := db.ShowLastNTransactions(2, 10)
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "2022-W20", transactions[0].Ref)
+	assert.Equal(t, "2022-W19", transactions[1].Ref)
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// APIToken gives external integration access to the family on behalf of the parent who issued it.
+// Only hash of the token is stored, the token itself is shown to the parent once.
+type APIToken struct {
+	ID       string    `json:"id"` // first symbols of the token hash, used to revoke it
+	FamilyID int64     `json:"family_id"`
+	ParentID int64     `json:"parent_id"`
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveAPIToken stores api token by the hash of its secret
+func (b *BoltDB) SaveAPIToken(hash string, t APIToken) error {
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(apiTokensBucketName)).Put([]byte(hash), buf)
+	})
+}
+
+// APIToken returns api token by the hash of its secret
+func (b *BoltDB) APIToken(hash string) (t APIToken, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(apiTokensBucketName)).Get([]byte(hash))
+		if v == nil {
+			return fmt.Errorf("api token not found")
+		}
+		return json.Unmarshal(v, &t)
+	})
+
+	return t, err
+}
+
+// APITokens returns api tokens of the family, oldest first
+func (b *BoltDB) APITokens(familyId int64) (tokens []APIToken, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(apiTokensBucketName)).ForEach(func(k, v []byte) error {
+			var t APIToken
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if t.FamilyID == familyId {
+				tokens = append(tokens, t)
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+	return tokens, err
+}
+
+// DeleteAPIToken removes api token of the family
+func (b *BoltDB) DeleteAPIToken(familyId int64, id string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		c := tx.Bucket([]byte(apiTokensBucketName)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var t APIToken
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if t.FamilyID == familyId && t.ID == id {
+				return c.Delete()
+			}
+		}
+		return fmt.Errorf("api token %s not found", id)
+	})
+}
+
+// IssueAPIToken makes api token of parent's family, the secret is returned once and never stored
+func (am *ActionManager) IssueAPIToken(parentId int64, name string, now time.Time) (string, APIToken, error) {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return "", APIToken{}, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return "", APIToken{}, err
+	}
+
+	hash := hashToken(token)
+	t := APIToken{ID: hash[:8], FamilyID: familyId, ParentID: parentId, Name: strings.TrimSpace(name), Created: now}
+	if err = am.db.SaveAPIToken(hash, t); err != nil {
+		return "", APIToken{}, fmt.Errorf("unable to save api token: %w", err)
+	}
+	return token, t, nil
+}
+
+// APITokens returns api tokens of parent's family
+func (am *ActionManager) APITokens(parentId int64) ([]APIToken, error) {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return nil, err
+	}
+	return am.db.APITokens(familyId)
+}
+
+// RevokeAPIToken removes api token of parent's family
+func (am *ActionManager) RevokeAPIToken(parentId int64, id string) error {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return err
+	}
+	return am.db.DeleteAPIToken(familyId, id)
+}
+
+// AuthorizeAPIToken returns parent the api requests act on behalf of.
+// Token stops working once its parent leaves the family.
+func (am *ActionManager) AuthorizeAPIToken(token string) (User, error) {
+	t, err := am.db.APIToken(hashToken(token))
+	if err != nil {
+		return User{}, err
+	}
+
+	familyId, err := am.familyOfParent(t.ParentID)
+	if err != nil {
+		return User{}, err
+	}
+	if familyId != t.FamilyID {
+		return User{}, fmt.Errorf("parent %d left family %d of api token %s", t.ParentID, t.FamilyID, t.ID)
+	}
+	return am.db.FindUser(t.ParentID)
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestActionManager_APIToken(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "other", Type: PARENT}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	_, _, err = am.IssueAPIToken(2, "dashboard", time.Now())
+	assert.Error(t, err, "children have no api tokens")
+
+	secret, token, err := am.IssueAPIToken(1, " dashboard ", time.Now())
+	require.NoError(t, err)
+	assert.Len(t, secret, 48)
+	assert.Equal(t, "dashboard", token.Name)
+	assert.Equal(t, int64(1), token.FamilyID)
+	_, _, err = am.IssueAPIToken(1, "script", time.Now().Add(time.Second))
+	require.NoError(t, err)
+
+	parent, err := am.AuthorizeAPIToken(secret)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), parent.ID)
+	_, err = am.AuthorizeAPIToken("unknown")
+	assert.Error(t, err)
+
+	tokens, err := am.APITokens(1)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, token.ID, tokens[0].ID)
+	tokens, err = am.APITokens(3)
+	require.NoError(t, err)
+	assert.Empty(t, tokens, "tokens of other family are hidden")
+
+	assert.Error(t, am.RevokeAPIToken(3, token.ID), "other family can't revoke")
+	require.NoError(t, am.RevokeAPIToken(1, token.ID))
+	_, err = am.AuthorizeAPIToken(secret)
+	assert.Error(t, err, "revoked token")
+}
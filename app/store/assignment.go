@@ -0,0 +1,241 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Assignment is a task parent gives to the child
+type Assignment struct {
+	ChildNickName string
+	Operation     string
+	Reward        int       // 0 means operation cost
+	Penalty       int       // charged if the task expires, 0 if none
+	Deadline      time.Time // zero if the task never expires
+}
+
+// ParseAssignment parses task assignment like "@nick walk_dog [reward] [DD.MM.YYYY] [HH:MM] [penalty=N]".
+// Without reward the operation cost is used, date without time means the end of the day,
+// time without date means today, or tomorrow if the time already passed.
+func ParseAssignment(args []string, now time.Time) (a Assignment, err error) {
+	if len(args) < 2 {
+		return a, fmt.Errorf("child and task are required")
+	}
+	a.ChildNickName, a.Operation = args[0], args[1]
+
+	var date time.Time
+	hour, minute := -1, 0
+	for _, arg := range args[2:] {
+		if strings.HasPrefix(arg, "penalty=") {
+			if a.Penalty, err = strconv.Atoi(strings.TrimPrefix(arg, "penalty=")); err != nil || a.Penalty < 0 {
+				return a, fmt.Errorf("invalid penalty %s", arg)
+			}
+			continue
+		}
+		if n, e := strconv.Atoi(arg); e == nil && a.Reward == 0 && date.IsZero() && hour < 0 {
+			if n <= 0 {
+				return a, fmt.Errorf("reward must be positive")
+			}
+			a.Reward = n
+			continue
+		}
+		if d, e := time.ParseInLocation("02.01.2006", arg, now.Location()); e == nil && date.IsZero() {
+			date = d
+			continue
+		}
+		if h, m, e := parseClock(arg); e == nil && hour < 0 {
+			hour, minute = h, m
+			continue
+		}
+		return a, fmt.Errorf("unexpected argument %s", arg)
+	}
+
+	switch {
+	case !date.IsZero() && hour >= 0:
+		a.Deadline = time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, now.Location())
+	case !date.IsZero():
+		a.Deadline = time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 0, 0, now.Location())
+	case hour >= 0:
+		a.Deadline = time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+		if !a.Deadline.After(now) {
+			a.Deadline = a.Deadline.AddDate(0, 0, 1)
+		}
+	}
+
+	return a, a.validate(now)
+}
+
+// validate checks assignment made in chat or by api before the task is created
+func (a Assignment) validate(now time.Time) error {
+	if a.ChildNickName == "" || a.Operation == "" {
+		return fmt.Errorf("child and task are required")
+	}
+	if strings.ContainsAny(a.Operation, " \t\n") {
+		return fmt.Errorf("operation should be a single word")
+	}
+	if a.Reward < 0 || a.Penalty < 0 {
+		return fmt.Errorf("reward and penalty can't be negative")
+	}
+	if !a.Deadline.IsZero() && !a.Deadline.After(now) {
+		return fmt.Errorf("deadline %s already passed", a.Deadline.Format("02.01.2006 15:04"))
+	}
+	if a.Penalty > 0 && a.Deadline.IsZero() {
+		return fmt.Errorf("penalty requires a deadline")
+	}
+	return nil
+}
+
+// AssignTask parses assignment from /assign arguments and gives it to the child, see Assign
+func (am *ActionManager) AssignTask(parentId int64, args []string, now time.Time) (Transaction, []Notification, error) {
+	a, err := ParseAssignment(args, now)
+	if err != nil {
+		return Transaction{}, nil, err
+	}
+	return am.Assign(parentId, a, now)
+}
+
+// Assign creates open task for parent's child and asks the child to accept it.
+// Unknown operations are allowed with an explicit reward, operation is used as the task name then.
+func (am *ActionManager) Assign(parentId int64, a Assignment, now time.Time) (Transaction, []Notification, error) {
+	if err := a.validate(now); err != nil {
+		return Transaction{}, nil, err
+	}
+
+	child, err := am.findOwnChild(parentId, a.ChildNickName)
+	if err != nil {
+		return Transaction{}, nil, err
+	}
+
+	if a.Reward == 0 {
+		if a.Reward, err = am.OperationCost(parentId, a.Operation); err != nil {
+			return Transaction{}, nil, fmt.Errorf("reward is required for custom task %s: %w", a.Operation, err)
+		}
+	}
+
+	t, err := am.db.CreateTask(Transaction{Operation: a.Operation, Cost: a.Reward, UserId: child.ID,
+		AssignedBy: parentId, Deadline: a.Deadline, ExpiryPenalty: a.Penalty})
+	if err != nil {
+		return Transaction{}, nil, fmt.Errorf("unable to create task: %w", err)
+	}
+
+	text := fmt.Sprintf("Родители дали тебе задание %s, награда %d dinocoins", OperationTitle(t.Operation), t.Cost)
+	if !t.Deadline.IsZero() {
+		text += ", сделать до " + t.Deadline.Format("02.01.2006 15:04")
+	}
+	if t.ExpiryPenalty > 0 {
+		text += fmt.Sprintf(", иначе штраф %d", t.ExpiryPenalty)
+	}
+	return t, []Notification{{ChatID: child.ChatID, Text: text, Buttons: []Button{
+		{Text: "Принять", Data: "asgok:" + t.ID}, {Text: "Отказаться", Data: "asgno:" + t.ID}}}}, nil
+}
+
+// RespondAssignment accepts or declines task assigned to the child, declined task is closed.
+// Returns notification for the parent who assigned the task.
+func (am *ActionManager) RespondAssignment(childId int64, txId string, accept bool) ([]Notification, error) {
+	t, err := am.db.RespondAssignment(childId, txId, accept)
+	if err != nil {
+		return nil, fmt.Errorf("unable to respond to assignment: %w", err)
+	}
+
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find child: %w", err)
+	}
+	parent, err := am.db.FindUser(t.AssignedBy)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find parent: %w", err)
+	}
+
+	verb := "принял"
+	if !accept {
+		verb = "отказался от"
+	}
+	return []Notification{{ChatID: parent.ChatID,
+		Text: fmt.Sprintf("@%s %s задание %s", child.Nickname, verb, OperationTitle(t.Operation))}}, nil
+}
+
+// RespondAssignment records child's answer to the assigned task
+func (b *BoltDB) RespondAssignment(childId int64, txId string, accept bool) (t Transaction, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if t, err = activeTask(tx, childId, txId); err != nil {
+			return err
+		}
+		if t.AssignedBy == 0 {
+			return fmt.Errorf("task %s was not assigned by parent", txId)
+		}
+		if !t.AcceptedAt.IsZero() {
+			return fmt.Errorf("task %s is already accepted", txId)
+		}
+
+		if accept {
+			t.AcceptedAt = time.Now()
+		} else {
+			t.Status = DeclinedStatus
+		}
+		return saveTransaction(tx, t)
+	})
+
+	return t, err
+}
+
+// Assignments returns tasks assigned by the parent created since the given time, newest first
+func (am *ActionManager) Assignments(parentId int64, since time.Time) ([]Transaction, error) {
+	children, err := am.db.FindChildren(parentId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find children: %w", err)
+	}
+
+	var assignments []Transaction
+	for _, nick := range children {
+		child, err := am.db.FindUserByNickname(strings.TrimPrefix(nick, "@"))
+		if err != nil || child.ID == 0 {
+			continue
+		}
+
+		transactions, err := am.db.assignedTasks(child.ID, parentId, since)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load tasks of %s: %w", nick, err)
+		}
+		assignments = append(assignments, transactions...)
+	}
+
+	sort.Slice(assignments, func(i, j int) bool {
+		if !assignments[i].Timestamp.Equal(assignments[j].Timestamp) {
+			return assignments[i].Timestamp.After(assignments[j].Timestamp)
+		}
+		return lessID(assignments[j].ID, assignments[i].ID)
+	})
+	return assignments, nil
+}
+
+// assignedTasks returns tasks of the child assigned by the parent since the given time
+func (b *BoltDB) assignedTasks(childId, parentId int64, since time.Time) (tasks []Transaction, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		userBkt := tx.Bucket(itob64(childId))
+		if userBkt == nil {
+			return nil
+		}
+
+		c := userBkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var t Transaction
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if t.Timestamp.Before(since) {
+				break
+			}
+			if t.AssignedBy == parentId {
+				tasks = append(tasks, t)
+			}
+		}
+		return nil
+	})
+
+	return tasks, err
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseAssignment(t *testing.T) {
+	now := time.Date(2022, 5, 2, 12, 0, 0, 0, time.UTC)
+
+	a, err := ParseAssignment([]string{"@kid", OpWalkDog}, now)
+	require.NoError(t, err)
+	assert.Equal(t, Assignment{ChildNickName: "@kid", Operation: OpWalkDog}, a)
+
+	a, err = ParseAssignment([]string{"@kid", OpWalkDog, "15", "03.05.2022", "penalty=5"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, 15, a.Reward)
+	assert.Equal(t, 5, a.Penalty)
+	assert.Equal(t, time.Date(2022, 5, 3, 23, 59, 0, 0, time.UTC), a.Deadline)
+
+	a, err = ParseAssignment([]string{"@kid", OpWalkDog, "10:00"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 5, 3, 10, 0, 0, 0, time.UTC), a.Deadline, "passed time means tomorrow")
+
+	a, err = ParseAssignment([]string{"@kid", OpWalkDog, "03.05.2022", "18:30"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 5, 3, 18, 30, 0, 0, time.UTC), a.Deadline)
+
+	_, err = ParseAssignment([]string{"@kid", OpWalkDog, "01.05.2022"}, now)
+	assert.Error(t, err, "deadline in the past")
+	_, err = ParseAssignment([]string{"@kid", OpWalkDog, "-5"}, now)
+	assert.Error(t, err)
+	_, err = ParseAssignment([]string{"@kid", OpWalkDog, "penalty=5"}, now)
+	assert.Error(t, err, "penalty without deadline")
+	_, err = ParseAssignment([]string{"@kid"}, now)
+	assert.Error(t, err)
+}
+
+func TestActionManager_AssignTask(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "stranger", Type: PARENT}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	now := time.Now()
+	_, _, err = am.AssignTask(3, []string{"@kid", OpWalkDog}, now)
+	assert.Error(t, err, "not own child")
+	_, _, err = am.AssignTask(1, []string{"@kid", "clean_room"}, now)
+	assert.Error(t, err, "custom task needs a reward")
+	_, _, err = am.Assign(1, Assignment{ChildNickName: "@kid", Operation: "clean room", Reward: 10}, now)
+	assert.Error(t, err, "operation is a single word")
+	_, _, err = am.Assign(1, Assignment{ChildNickName: "@kid", Operation: OpWalkDog, Penalty: 5}, now)
+	assert.Error(t, err, "penalty requires a deadline")
+
+	walk, notifications, err := am.AssignTask(1, []string{"@kid", OpWalkDog, "25"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, 25, walk.Cost)
+	assert.Equal(t, OpenStatus, walk.Status)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(200), notifications[0].ChatID)
+	assert.Equal(t, "asgok:"+walk.ID, notifications[0].Buttons[0].Data)
+
+	room, _, err := am.AssignTask(1, []string{"@kid", "clean_room", "40"}, now)
+	require.NoError(t, err)
+
+	notifications, err = am.RespondAssignment(2, walk.ID, true)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(100), notifications[0].ChatID)
+	_, err = am.RespondAssignment(2, walk.ID, true)
+	assert.Error(t, err, "already accepted")
+
+	_, err = am.RespondAssignment(2, room.ID, false)
+	require.NoError(t, err)
+
+	tasks, err := db.OpenTasks(2)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, walk.ID, tasks[0].ID)
+
+	_, err = am.DecideTask(1, 2, walk.ID, true)
+	assert.Error(t, err, "child has not finished the task yet")
+	_, err = am.RequestTaskCompletion(2, walk.ID)
+	require.NoError(t, err)
+	_, err = am.DecideTask(1, 2, walk.ID, true)
+	require.NoError(t, err)
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 25, balance, "custom reward is credited")
+
+	assignments, err := am.Assignments(1, now.Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, assignments, 2)
+	assert.Equal(t, DeclinedStatus, assignments[0].Status)
+	assert.Equal(t, CompletedStatus, assignments[1].Status)
+
+	assignments, err = am.Assignments(3, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, assignments)
+}
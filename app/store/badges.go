@@ -0,0 +1,222 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"strings"
+	"time"
+)
+
+const badgeRefPrefix = "badge:" // ref of the bonus granted with the badge
+
+// Badge is an achievement stored on the user
+type Badge struct {
+	ID      string    `json:"id"`
+	Awarded time.Time `json:"awarded"`
+}
+
+// Achievement describes badge and the milestone to earn it
+type Achievement struct {
+	ID    string
+	Title string
+	Goal  int                          // milestone value
+	value func(s AchievementStats) int // progress towards the goal
+}
+
+// AchievementStats is child's progress used to award badges
+type AchievementStats struct {
+	Tasks    int // approved tasks
+	DogWalks int
+	Earned   int // coins earned with tasks and bonuses
+	Streak   int // days in a row with an approved task
+}
+
+// Achievements lists all badges in the order they are shown
+var Achievements = []Achievement{
+	{ID: "first_task", Title: "🌱 Первое задание", Goal: 1, value: func(s AchievementStats) int { return s.Tasks }},
+	{ID: "tasks_50", Title: "💪 50 заданий", Goal: 50, value: func(s AchievementStats) int { return s.Tasks }},
+	{ID: "dog_walks_10", Title: "🐕 10 прогулок с собакой", Goal: 10,
+		value: func(s AchievementStats) int { return s.DogWalks }},
+	{ID: "streak_3", Title: "🔥 3 дня подряд", Goal: 3, value: func(s AchievementStats) int { return s.Streak }},
+	{ID: "streak_7", Title: "🔥 Неделя подряд", Goal: 7, value: func(s AchievementStats) int { return s.Streak }},
+	{ID: "streak_30", Title: "🏅 Месяц подряд", Goal: 30, value: func(s AchievementStats) int { return s.Streak }},
+	{ID: "earned_1000", Title: "💰 1000 dinocoins заработано", Goal: 1000,
+		value: func(s AchievementStats) int { return s.Earned }},
+}
+
+// Progress returns current value of the milestone, capped by the goal
+func (a Achievement) Progress(s AchievementStats) int {
+	if v := a.value(s); v < a.Goal {
+		return v
+	}
+	return a.Goal
+}
+
+// AchievementByID returns badge description
+func AchievementByID(id string) (Achievement, bool) {
+	for _, a := range Achievements {
+		if a.ID == id {
+			return a, true
+		}
+	}
+	return Achievement{}, false
+}
+
+// HasBadge checks if user earned the badge
+func (u User) HasBadge(id string) bool {
+	for _, b := range u.Badges {
+		if b.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// AwardBadge stores the badge on the user and posts bonus for it in one transaction.
+// Returns false if the user already has the badge.
+func (b *BoltDB) AwardBadge(userId int64, badgeId string, ts time.Time, bonus int) (awarded bool, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(usersBucketName))
+		v := bkt.Get(itob64(userId))
+		if v == nil {
+			return fmt.Errorf("user %d not found", userId)
+		}
+
+		var user User
+		if err := json.Unmarshal(v, &user); err != nil {
+			return fmt.Errorf("failed to unmarshal: %w", err)
+		}
+		if user.HasBadge(badgeId) {
+			return nil
+		}
+
+		user.Badges = append(user.Badges, Badge{ID: badgeId, Awarded: ts})
+		buf, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		if err = bkt.Put(itob64(userId), buf); err != nil {
+			return err
+		}
+
+		awarded = true
+		if bonus == 0 {
+			return nil
+		}
+		_, err = postTransaction(tx, Transaction{Operation: KindBonus, Kind: KindBonus, Cost: bonus, UserId: userId,
+			Reason: "Награда за достижение", Ref: badgeRefPrefix + badgeId, Timestamp: ts})
+		return err
+	})
+
+	return awarded, err
+}
+
+// SetBadgeBonus sets coins granted with every new badge, zero disables the bonus
+func (am *ActionManager) SetBadgeBonus(parentId int64, bonus int) error {
+	if bonus < 0 {
+		return fmt.Errorf("bonus should not be negative, got %d", bonus)
+	}
+
+	return am.updateFamilySettings(parentId, func(s *FamilySettings) {
+		s.BadgeBonus = bonus
+	})
+}
+
+// AchievementStats counts child's approved tasks and earned coins, streak ends on the day of now
+func (am *ActionManager) AchievementStats(childId int64, now time.Time) (AchievementStats, error) {
+	var s AchievementStats
+
+	entries, err := am.db.LedgerEntriesForPeriod(childId, time.Time{}, now.Add(time.Second))
+	if err != nil {
+		return s, fmt.Errorf("unable to load ledger of %d: %w", childId, err)
+	}
+	for _, e := range entries {
+		switch e.Reason {
+		case KindTask:
+			if e.Delta > 0 {
+				s.Tasks++
+				s.Earned += e.Delta
+			}
+		case KindBonus:
+			if !strings.HasPrefix(e.Ref, badgeRefPrefix) {
+				s.Earned += e.Delta
+			}
+		}
+	}
+
+	transactions, err := am.db.TransactionsForPeriod(childId, time.Time{}, now.Add(time.Second))
+	if err != nil {
+		return s, fmt.Errorf("unable to load transactions of %d: %w", childId, err)
+	}
+	for _, t := range transactions {
+		if t.Status == CompletedStatus && t.EffectiveKind() == KindTask && t.Operation == OpWalkDog {
+			s.DogWalks++
+		}
+	}
+
+	if s.Streak, err = am.taskStreak(childId, now); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// AwardBadges grants badges for reached milestones, returns notifications for the child and parents
+func (am *ActionManager) AwardBadges(childId int64, now time.Time) ([]Notification, error) {
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find child %d: %w", childId, err)
+	}
+
+	stats, err := am.AchievementStats(childId, now)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := am.FamilySettings(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load family settings: %w", err)
+	}
+
+	var notifications []Notification
+	for _, a := range Achievements {
+		if child.HasBadge(a.ID) || a.value(stats) < a.Goal {
+			continue
+		}
+
+		awarded, err := am.db.AwardBadge(childId, a.ID, now, settings.BadgeBonus)
+		if err != nil {
+			return notifications, fmt.Errorf("unable to award badge %s to %d: %w", a.ID, childId, err)
+		}
+		if !awarded {
+			continue
+		}
+
+		text := "Новая награда: " + a.Title
+		if settings.BadgeBonus > 0 {
+			text += fmt.Sprintf(", бонус +%d dinocoins", settings.BadgeBonus)
+		}
+		notifications = append(notifications, Notification{ChatID: child.ChatID, Text: text})
+
+		announcement := fmt.Sprintf("@%s получил награду %s", child.Nickname, a.Title)
+		parents, err := am.notifyParents(child, announcement)
+		if err != nil {
+			log.Printf("[WARN] unable to notify parents about badge of %d: %+v", childId, err)
+		}
+		notifications = append(notifications, parents...)
+		if familyId, err := am.FamilyID(childId); err == nil {
+			notifications = append(notifications, am.announce(familyId, "🎉 "+announcement)...)
+		}
+	}
+
+	return notifications, nil
+}
+
+// withAchievements appends badge notifications, failures are logged only as the task is already approved
+func (am *ActionManager) withAchievements(notifications []Notification, childId int64) []Notification {
+	badges, err := am.AwardBadges(childId, time.Now())
+	if err != nil {
+		log.Printf("[WARN] unable to award badges of %d: %+v", childId, err)
+	}
+	return append(notifications, badges...)
+}
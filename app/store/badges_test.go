@@ -0,0 +1,89 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestActionManager_AwardBadges(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	require.NoError(t, am.SetBadgeBonus(1, 7))
+
+	now := time.Now()
+	for i := 2; i >= 0; i-- {
+		tr, err := db.PostTransaction(Transaction{Operation: OpWalkDog, Cost: 10, UserId: 2,
+			Timestamp: now.AddDate(0, 0, -i)})
+		require.NoError(t, err)
+		backdateLedger(t, db, tr.ID, tr.Timestamp)
+	}
+
+	stats, err := am.AchievementStats(2, now)
+	require.NoError(t, err)
+	assert.Equal(t, AchievementStats{Tasks: 3, DogWalks: 3, Earned: 30, Streak: 3}, stats)
+
+	notifications, err := am.AwardBadges(2, now)
+	require.NoError(t, err)
+	require.Len(t, notifications, 4, "child and parent are told about each badge")
+	assert.Equal(t, "Новая награда: 🌱 Первое задание, бонус +7 dinocoins", notifications[0].Text)
+	assert.Equal(t, int64(100), notifications[1].ChatID)
+
+	child, err := db.FindUser(2)
+	require.NoError(t, err)
+	assert.True(t, child.HasBadge("first_task"))
+	assert.True(t, child.HasBadge("streak_3"))
+	assert.False(t, child.HasBadge("dog_walks_10"))
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 30+2*7, balance)
+
+	notifications, err = am.AwardBadges(2, now)
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "badges are awarded once")
+
+	stats, err = am.AchievementStats(2, now.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Streak, "missed day breaks the streak")
+	assert.Equal(t, 30, stats.Earned, "badge bonus is not counted as earned")
+}
+
+func TestActionManager_AchievementStatsByApproval(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	// all tasks are started on one day and approved on three days in a row
+	now := time.Now()
+	for i, op := range []string{OpWalkDog, OpFreeDish, OpGoToShop} {
+		task, err := am.StartTask(2, op)
+		require.NoError(t, err)
+		_, err = db.ApproveTransaction(2, task.ID)
+		require.NoError(t, err)
+		backdateLedger(t, db, task.ID, now.AddDate(0, 0, i-2))
+	}
+
+	stats, err := am.AchievementStats(2, now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Streak, "streak counts days of approval")
+	assert.Equal(t, 3, stats.Tasks)
+	assert.Equal(t, 1, stats.DogWalks)
+
+	stats, err = am.AchievementStats(2, now.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Tasks, "task approved later is not counted yet")
+	assert.Equal(t, 2, stats.Streak)
+}
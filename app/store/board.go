@@ -0,0 +1,296 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BoardFreeStatus    = "FREE"
+	BoardClaimedStatus = "CLAIMED"
+	BoardDoneStatus    = "DONE"
+)
+
+// ErrAlreadyClaimed is returned when a sibling claimed the board task first
+var ErrAlreadyClaimed = errors.New("task already claimed")
+
+// BoardTask is a task posted to the whole family and done by one child only,
+// board tasks are stored in board_<familyId> bucket, boardTaskId -> board task
+type BoardTask struct {
+	ID        string    `json:"id"`
+	FamilyID  int64     `json:"family_id"`
+	PostedBy  int64     `json:"posted_by"`
+	Operation string    `json:"operation"`
+	Reward    int       `json:"reward"`
+	Status    string    `json:"status"`
+	ClaimedBy int64     `json:"claimed_by,omitempty"`
+	TxID      string    `json:"tx_id,omitempty"` // task of the child who claimed it
+	Posted    time.Time `json:"posted"`
+}
+
+func boardBucketName(familyId int64) []byte {
+	return []byte("board_" + strconv.FormatInt(familyId, 10))
+}
+
+// boardRef links child's task to the board task
+func boardRef(familyId int64, boardTaskId string) string {
+	return strconv.FormatInt(familyId, 10) + ":" + boardTaskId
+}
+
+func parseBoardRef(ref string) (familyId int64, boardTaskId string, err error) {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("invalid board reference %s", ref)
+	}
+	familyId, err = strconv.ParseInt(parts[0], 10, 64)
+	return familyId, parts[1], err
+}
+
+func saveBoardTask(tx *bbolt.Tx, bt *BoardTask) error {
+	bkt, err := tx.CreateBucketIfNotExists(boardBucketName(bt.FamilyID))
+	if err != nil {
+		return fmt.Errorf("failed to create board bucket of %d: %w", bt.FamilyID, err)
+	}
+
+	if bt.ID == "" {
+		id, _ := bkt.NextSequence()
+		bt.ID = fmt.Sprint(id)
+	}
+
+	buf, err := json.Marshal(bt)
+	if err != nil {
+		return err
+	}
+	return bkt.Put([]byte(bt.ID), buf)
+}
+
+func getBoardTask(tx *bbolt.Tx, familyId int64, id string) (bt BoardTask, err error) {
+	bkt := tx.Bucket(boardBucketName(familyId))
+	if bkt == nil {
+		return bt, fmt.Errorf("board task %s not found", id)
+	}
+	v := bkt.Get([]byte(id))
+	if v == nil {
+		return bt, fmt.Errorf("board task %s not found", id)
+	}
+	if err = json.Unmarshal(v, &bt); err != nil {
+		return bt, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	return bt, nil
+}
+
+// SaveBoardTask creates or updates board task, new tasks get ID from the bucket sequence
+func (b *BoltDB) SaveBoardTask(bt BoardTask) (BoardTask, error) {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		return saveBoardTask(tx, &bt)
+	})
+
+	return bt, err
+}
+
+// BoardTasks returns board of the family, done tasks are skipped
+func (b *BoltDB) BoardTasks(familyId int64) (tasks []BoardTask, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(boardBucketName(familyId))
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			var bt BoardTask
+			if err := json.Unmarshal(v, &bt); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if bt.Status != BoardDoneStatus {
+				tasks = append(tasks, bt)
+			}
+			return nil
+		})
+	})
+
+	return tasks, err
+}
+
+// DeleteBoardTask removes board task which is not claimed
+func (b *BoltDB) DeleteBoardTask(familyId int64, id string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bt, err := getBoardTask(tx, familyId, id)
+		if err != nil {
+			return err
+		}
+		if bt.Status == BoardClaimedStatus {
+			return fmt.Errorf("board task %s is claimed", id)
+		}
+		return tx.Bucket(boardBucketName(familyId)).Delete([]byte(id))
+	})
+}
+
+// ClaimBoardTask assigns free board task to the child and creates child's open task in one transaction,
+// so only one of the siblings gets it
+func (b *BoltDB) ClaimBoardTask(familyId int64, id string, childId int64) (bt BoardTask, t Transaction, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if bt, err = getBoardTask(tx, familyId, id); err != nil {
+			return err
+		}
+		if bt.Status != BoardFreeStatus {
+			return ErrAlreadyClaimed
+		}
+
+		t = Transaction{Timestamp: time.Now(), Operation: bt.Operation, Cost: bt.Reward, UserId: childId,
+			Status: OpenStatus, Board: boardRef(familyId, bt.ID)}
+		if err = putTransaction(tx, &t); err != nil {
+			return err
+		}
+
+		bt.Status = BoardClaimedStatus
+		bt.ClaimedBy = childId
+		bt.TxID = t.ID
+		return saveBoardTask(tx, &bt)
+	})
+
+	return bt, t, err
+}
+
+// syncBoardTask follows status of the task claimed from the board: the board task is done once the task is completed
+// and released back to the board if the task is canceled, declined or expired
+func syncBoardTask(tx *bbolt.Tx, t Transaction) error {
+	familyId, id, err := parseBoardRef(t.Board)
+	if err != nil {
+		return err
+	}
+	bt, err := getBoardTask(tx, familyId, id)
+	if err != nil {
+		log.Printf("[WARN] board task of transaction %s is gone: %+v", t.ID, err)
+		return nil
+	}
+	if bt.TxID != t.ID || bt.ClaimedBy != t.UserId {
+		return nil
+	}
+
+	switch t.Status {
+	case CompletedStatus, ApprovedStatus:
+		bt.Status = BoardDoneStatus
+	case CanceledStatus, DeclinedStatus, ExpiredStatus:
+		bt.Status = BoardFreeStatus
+		bt.ClaimedBy = 0
+		bt.TxID = ""
+	default:
+		return nil
+	}
+	return saveBoardTask(tx, &bt)
+}
+
+// PostBoardTask publishes task for all children of parent's family, args are "operation [reward]".
+// Unknown operations are allowed with an explicit reward.
+func (am *ActionManager) PostBoardTask(parentId int64, args []string) (BoardTask, []Notification, error) {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return BoardTask{}, nil, err
+	}
+
+	if len(args) < 1 || len(args) > 2 {
+		return BoardTask{}, nil, fmt.Errorf("operation and optional reward are expected")
+	}
+	bt := BoardTask{FamilyID: familyId, PostedBy: parentId, Operation: args[0], Status: BoardFreeStatus,
+		Posted: time.Now()}
+	if len(args) == 2 {
+		if bt.Reward, err = strconv.Atoi(args[1]); err != nil || bt.Reward <= 0 {
+			return BoardTask{}, nil, fmt.Errorf("invalid reward %s", args[1])
+		}
+	} else if bt.Reward, err = am.OperationCost(parentId, bt.Operation); err != nil {
+		return BoardTask{}, nil, fmt.Errorf("reward is required for custom task %s: %w", bt.Operation, err)
+	}
+
+	if bt, err = am.db.SaveBoardTask(bt); err != nil {
+		return BoardTask{}, nil, fmt.Errorf("unable to save board task: %w", err)
+	}
+
+	text := fmt.Sprintf("На доске новое задание %s, награда %d dinocoins. Кто первый возьмет, тот и делает",
+		OperationTitle(bt.Operation), bt.Reward)
+	claim := Button{Text: "Взять", Data: "claim:" + bt.ID}
+	if group := am.announce(familyId, text, claim); group != nil {
+		return bt, group, nil
+	}
+	return bt, am.notifyChildren(familyId, 0, text, claim), nil
+}
+
+// DeleteBoardTask removes free board task of parent's family
+func (am *ActionManager) DeleteBoardTask(parentId int64, id string) error {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return err
+	}
+	return am.db.DeleteBoardTask(familyId, id)
+}
+
+// Board returns tasks on the board of the user's family
+func (am *ActionManager) Board(userId int64) ([]BoardTask, error) {
+	familyId, err := am.FamilyID(userId)
+	if err != nil {
+		return nil, err
+	}
+	return am.db.BoardTasks(familyId)
+}
+
+// ClaimBoardTask gives board task to the child, siblings are told it is taken
+func (am *ActionManager) ClaimBoardTask(childId int64, id string) (Transaction, []Notification, error) {
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return Transaction{}, nil, fmt.Errorf("unable to find child: %w", err)
+	}
+	if child.Type != CHILD {
+		return Transaction{}, nil, fmt.Errorf("user %d is not a child", childId)
+	}
+
+	familyId, err := am.FamilyID(childId)
+	if err != nil {
+		return Transaction{}, nil, err
+	}
+
+	settings, err := am.db.FamilySettings(familyId)
+	if err != nil {
+		return Transaction{}, nil, fmt.Errorf("unable to load family settings: %w", err)
+	}
+	tasks, err := am.db.OpenTasks(childId)
+	if err != nil {
+		return Transaction{}, nil, fmt.Errorf("unable to load open tasks of %d: %w", childId, err)
+	}
+	if len(tasks) >= settings.MaxOpenTasks {
+		return Transaction{}, nil, ErrTooManyTasks
+	}
+
+	bt, t, err := am.db.ClaimBoardTask(familyId, id, childId)
+	if err != nil {
+		return Transaction{}, nil, err
+	}
+
+	text := fmt.Sprintf("@%s взял задание %s с доски", child.Nickname, OperationTitle(bt.Operation))
+	if group := am.announce(familyId, text); group != nil {
+		return t, group, nil
+	}
+	return t, am.notifyChildren(familyId, childId, text), nil
+}
+
+// notifyChildren builds notifications for all children of the family except the given one
+func (am *ActionManager) notifyChildren(familyId, exceptId int64, text string, buttons ...Button) []Notification {
+	children, err := am.familyChildren(familyId)
+	if err != nil {
+		log.Printf("[WARN] unable to find children of %d: %+v", familyId, err)
+		return nil
+	}
+
+	var notifications []Notification
+	for _, child := range children {
+		if child.ID == exceptId {
+			continue
+		}
+		notifications = append(notifications, Notification{ChatID: child.ChatID, Text: text, Buttons: buttons})
+	}
+	return notifications
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestActionManager_ClaimBoardTask(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "sis", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	require.NoError(t, db.BindChildToParent(1, "@sis"))
+
+	_, _, err = am.PostBoardTask(2, []string{OpWalkDog})
+	assert.Error(t, err, "only parents post tasks")
+	_, _, err = am.PostBoardTask(1, []string{"уборка_гаража"})
+	assert.Error(t, err, "custom task requires reward")
+
+	bt, notifications, err := am.PostBoardTask(1, []string{"уборка_гаража", "30"})
+	require.NoError(t, err)
+	assert.Equal(t, BoardFreeStatus, bt.Status)
+	require.Len(t, notifications, 2, "all children see the new task")
+	assert.Equal(t, "claim:"+bt.ID, notifications[0].Buttons[0].Data)
+
+	task, notifications, err := am.ClaimBoardTask(2, bt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 30, task.Cost)
+	assert.Equal(t, OpenStatus, task.Status)
+	require.Len(t, notifications, 1, "sibling is told the task is taken")
+	assert.Equal(t, int64(300), notifications[0].ChatID)
+
+	_, _, err = am.ClaimBoardTask(3, bt.ID)
+	assert.True(t, errors.Is(err, ErrAlreadyClaimed))
+	assert.Error(t, am.DeleteBoardTask(1, bt.ID), "claimed task can't be deleted")
+
+	board, err := am.Board(3)
+	require.NoError(t, err)
+	require.Len(t, board, 1)
+	assert.Equal(t, BoardClaimedStatus, board[0].Status)
+	assert.Equal(t, int64(2), board[0].ClaimedBy)
+
+	require.NoError(t, db.CancelTask(2, task.ID))
+	board, err = am.Board(3)
+	require.NoError(t, err)
+	require.Len(t, board, 1)
+	assert.Equal(t, BoardFreeStatus, board[0].Status, "canceled task returns to the board")
+
+	task, _, err = am.ClaimBoardTask(3, bt.ID)
+	require.NoError(t, err)
+	_, err = am.RequestTaskCompletion(3, task.ID)
+	require.NoError(t, err)
+	_, err = am.DecideTask(1, 3, task.ID, true)
+	require.NoError(t, err)
+
+	board, err = am.Board(2)
+	require.NoError(t, err)
+	assert.Empty(t, board, "done task leaves the board")
+	balance, err := db.Balance(3)
+	require.NoError(t, err)
+	assert.Equal(t, 30, balance)
+}
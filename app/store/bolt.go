@@ -6,16 +6,33 @@ import (
 	"fmt"
 	bbolt "go.etcd.io/bbolt"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 const (
-	costsBucketName        = "costs"               // bucket with operation costs, operation -> cost
-	balanceBucketName      = "balance"             // userId -> balance
-	usersBucketName        = "users"               // userId -> user struct
-	currentTransactionName = "current_transaction" // userId -> transaction struct
+	costsBucketName          = "costs"               // bucket with operation costs, operation -> cost
+	balanceBucketName        = "balance"             // userId -> balance
+	usersBucketName          = "users"               // userId -> user struct
+	legacyCurrentName        = "current_transaction" // userId -> transaction struct, replaced by status index
+	choresBucketName         = "chores"              // choreId -> chore struct
+	familySettingsBucketName = "family_settings"     // parentId -> family settings struct
+	remindersBucketName      = "reminders"           // reminder key -> sent timestamp
+	purchasesBucketName      = "purchases"           // purchaseId -> purchase struct
+	allowancesBucketName     = "allowances"          // childId -> allowance struct
+	periodicRunsBucketName   = "periodic_runs"       // job:subject:period -> posted transaction id
+	snapshotsBucketName      = "balance_snapshots"   // userId + date -> balance at the end of the day
+	withdrawalsBucketName    = "withdrawals"         // withdrawalId -> withdrawal struct
+	ledgerBucketName         = "ledger"              // entryId -> ledger entry struct, source of truth for balances
+	processedBucketName      = "processed"           // update or callback key -> processed timestamp
+	statusIndexBucketName    = "status_index"        // status/userId/txId -> nil
+	photoTargetsBucketName   = "photo_targets"       // userId -> id of the task the next photo belongs to
+	digestsBucketName        = "digests"             // parentId -> weekly digest schedule
+	groupChatsBucketName     = "group_chats"         // chatId -> familyId of the linked group chat
+	loginTokensBucketName    = "login_tokens"        // token -> login token struct of the admin panel
+	apiTokensBucketName      = "api_tokens"          // sha256 of token -> api token of the family
 
 	defaultWalkDogCost     = 10
 	defaultFreeDish        = 5
@@ -27,23 +44,45 @@ const (
 )
 
 const (
-	OpNewTask           = "new_task"
-	OpWalkDog           = "walk_dog"
-	OpBalance           = "balance"
-	OpHistory           = "history"
-	OpGetMoney          = "get_money"
-	OpFinishTask        = "finish_task"
-	OpFreeDish          = "free_dish"
-	OpDirtyDish         = "dirty_dish"
-	OpGoToShop          = "go_to_shop"
-	OpWashFloorInFlat   = "wash_floor_in_flat"
-	OpChild             = "child"
-	OpParent            = "parent"
-	OpCancelCurrentTask = "cancel_current_task"
-	OpFinishCurrentTask = "finish_current_task"
+	OpNewTask         = "new_task"
+	OpWalkDog         = "walk_dog"
+	OpBalance         = "balance"
+	OpHistory         = "history"
+	OpGetMoney        = "get_money"
+	OpFinishTask      = "finish_task"
+	OpFreeDish        = "free_dish"
+	OpDirtyDish       = "dirty_dish"
+	OpGoToShop        = "go_to_shop"
+	OpWashFloorInFlat = "wash_floor_in_flat"
+	OpChild           = "child"
+	OpParent          = "parent"
 )
 
-// transaction list is stored in separate bucket for each user, bucketname = userId, timestamp -> transaction
+// operationTitles keeps human-readable task names
+var operationTitles = map[string]string{
+	OpWalkDog:         "Погулять с собакой",
+	OpFreeDish:        "Разгрузить посудомойку",
+	OpDirtyDish:       "Загрузить посудомойку",
+	OpGoToShop:        "Сходить в магазин",
+	OpWashFloorInFlat: "Помыть полы в квартире",
+	KindBonus:         "Бонус",
+	KindPenalty:       "Штраф",
+	KindGoal:          "Покупка цели",
+	KindPurchase:      "Покупка в магазине",
+	KindAllowance:     "Карманные деньги",
+	KindInterest:      "Проценты",
+	KindWithdrawal:    "Обмен на деньги",
+}
+
+// OperationTitle returns task name for the operation, or operation itself if it is unknown
+func OperationTitle(op string) string {
+	if title, ok := operationTitles[op]; ok {
+		return title
+	}
+	return op
+}
+
+// transaction list is stored in separate bucket for each user, bucketname = userId, transactionId -> transaction
 // parent_<userId> - bucket with a list of parent children
 // "child_@" + childNickName - contains list of parents, parentId->nil
 type BoltDB struct {
@@ -54,7 +93,12 @@ type BoltDB struct {
 func NewBoltDB(fileName string) (*BoltDB, error) {
 	log.Printf("[INFO] creating bolt store")
 	db, err := bbolt.Open(fileName, 0o600, nil)
-	buckets := []string{costsBucketName, balanceBucketName, usersBucketName, currentTransactionName}
+	buckets := []string{costsBucketName, balanceBucketName, usersBucketName, choresBucketName,
+		familySettingsBucketName, remindersBucketName, purchasesBucketName,
+		allowancesBucketName, periodicRunsBucketName, snapshotsBucketName,
+		withdrawalsBucketName, ledgerBucketName, processedBucketName, statusIndexBucketName,
+		photoTargetsBucketName, digestsBucketName, groupChatsBucketName, loginTokensBucketName,
+		apiTokensBucketName}
 
 	err = db.Update(func(tx *bbolt.Tx) error {
 		for _, bktName := range buckets {
@@ -74,7 +118,20 @@ func NewBoltDB(fileName string) (*BoltDB, error) {
 				}
 			}
 		}
-		return nil
+		if err := migrateTransactions(tx); err != nil {
+			return err
+		}
+		// open tasks are found by the status index, the copy of the single current task isn't needed anymore
+		if tx.Bucket([]byte(legacyCurrentName)) != nil {
+			if err := tx.DeleteBucket([]byte(legacyCurrentName)); err != nil {
+				return err
+			}
+		}
+		if err := migrateLedger(tx); err != nil {
+			return err
+		}
+		// balances are the projection of the ledger, drop whatever drifted while the bot was down
+		return rebuildBalances(tx)
 	})
 
 	if err != nil {
@@ -90,66 +147,25 @@ func (b *BoltDB) CreateTransaction(op string, userId int64) (transaction *Transa
 		return nil, err
 	}
 
-	t := Transaction{
-		Timestamp: time.Now(),
-		Operation: op,
-		Cost:      cost,
-		UserId:    userId,
-		Status:    OpenStatus,
-	}
-
-	err = b.db.Update(func(tx *bbolt.Tx) error {
-		// create bucket for a user if not exists, bucket keeps list of user transactions
-		_, e := tx.CreateBucketIfNotExists(itob64(userId))
-		if e != nil {
-			return fmt.Errorf("failed to create user bucket %d: %w", userId, e)
-		}
-
-		return nil
-	})
-
+	t, err := b.CreateTask(Transaction{Operation: op, Cost: cost, UserId: userId})
 	if err != nil {
 		return nil, err
 	}
 
-	transactionTimeStamp := []byte(t.Timestamp.Format(TSNano))
-
-	err = b.db.Update(func(tx *bbolt.Tx) error {
-		// Retrieve the users bucket.
-		// This should be created when the DB is first opened.
-		userBkt := tx.Bucket(itob64(userId))
-
-		id, _ := userBkt.NextSequence()
-		t.ID = fmt.Sprint(id)
-
-		// Marshal user data into bytes.
-		buf, err := json.Marshal(t)
-		if err != nil {
-			return err
-		}
-
-		// Persist bytes to users bucket.
-		return userBkt.Put(transactionTimeStamp, buf)
-	})
-
-	if err != nil {
-		return nil, err
-	}
+	return &t, err
+}
 
-	err = b.db.Update(func(tx *bbolt.Tx) error {
-		// Retrieve the users bucket.
-		// This should be created when the DB is first opened.
-		bkt := tx.Bucket([]byte(currentTransactionName))
-		buf, err := json.Marshal(t)
-		if err != nil {
-			return err
-		}
+// CreateTask stores a new open task of the user, the task gets id and creation time
+func (b *BoltDB) CreateTask(t Transaction) (Transaction, error) {
+	t.ID = ""
+	t.Timestamp = time.Now()
+	t.Status = OpenStatus
 
-		// Persist bytes to users bucket.
-		return bkt.Put(itob64(userId), buf)
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		return putTransaction(tx, &t)
 	})
 
-	return &t, err
+	return t, err
 }
 
 func (b *BoltDB) GetOperationCost(op string) (int, error) {
@@ -157,6 +173,9 @@ func (b *BoltDB) GetOperationCost(op string) (int, error) {
 	err := b.db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(costsBucketName))
 		v := b.Get([]byte(op))
+		if v == nil {
+			return fmt.Errorf("cost of operation %s not found", op)
+		}
 		cost = int(binary.BigEndian.Uint64(v))
 		return nil
 	})
@@ -180,23 +199,80 @@ func (b *BoltDB) Balance(id int64) (int, error) {
 }
 
 func (b *BoltDB) ChangeBalance(userId int64, delta int) (result int, err error) {
-	result = delta
 	err = b.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(balanceBucketName))
-		v := b.Get(itob64(userId))
+		result, err = changeBalance(tx, posting{userId: userId, delta: delta, reason: ReasonAdjustment})
+		return err
+	})
 
-		if v == nil {
-			b.Put(itob64(userId), itob(delta))
-		} else {
-			val := int(binary.BigEndian.Uint64(v)) + delta
-			result = val
-			b.Put(itob64(userId), itob(val))
+	return result, err
+}
+
+// balanceOf returns user balance within the transaction
+func balanceOf(tx *bbolt.Tx, userId int64) int {
+	if v := tx.Bucket([]byte(balanceBucketName)).Get(itob64(userId)); v != nil {
+		return int(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+// transactionPosting describes balance change made by the transaction
+func transactionPosting(t Transaction) posting {
+	return posting{userId: t.UserId, delta: t.BalanceDelta(), reason: t.EffectiveKind(), txId: t.ID, ref: t.Ref}
+}
+
+// PostTransaction stores completed transaction in user history and applies it to the balance atomically
+func (b *BoltDB) PostTransaction(t Transaction) (Transaction, error) {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		t, err = postTransaction(tx, t)
+		return err
+	})
+
+	return t, err
+}
+
+func postTransaction(tx *bbolt.Tx, t Transaction) (Transaction, error) {
+	if t.Timestamp.IsZero() {
+		t.Timestamp = time.Now()
+	}
+	t.Status = CompletedStatus
+	t.ID = ""
+
+	if err := putTransaction(tx, &t); err != nil {
+		return t, err
+	}
+
+	_, err := changeBalance(tx, transactionPosting(t))
+	return t, err
+}
+
+// ApproveTransaction completes active transaction of the user by id and adds its cost to the balance atomically
+func (b *BoltDB) ApproveTransaction(userId int64, txId string) (t Transaction, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if t, err = getTransaction(tx, userId, txId); err != nil {
+			return err
+		}
+		if t.Status == CompletedStatus {
+			return ErrAlreadyConfirmed
+		}
+		if !t.IsActive() {
+			return fmt.Errorf("transaction %s is %s", txId, t.Status)
 		}
 
-		return nil
+		return approveTransaction(tx, &t)
 	})
 
-	return result, err
+	return t, err
+}
+
+func approveTransaction(tx *bbolt.Tx, t *Transaction) error {
+	t.Status = CompletedStatus
+	if err := updateTransactionStatus(tx, *t, CompletedStatus, t.UserId); err != nil {
+		return fmt.Errorf("unable to change transaction status %w", err)
+	}
+
+	_, err := changeBalance(tx, transactionPosting(*t))
+	return err
 }
 
 func (b *BoltDB) ShowLastNTransactions(id int64, limit int) (transactions []Transaction, err error) {
@@ -236,6 +312,34 @@ func itob(v int) []byte {
 	return b
 }
 
+// deleteWhere removes keys of the bucket matching the condition. Deleting under the cursor
+// makes it skip the next key, so matching keys are collected first.
+func deleteWhere(bkt *bbolt.Bucket, match func(k, v []byte) bool) error {
+	var keys [][]byte
+	err := bkt.ForEach(func(k, v []byte) error {
+		if match(k, v) {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if err := bkt.Delete(k); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// sentBefore checks if RFC3339 timestamp value is older than the given time, broken values are too
+func sentBefore(v []byte, before time.Time) bool {
+	ts, err := time.Parse(time.RFC3339, string(v))
+	return err != nil || ts.Before(before)
+}
+
 func itob64(v int64) []byte {
 	b := make([]byte, 8)
 	binary.BigEndian.PutUint64(b, uint64(v))
@@ -370,105 +474,116 @@ func (b *BoltDB) BindChildToParent(parentId int64, childNickName string) error {
 	return err
 }
 
-func (b *BoltDB) GetCurrentTransaction(userId int64) (Transaction, error) {
-	var t Transaction
-	err := b.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(currentTransactionName))
-
-		v := b.Get(itob64(userId))
-		if v != nil {
-			if err := json.Unmarshal(v, &t); err != nil {
-				return fmt.Errorf("failed to unmarshal: %w", err)
-			}
-		} else {
-			return fmt.Errorf("current transaction not found")
-		}
+func (b *BoltDB) UpdateTransactionStatus(t Transaction, newStatus string, userId int64) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return updateTransactionStatus(tx, t, newStatus, userId)
+	})
+}
 
-		return nil
+// OpenTasks returns open and pending tasks of the user, oldest first
+func (b *BoltDB) OpenTasks(userId int64) (tasks []Transaction, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		tasks, err = openTasks(tx, userId)
+		return err
 	})
 
-	return t, err
+	return tasks, err
 }
 
-func (b *BoltDB) HasOpenTask(userId int64) (bool, error) {
-	_, err := b.GetCurrentTransaction(userId)
-	if err != nil && strings.Contains(err.Error(), "not found") {
-		return false, nil
+func openTasks(tx *bbolt.Tx, userId int64) (tasks []Transaction, err error) {
+	for _, status := range []string{OpenStatus, PendingStatus} {
+		transactions, err := userTransactionsByStatus(tx, userId, status)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range transactions {
+			if t.EffectiveKind() == KindTask {
+				tasks = append(tasks, t)
+			}
+		}
 	}
 
+	sort.Slice(tasks, func(i, j int) bool { return lessID(tasks[i].ID, tasks[j].ID) })
+	return tasks, nil
+}
+
+// activeTask loads open or pending task of the user
+func activeTask(tx *bbolt.Tx, userId int64, txId string) (Transaction, error) {
+	t, err := getTransaction(tx, userId, txId)
 	if err != nil {
-		return false, err
+		return t, err
 	}
-
-	return true, nil
+	if !t.IsActive() {
+		return t, fmt.Errorf("task %s is %s", txId, t.Status)
+	}
+	return t, nil
 }
 
-func (b *BoltDB) CancelCurrentTask(userId int64) error {
-	err := b.db.Update(func(tx *bbolt.Tx) error {
-		bkt := tx.Bucket([]byte(currentTransactionName))
-
-		var curTransaction Transaction
-
-		v := bkt.Get(itob64(userId))
-		if v != nil {
-			if err := json.Unmarshal(v, &curTransaction); err != nil {
-				return fmt.Errorf("failed to unmarshal: %w", err)
-			}
-		}
-
-		e := bkt.Delete(itob64(userId))
-		if e != nil {
-			return fmt.Errorf("failed to remove current transaction: %w", e)
+// CancelTask cancels open or pending task of the user
+func (b *BoltDB) CancelTask(userId int64, txId string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		t, err := activeTask(tx, userId, txId)
+		if err != nil {
+			return err
 		}
 
-		if err := b.UpdateTransactionStatus(curTransaction, CanceledStatus, userId); err != nil {
+		if err = updateTransactionStatus(tx, t, CanceledStatus, userId); err != nil {
 			return fmt.Errorf("failed to update transaction status: %w", err)
 		}
-
 		return nil
 	})
-
-	return err
 }
 
-func (b *BoltDB) UpdateTransactionStatus(t Transaction, newStatus string, userId int64) error {
-	err := b.db.Update(func(tx *bbolt.Tx) error {
-		trsBkt := tx.Bucket(itob64(userId))
-		ts := t.Timestamp.Format(TSNano)
-		val := trsBkt.Get([]byte(ts))
+// RequestCompletion marks task as waiting for parent approval
+func (b *BoltDB) RequestCompletion(userId int64, txId string) (t Transaction, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if t, err = activeTask(tx, userId, txId); err != nil {
+			return err
+		}
 
-		if val != nil {
-			var t Transaction
-			if err := json.Unmarshal(val, &t); err != nil {
-				return fmt.Errorf("failed to unmarshal: %w", err)
-			}
+		t.Status = PendingStatus
+		t.RequestedAt = time.Now()
+		return saveTransaction(tx, t)
+	})
 
-			t.Status = newStatus
+	return t, err
+}
 
-			buf, err := json.Marshal(t)
-			if err != nil {
-				return err
-			}
+// updateTransactionStatus changes status of the stored transaction
+func updateTransactionStatus(tx *bbolt.Tx, t Transaction, newStatus string, userId int64) error {
+	stored, err := getTransaction(tx, userId, t.ID)
+	if err != nil {
+		return err
+	}
 
-			e := trsBkt.Put([]byte(ts), buf)
+	stored.Status = newStatus
+	stored.UserId = userId
 
-			if e != nil {
-				return fmt.Errorf("failed to update transaction status: %w", e)
-			}
-		} else {
-			return fmt.Errorf("transaction with timestamp %s not found", ts)
-		}
+	return saveTransaction(tx, stored)
+}
 
-		return nil
-	})
+// saveTransaction updates transaction in user history, the board task claimed by the user follows its status
+func saveTransaction(tx *bbolt.Tx, t Transaction) error {
+	if tx.Bucket(itob64(t.UserId)) == nil {
+		return fmt.Errorf("transactions of user %d not found", t.UserId)
+	}
+	if err := putTransaction(tx, &t); err != nil {
+		return err
+	}
 
-	return err
+	if t.Board == "" {
+		return nil
+	}
+	return syncBoardTask(tx, t)
 }
 
 func (b *BoltDB) FindParentIdByChildNickName(childNickName string) (parentId int64, err error) {
 	err = b.db.View(func(tx *bbolt.Tx) error {
 		bktName := "child_@" + childNickName
 		bkt := tx.Bucket([]byte(bktName))
+		if bkt == nil {
+			return fmt.Errorf("parent for a child [%s] not found", childNickName)
+		}
 
 		k, _ := bkt.Cursor().First()
 
@@ -484,10 +599,30 @@ func (b *BoltDB) FindParentIdByChildNickName(childNickName string) (parentId int
 	return parentId, err
 }
 
+// FindParentIdsByChildNickName returns all parents of the child, the first one is the same as FindParentIdByChildNickName returns
+func (b *BoltDB) FindParentIdsByChildNickName(childNickName string) (parentIds []int64, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte("child_@" + childNickName))
+		if bkt == nil {
+			return fmt.Errorf("parent for a child [%s] not found", childNickName)
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			parentIds = append(parentIds, int64(binary.BigEndian.Uint64(k)))
+			return nil
+		})
+	})
+
+	return parentIds, err
+}
+
 func (b *BoltDB) FindChildren(parentId int64) (children []string, err error) {
 	err = b.db.View(func(tx *bbolt.Tx) error {
 		prtBktName := "parent_" + strconv.FormatInt(parentId, 10)
 		prtBkt := tx.Bucket([]byte(prtBktName))
+		if prtBkt == nil {
+			return nil
+		}
 
 		prtBkt.ForEach(func(k, v []byte) error {
 			children = append(children, string(k))
@@ -31,7 +31,9 @@ func TestBoltDB_CreateTransaction(t *testing.T) {
 	err = db.db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(itob64(userID))
 		assert.NotNil(t, b)
-		v := b.Get([]byte(tr.Timestamp.Format(TSNano)))
+		key, err := transactionKey(tr.ID)
+		assert.NoError(t, err)
+		v := b.Get(key)
 		assert.NotNil(t, v)
 
 		transaction := Transaction{}
@@ -50,17 +52,9 @@ func TestBoltDB_CreateTransaction(t *testing.T) {
 
 	assert.NoError(t, err)
 
-	err = db.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(currentTransactionName))
-		assert.NotNil(t, b)
-
-		v := b.Get(itob64(userID))
-		assert.NotNil(t, v)
-
-		return nil
-	})
-
+	tasks, err := db.OpenTasks(userID)
 	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
 }
 
 func prepare(t *testing.T) (db *BoltDB, teardown func()) {
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GrantBonus credits child's balance with parent's bonus, returns notifications for the child
+func (am *ActionManager) GrantBonus(parentId int64, childNickName string, amount int, reason string) ([]Notification, error) {
+	return am.adjustBalance(parentId, childNickName, KindBonus, amount, reason)
+}
+
+// Fine deducts penalty from child's balance, returns notifications for the child
+func (am *ActionManager) Fine(parentId int64, childNickName string, amount int, reason string) ([]Notification, error) {
+	return am.adjustBalance(parentId, childNickName, KindPenalty, amount, reason)
+}
+
+func (am *ActionManager) adjustBalance(parentId int64, childNickName, kind string, amount int, reason string) ([]Notification, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount should be positive, got %d", amount)
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+
+	child, err := am.findOwnChild(parentId, childNickName)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := am.db.PostTransaction(Transaction{
+		Operation: kind,
+		Kind:      kind,
+		Cost:      amount,
+		UserId:    child.ID,
+		Reason:    reason,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to post %s: %w", kind, err)
+	}
+
+	balance, err := am.db.Balance(child.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get balance: %w", err)
+	}
+
+	text := fmt.Sprintf("Бонус +%d: %s", t.Cost, t.Reason)
+	if kind == KindPenalty {
+		text = fmt.Sprintf("Штраф -%d: %s", t.Cost, t.Reason)
+	}
+
+	notifications := []Notification{{ChatID: child.ChatID, Text: fmt.Sprintf("%s\nБаланс: %d dinocoins", text, balance)}}
+	return am.withGoalProgress(notifications, child.ID), nil
+}
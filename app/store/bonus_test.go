@@ -0,0 +1,47 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestActionManager_GrantBonusAndFine(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	n, err := am.GrantBonus(1, "@kid", 15, "за помощь")
+	require.NoError(t, err)
+	require.Len(t, n, 1)
+	assert.Equal(t, int64(200), n[0].ChatID)
+	assert.Contains(t, n[0].Text, "за помощь")
+
+	_, err = am.Fine(1, "@kid", 5, "грубость")
+	require.NoError(t, err)
+
+	_, err = am.Fine(1, "@kid", 5, " ")
+	assert.Error(t, err, "reason is mandatory")
+	_, err = am.GrantBonus(1, "@kid", -5, "test")
+	assert.Error(t, err)
+	_, err = am.GrantBonus(2, "@kid", 5, "test")
+	assert.Error(t, err, "only parent can grant bonus")
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 10, balance)
+
+	transactions, err := db.ShowLastNTransactions(2, 10)
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, KindPenalty, transactions[0].Kind)
+	assert.Equal(t, -5, transactions[0].BalanceDelta())
+	assert.Equal(t, "грубость", transactions[0].Reason)
+	assert.Equal(t, KindBonus, transactions[1].Kind)
+	assert.Equal(t, 15, transactions[1].BalanceDelta())
+}
@@ -0,0 +1,47 @@
+package store
+
+import "fmt"
+
+// ChallengeData is a callback data of the challenge button shared via inline mode
+func ChallengeData(challengerId int64, op string) string {
+	return fmt.Sprintf("challenge:%s:%d", op, challengerId)
+}
+
+// AcceptChallenge starts the task for the sibling who accepted the challenge, the challenger is notified
+func (am *ActionManager) AcceptChallenge(childId, challengerId int64, op string) (*Transaction, []Notification, error) {
+	if childId == challengerId {
+		return nil, nil, fmt.Errorf("child %d can't accept own challenge", childId)
+	}
+
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to find child %d: %w", childId, err)
+	}
+	challenger, err := am.db.FindUser(challengerId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to find challenger %d: %w", challengerId, err)
+	}
+	if child.Type != CHILD || challenger.Type != CHILD {
+		return nil, nil, fmt.Errorf("challenges are for children only")
+	}
+
+	familyId, err := am.FamilyID(childId)
+	if err != nil {
+		return nil, nil, err
+	}
+	challengerFamily, err := am.FamilyID(challengerId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if familyId != challengerFamily {
+		return nil, nil, fmt.Errorf("child %d and challenger %d are not siblings", childId, challengerId)
+	}
+
+	t, err := am.StartTask(childId, op)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t, []Notification{{ChatID: challenger.ChatID,
+		Text: fmt.Sprintf("@%s принял вызов: %s. Кто быстрее?", child.Nickname, OperationTitle(op))}}, nil
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestActionManager_AcceptChallenge(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "sis", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 4, ChatID: 400, Nickname: "mum", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 5, ChatID: 500, Nickname: "stranger", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	require.NoError(t, db.BindChildToParent(1, "@sis"))
+	require.NoError(t, db.BindChildToParent(4, "@stranger"))
+
+	assert.Equal(t, "challenge:walk_dog:2", ChallengeData(2, OpWalkDog))
+
+	_, _, err = am.AcceptChallenge(2, 2, OpWalkDog)
+	assert.Error(t, err, "own challenge")
+	_, _, err = am.AcceptChallenge(5, 2, OpWalkDog)
+	assert.Error(t, err, "not a sibling")
+	_, _, err = am.AcceptChallenge(1, 2, OpWalkDog)
+	assert.Error(t, err, "parents don't accept challenges")
+
+	task, notifications, err := am.AcceptChallenge(3, 2, OpWalkDog)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), task.UserId)
+	assert.Equal(t, OpWalkDog, task.Operation)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(200), notifications[0].ChatID)
+
+	_, _, err = am.AcceptChallenge(3, 2, OpWalkDog)
+	assert.True(t, errors.Is(err, ErrTaskInProgress))
+}
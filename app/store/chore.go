@@ -0,0 +1,316 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ScheduleDaily    = "daily"    // every day
+	ScheduleWeekdays = "weekdays" // monday - friday
+	ScheduleWeekly   = "weekly"   // on the given week days
+	ScheduleEvery    = "every"    // every N days starting from the creation day
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Chore is a recurring task definition, materialized into an open transaction of the child on schedule
+type Chore struct {
+	ID        string         `json:"id"`
+	ParentID  int64          `json:"parent_id"`
+	ChildID   int64          `json:"child_id"`
+	Operation string         `json:"operation"`
+	Schedule  string         `json:"schedule"`
+	Days      []time.Weekday `json:"days,omitempty"`
+	EveryN    int            `json:"every_n,omitempty"`
+	Hour      int            `json:"hour"`
+	Minute    int            `json:"minute"`
+	Created   time.Time      `json:"created"`
+	LastRun   time.Time      `json:"last_run"`
+}
+
+// ScheduleString describes chore schedule in the form ParseChoreSchedule accepts, e.g. "weekly mon,thu 10:00"
+func (c Chore) ScheduleString() string {
+	schedule := c.Schedule
+	switch c.Schedule {
+	case ScheduleWeekly:
+		days := make([]string, 0, len(c.Days))
+		for _, d := range c.Days {
+			days = append(days, strings.ToLower(d.String()[:3]))
+		}
+		schedule += " " + strings.Join(days, ",")
+	case ScheduleEvery:
+		schedule += fmt.Sprintf(" %d", c.EveryN)
+	}
+	return fmt.Sprintf("%s %02d:%02d", schedule, c.Hour, c.Minute)
+}
+
+// ParseChoreSchedule parses schedule definition like "daily 09:00", "weekdays 18:30",
+// "weekly mon,thu 10:00" or "every 3 08:00" into the chore
+func ParseChoreSchedule(args []string, c *Chore) error {
+	if len(args) < 2 {
+		return fmt.Errorf("schedule and time are required")
+	}
+
+	c.Schedule = args[0]
+	timeArg := args[len(args)-1]
+
+	switch c.Schedule {
+	case ScheduleDaily, ScheduleWeekdays:
+		if len(args) != 2 {
+			return fmt.Errorf("unexpected arguments for %s schedule", c.Schedule)
+		}
+	case ScheduleWeekly:
+		if len(args) != 3 {
+			return fmt.Errorf("week days are required for weekly schedule")
+		}
+		c.Days = nil
+		for _, name := range strings.Split(args[1], ",") {
+			day, ok := weekdayNames[strings.ToLower(name)]
+			if !ok {
+				return fmt.Errorf("unknown week day %s", name)
+			}
+			c.Days = append(c.Days, day)
+		}
+	case ScheduleEvery:
+		if len(args) != 3 {
+			return fmt.Errorf("number of days is required for every schedule")
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of days %s", args[1])
+		}
+		c.EveryN = n
+	default:
+		return fmt.Errorf("unknown schedule %s", c.Schedule)
+	}
+
+	hour, minute, err := parseClock(timeArg)
+	if err != nil {
+		return err
+	}
+	c.Hour, c.Minute = hour, minute
+
+	return nil
+}
+
+// parseClock parses HH:MM
+func parseClock(s string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %s, expected HH:MM", s)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// matches checks if the chore is scheduled on the day of t
+func (c Chore) matches(t time.Time) bool {
+	switch c.Schedule {
+	case ScheduleDaily:
+		return true
+	case ScheduleWeekdays:
+		return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+	case ScheduleWeekly:
+		for _, d := range c.Days {
+			if t.Weekday() == d {
+				return true
+			}
+		}
+		return false
+	case ScheduleEvery:
+		if c.EveryN < 1 {
+			return false
+		}
+		start := time.Date(c.Created.Year(), c.Created.Month(), c.Created.Day(), 0, 0, 0, 0, t.Location())
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		days := int(day.Sub(start).Hours()+12) / 24 // rounding protects from DST shifts
+		return days >= 0 && days%c.EveryN == 0
+	}
+	return false
+}
+
+// NextRun returns the first scheduled time strictly after the given one
+func (c Chore) NextRun(after time.Time) time.Time {
+	horizon := 8
+	if c.EveryN+1 > horizon {
+		horizon = c.EveryN + 1
+	}
+
+	for i := 0; i <= horizon; i++ {
+		d := after.AddDate(0, 0, i)
+		candidate := time.Date(d.Year(), d.Month(), d.Day(), c.Hour, c.Minute, 0, 0, after.Location())
+		if candidate.After(after) && c.matches(candidate) {
+			return candidate
+		}
+	}
+
+	return time.Time{}
+}
+
+// Due checks if at least one run was scheduled since the last one (or creation), missed runs are collapsed into one
+func (c Chore) Due(now time.Time) bool {
+	from := c.LastRun
+	if from.IsZero() {
+		from = c.Created
+	}
+	next := c.NextRun(from.In(now.Location()))
+	return !next.IsZero() && !next.After(now)
+}
+
+// SaveChore creates or updates chore, new chores get ID from the bucket sequence
+func (b *BoltDB) SaveChore(c Chore) (Chore, error) {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		return putChore(tx, &c)
+	})
+
+	return c, err
+}
+
+// RunChore creates open task of the chore and records the run at once,
+// so the scheduler never repeats the task or loses the run
+func (b *BoltDB) RunChore(c Chore, t Transaction, now time.Time) (Transaction, error) {
+	t.ID = ""
+	t.Timestamp = time.Now()
+	t.Status = OpenStatus
+	c.LastRun = now
+
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		if err := putTransaction(tx, &t); err != nil {
+			return err
+		}
+		return putChore(tx, &c)
+	})
+
+	return t, err
+}
+
+func putChore(tx *bbolt.Tx, c *Chore) error {
+	bkt := tx.Bucket([]byte(choresBucketName))
+
+	if c.ID == "" {
+		id, _ := bkt.NextSequence()
+		c.ID = fmt.Sprint(id)
+	}
+
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return bkt.Put([]byte(c.ID), buf)
+}
+
+// Chores returns all chores, filtered by parent if parentId is not 0
+func (b *BoltDB) Chores(parentId int64) (chores []Chore, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(choresBucketName))
+
+		return bkt.ForEach(func(k, v []byte) error {
+			var c Chore
+			if err := json.Unmarshal(v, &c); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if parentId == 0 || c.ParentID == parentId {
+				chores = append(chores, c)
+			}
+			return nil
+		})
+	})
+
+	return chores, err
+}
+
+// DeleteChore removes chore created by the parent
+func (b *BoltDB) DeleteChore(parentId int64, id string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(choresBucketName))
+
+		var c Chore
+		if err := b.load(bkt, id, &c); err != nil {
+			return fmt.Errorf("chore %s not found: %w", id, err)
+		}
+		if c.ParentID != parentId {
+			return fmt.Errorf("chore %s belongs to another parent", id)
+		}
+
+		return bkt.Delete([]byte(id))
+	})
+}
+
+// AddChore creates recurring chore for parent's child
+func (am *ActionManager) AddChore(parentId int64, childNickName, op string, scheduleArgs []string) (Chore, error) {
+	childUser, err := am.findOwnChild(parentId, childNickName)
+	if err != nil {
+		return Chore{}, err
+	}
+
+	if _, err = am.db.GetOperationCost(op); err != nil {
+		return Chore{}, fmt.Errorf("unknown operation %s: %w", op, err)
+	}
+
+	c := Chore{ParentID: parentId, ChildID: childUser.ID, Operation: op, Created: time.Now()}
+	if err = ParseChoreSchedule(scheduleArgs, &c); err != nil {
+		return Chore{}, fmt.Errorf("invalid schedule: %w", err)
+	}
+
+	return am.db.SaveChore(c)
+}
+
+// MaterializeChores creates open tasks for all due chores and returns notifications for children.
+// A chore is postponed while the same task is open or the child holds as many tasks as allowed.
+// Failure of one chore is logged and the rest are run anyway.
+func (am *ActionManager) MaterializeChores(now time.Time) ([]Notification, error) {
+	chores, err := am.db.Chores(0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load chores: %w", err)
+	}
+
+	var notifications []Notification
+	for _, c := range chores {
+		if !c.Due(now) {
+			continue
+		}
+
+		err := am.canStartTask(c.ChildID, c.Operation)
+		if errors.Is(err, ErrTaskInProgress) || errors.Is(err, ErrTooManyTasks) {
+			log.Printf("[DEBUG] chore %s postponed for child %d: %v", c.ID, c.ChildID, err)
+			continue
+		}
+		if err != nil {
+			log.Printf("[WARN] unable to check tasks of child %d for chore %s: %+v", c.ChildID, c.ID, err)
+			continue
+		}
+
+		cost, err := am.OperationCost(c.ChildID, c.Operation)
+		if err != nil {
+			log.Printf("[WARN] unable to get cost of chore %s: %+v", c.ID, err)
+			continue
+		}
+		t := Transaction{Operation: c.Operation, Cost: cost, UserId: c.ChildID}
+		if _, err = am.db.RunChore(c, t, now); err != nil {
+			log.Printf("[WARN] unable to run chore %s: %+v", c.ID, err)
+			continue
+		}
+
+		child, err := am.db.FindUser(c.ChildID)
+		if err != nil {
+			log.Printf("[WARN] unable to find child %d of chore %s: %+v", c.ChildID, c.ID, err)
+			continue
+		}
+		notifications = append(notifications, Notification{
+			ChatID: child.ChatID,
+			Text:   "Новое задание по расписанию: " + OperationTitle(c.Operation),
+		})
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestChore_NextRun(t *testing.T) {
+	created := time.Date(2022, 5, 2, 12, 0, 0, 0, time.UTC) // monday
+
+	tbl := []struct {
+		args  []string
+		after time.Time
+		next  time.Time
+	}{
+		{[]string{"daily", "09:00"}, created, time.Date(2022, 5, 3, 9, 0, 0, 0, time.UTC)},
+		{[]string{"daily", "18:30"}, created, time.Date(2022, 5, 2, 18, 30, 0, 0, time.UTC)},
+		{[]string{"weekdays", "09:00"}, time.Date(2022, 5, 6, 10, 0, 0, 0, time.UTC), time.Date(2022, 5, 9, 9, 0, 0, 0, time.UTC)},
+		{[]string{"weekly", "sun,wed", "10:00"}, created, time.Date(2022, 5, 4, 10, 0, 0, 0, time.UTC)},
+		{[]string{"every", "3", "08:00"}, created, time.Date(2022, 5, 5, 8, 0, 0, 0, time.UTC)},
+		{[]string{"every", "3", "08:00"}, time.Date(2022, 5, 5, 8, 0, 0, 0, time.UTC), time.Date(2022, 5, 8, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for i, tt := range tbl {
+		c := Chore{Created: created}
+		require.NoError(t, ParseChoreSchedule(tt.args, &c), "case %d", i)
+		assert.Equal(t, tt.next, c.NextRun(tt.after), "case %d", i)
+	}
+
+	for _, args := range [][]string{{"daily"}, {"hourly", "10:00"}, {"weekly", "xyz", "10:00"}, {"every", "0", "10:00"}, {"daily", "25:00"}} {
+		assert.Error(t, ParseChoreSchedule(args, &Chore{}), "%v", args)
+	}
+}
+
+func TestActionManager_MaterializeChores(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	_, err = am.AddChore(1, "@stranger", OpWalkDog, []string{"daily", "09:00"})
+	assert.Error(t, err)
+	_, err = am.AddChore(1, "@kid", "unknown_op", []string{"daily", "09:00"})
+	assert.Error(t, err)
+
+	c, err := am.AddChore(1, "@kid", OpWalkDog, []string{"daily", "09:00"})
+	require.NoError(t, err)
+	c.Created = time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, err = db.SaveChore(c)
+	require.NoError(t, err)
+
+	// not due yet
+	notifications, err := am.MaterializeChores(time.Date(2022, 5, 2, 8, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, notifications)
+
+	// missed runs are collapsed into one task after downtime
+	notifications, err = am.MaterializeChores(time.Date(2022, 5, 4, 10, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(200), notifications[0].ChatID)
+
+	tasks, err := db.OpenTasks(2)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, OpWalkDog, tasks[0].Operation)
+
+	// next run is postponed while child has an open task
+	notifications, err = am.MaterializeChores(time.Date(2022, 5, 5, 10, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, notifications)
+
+	chores, err := db.Chores(1)
+	require.NoError(t, err)
+	require.Len(t, chores, 1)
+	assert.Equal(t, time.Date(2022, 5, 4, 10, 0, 0, 0, time.UTC), chores[0].LastRun.UTC())
+
+	assert.Error(t, db.DeleteChore(2, c.ID))
+	require.NoError(t, db.DeleteChore(1, c.ID))
+	chores, err = db.Chores(0)
+	require.NoError(t, err)
+	assert.Empty(t, chores)
+}
+
+func TestActionManager_MaterializeChoresSkipsBroken(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "orphan", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	created := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, err = db.SaveChore(Chore{ParentID: 1, ChildID: 3, Operation: OpWalkDog, Schedule: "daily", Hour: 9,
+		Created: created})
+	require.NoError(t, err)
+	_, err = db.SaveChore(Chore{ParentID: 1, ChildID: 2, Operation: OpWalkDog, Schedule: "daily", Hour: 9,
+		Created: created})
+	require.NoError(t, err)
+
+	notifications, err := am.MaterializeChores(time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1, "chore of the child without family doesn't stop others")
+	assert.Equal(t, int64(200), notifications[0].ChatID)
+}
@@ -0,0 +1,49 @@
+package store
+
+import "fmt"
+
+// TaskOperations are built-in tasks children pick themselves, in the order they are shown
+var TaskOperations = []string{OpWalkDog, OpFreeDish, OpDirtyDish, OpGoToShop, OpWashFloorInFlat}
+
+// OperationCost returns cost of the operation in the user's family, default cost is used if not overridden
+func (am *ActionManager) OperationCost(userId int64, op string) (int, error) {
+	settings, err := am.FamilySettings(userId)
+	if err != nil {
+		return 0, err
+	}
+	if cost, ok := settings.Costs[op]; ok {
+		return cost, nil
+	}
+	return am.db.GetOperationCost(op)
+}
+
+// SetOperationCost overrides cost of the built-in operation in parent's family
+func (am *ActionManager) SetOperationCost(parentId int64, op string, cost int) error {
+	if _, err := am.db.GetOperationCost(op); err != nil {
+		return fmt.Errorf("unknown operation %s: %w", op, err)
+	}
+	if cost <= 0 {
+		return fmt.Errorf("cost should be positive, got %d", cost)
+	}
+
+	return am.updateFamilySettings(parentId, func(s *FamilySettings) {
+		if s.Costs == nil {
+			s.Costs = map[string]int{}
+		}
+		s.Costs[op] = cost
+	})
+}
+
+// createTask opens the task for the child with the cost of child's family
+func (am *ActionManager) createTask(childId int64, op string) (*Transaction, error) {
+	cost, err := am.OperationCost(childId, op)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := am.db.CreateTask(Transaction{Operation: op, Cost: cost, UserId: childId})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
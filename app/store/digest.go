@@ -0,0 +1,268 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Digest is parent's schedule of the weekly report, time is local to the bot
+type Digest struct {
+	ParentID int64        `json:"parent_id"`
+	Weekday  time.Weekday `json:"weekday"`
+	Hour     int          `json:"hour"`
+	Minute   int          `json:"minute"`
+	Created  time.Time    `json:"created"`
+}
+
+// WeeklyStats summarizes child's transactions of a week
+type WeeklyStats struct {
+	Completed int // approved tasks
+	Canceled  int // tasks canceled by the child
+	Rejected  int // times parents sent finished tasks back
+	Expired   int // tasks not done before the deadline
+	Earned    int // coins added to the balance
+	Spent     int // coins taken from the balance
+}
+
+// ChildDigest is a section of the weekly digest about one child
+type ChildDigest struct {
+	Child    User
+	Week     WeeklyStats
+	Previous WeeklyStats
+	Balance  int
+	Pending  int // tasks waiting for parent approval
+}
+
+// SaveDigest creates or replaces parent's digest schedule
+func (b *BoltDB) SaveDigest(d Digest) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		buf, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(digestsBucketName)).Put(itob64(d.ParentID), buf)
+	})
+}
+
+// DeleteDigest stops parent's digest
+func (b *BoltDB) DeleteDigest(parentId int64) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(digestsBucketName)).Delete(itob64(parentId))
+	})
+}
+
+// Digests returns schedules of all parents
+func (b *BoltDB) Digests() (digests []Digest, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(digestsBucketName)).ForEach(func(k, v []byte) error {
+			var d Digest
+			if err := json.Unmarshal(v, &d); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			digests = append(digests, d)
+			return nil
+		})
+	})
+
+	return digests, err
+}
+
+// Digest returns parent's digest schedule, false if digest is off
+func (b *BoltDB) Digest(parentId int64) (d Digest, ok bool, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(digestsBucketName)).Get(itob64(parentId))
+		if v == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(v, &d)
+	})
+
+	return d, ok, err
+}
+
+// SetDigest configures weekly digest of the parent, args are week day and time, "off" stops the digest
+func (am *ActionManager) SetDigest(parentId int64, args []string) (Digest, error) {
+	if _, err := am.familyOfParent(parentId); err != nil {
+		return Digest{}, err
+	}
+
+	if len(args) == 1 && args[0] == "off" {
+		return Digest{}, am.db.DeleteDigest(parentId)
+	}
+	if len(args) != 2 {
+		return Digest{}, fmt.Errorf("week day and time are required")
+	}
+
+	d := Digest{ParentID: parentId, Created: time.Now()}
+	day, ok := weekdayNames[strings.ToLower(args[0])]
+	if !ok {
+		return Digest{}, fmt.Errorf("unknown week day %s", args[0])
+	}
+	d.Weekday = day
+
+	var err error
+	if d.Hour, d.Minute, err = parseClock(args[1]); err != nil {
+		return Digest{}, err
+	}
+
+	return d, am.db.SaveDigest(d)
+}
+
+// weeklyStats counts child's transactions created in [from, to)
+func (am *ActionManager) weeklyStats(childId int64, from, to time.Time) (WeeklyStats, error) {
+	var s WeeklyStats
+
+	// coins and completed tasks are counted when posted, so a task approved this week counts here
+	entries, err := am.db.LedgerEntriesForPeriod(childId, from, to)
+	if err != nil {
+		return s, fmt.Errorf("unable to load ledger of %d: %w", childId, err)
+	}
+	for _, e := range entries {
+		if e.Delta > 0 {
+			s.Earned += e.Delta
+		} else {
+			s.Spent -= e.Delta
+		}
+		if e.Reason == KindTask && e.Delta > 0 {
+			s.Completed++
+		}
+	}
+
+	transactions, err := am.db.TransactionsForPeriod(childId, from, to)
+	if err != nil {
+		return s, fmt.Errorf("unable to load transactions of %d: %w", childId, err)
+	}
+	for _, t := range transactions {
+		if t.EffectiveKind() != KindTask {
+			continue
+		}
+		s.Rejected += t.Rejections
+		switch t.Status {
+		case CanceledStatus:
+			s.Canceled++
+		case ExpiredStatus:
+			s.Expired++
+		}
+	}
+	return s, nil
+}
+
+// ParentDigest builds digest of parent's children for the week before `to`, compared with the week before it
+func (am *ActionManager) ParentDigest(parentId int64, to time.Time) ([]ChildDigest, error) {
+	nicks, err := am.db.FindChildren(parentId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find children of %d: %w", parentId, err)
+	}
+
+	from := to.AddDate(0, 0, -7)
+	var digest []ChildDigest
+	for _, nick := range nicks {
+		child, err := am.findOwnChild(parentId, nick)
+		if err != nil {
+			log.Printf("[WARN] skip child %s in digest: %+v", nick, err)
+			continue
+		}
+
+		d := ChildDigest{Child: child}
+		if d.Week, err = am.weeklyStats(child.ID, from, to); err != nil {
+			return nil, err
+		}
+		if d.Previous, err = am.weeklyStats(child.ID, from.AddDate(0, 0, -7), from); err != nil {
+			return nil, err
+		}
+		if d.Balance, err = am.db.Balance(child.ID); err != nil {
+			return nil, fmt.Errorf("unable to get balance of %d: %w", child.ID, err)
+		}
+
+		tasks, err := am.db.OpenTasks(child.ID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load open tasks of %d: %w", child.ID, err)
+		}
+		for _, t := range tasks {
+			if t.Status == PendingStatus {
+				d.Pending++
+			}
+		}
+		digest = append(digest, d)
+	}
+
+	return digest, nil
+}
+
+// SendDigests sends weekly digests scheduled in the current week, each parent gets the digest once per week
+func (am *ActionManager) SendDigests(now time.Time) ([]Notification, error) {
+	digests, err := am.db.Digests()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load digests: %w", err)
+	}
+
+	var notifications []Notification
+	for _, d := range digests {
+		scheduled := weeklyAt(now, d.Weekday, d.Hour, d.Minute)
+		if now.Before(scheduled) || !scheduled.After(d.Created) {
+			continue
+		}
+
+		report, err := am.ParentDigest(d.ParentID, scheduled)
+		if err != nil {
+			log.Printf("[WARN] unable to build digest of %d: %+v", d.ParentID, err)
+			continue
+		}
+		if len(report) == 0 {
+			continue
+		}
+
+		isNew, err := am.db.MarkPeriodicRun(fmt.Sprintf("digest:%d:%s", d.ParentID, periodKey(scheduled)), now)
+		if err != nil {
+			return notifications, fmt.Errorf("unable to mark digest of %d: %w", d.ParentID, err)
+		}
+		if !isNew {
+			continue
+		}
+
+		parent, err := am.db.FindUser(d.ParentID)
+		if err != nil {
+			log.Printf("[WARN] unable to find parent %d: %+v", d.ParentID, err)
+			continue
+		}
+		notifications = append(notifications, Notification{ChatID: parent.ChatID, Text: DigestText(report)})
+	}
+
+	return notifications, nil
+}
+
+// DigestText formats the weekly digest
+func DigestText(report []ChildDigest) string {
+	var sb strings.Builder
+	sb.WriteString("Итоги недели\n")
+	for _, d := range report {
+		sb.WriteString(fmt.Sprintf("\n@%s\n", d.Child.Nickname))
+		sb.WriteString(fmt.Sprintf("Выполнено заданий: %d%s\n", d.Week.Completed,
+			weekChange(d.Week.Completed, d.Previous.Completed)))
+		sb.WriteString(fmt.Sprintf("Отменено: %d, отклонено родителями: %d, просрочено: %d\n",
+			d.Week.Canceled, d.Week.Rejected, d.Week.Expired))
+		sb.WriteString(fmt.Sprintf("Заработано: %d%s\n", d.Week.Earned, weekChange(d.Week.Earned, d.Previous.Earned)))
+		sb.WriteString(fmt.Sprintf("Потрачено: %d%s\n", d.Week.Spent, weekChange(d.Week.Spent, d.Previous.Spent)))
+		sb.WriteString(fmt.Sprintf("Баланс: %d dinocoins\n", d.Balance))
+		if d.Pending > 0 {
+			sb.WriteString(fmt.Sprintf("Ждут подтверждения: %d\n", d.Pending))
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// weekChange describes difference with the previous week
+func weekChange(current, previous int) string {
+	switch {
+	case current > previous:
+		return fmt.Sprintf(" (▲ %d к прошлой неделе)", current-previous)
+	case current < previous:
+		return fmt.Sprintf(" (▼ %d к прошлой неделе)", previous-current)
+	}
+	return " (как на прошлой неделе)"
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"testing"
+	"time"
+)
+
+func TestActionManager_SendDigests(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	_, err = am.SetDigest(2, []string{"sun", "20:00"})
+	assert.Error(t, err, "only parents get digests")
+	_, err = am.SetDigest(1, []string{"sun", "25:00"})
+	assert.Error(t, err)
+
+	now := time.Now()
+	d := Digest{ParentID: 1, Weekday: now.Weekday(), Hour: now.Hour(), Minute: now.Minute(),
+		Created: now.AddDate(0, 0, -14)}
+	require.NoError(t, db.SaveDigest(d))
+
+	for _, tr := range []Transaction{
+		{Operation: OpWalkDog, Cost: 10, UserId: 2, Timestamp: now.AddDate(0, 0, -10)},
+		{Operation: OpWalkDog, Cost: 10, UserId: 2, Timestamp: now.AddDate(0, 0, -2)},
+		{Operation: OpFreeDish, Cost: 5, UserId: 2, Timestamp: now.AddDate(0, 0, -1)},
+		{Operation: KindPenalty, Kind: KindPenalty, Cost: 3, UserId: 2, Timestamp: now.AddDate(0, 0, -1)},
+	} {
+		tr, err = db.PostTransaction(tr)
+		require.NoError(t, err)
+		backdateLedger(t, db, tr.ID, tr.Timestamp)
+	}
+
+	old, err := am.StartTask(2, OpWalkDog)
+	require.NoError(t, err)
+	old.Timestamp = now.AddDate(0, 0, -10)
+	require.NoError(t, db.db.Update(func(tx *bbolt.Tx) error { return saveTransaction(tx, *old) }))
+	_, err = db.ApproveTransaction(2, old.ID)
+	require.NoError(t, err)
+	backdateLedger(t, db, old.ID, now.Add(-time.Hour))
+
+	task, err := am.StartTask(2, OpGoToShop)
+	require.NoError(t, err)
+	task.Timestamp = now.AddDate(0, 0, -1)
+	require.NoError(t, db.db.Update(func(tx *bbolt.Tx) error { return saveTransaction(tx, *task) }))
+	_, err = am.RequestTaskCompletion(2, task.ID)
+	require.NoError(t, err)
+	_, err = am.DecideTask(1, 2, task.ID, false)
+	require.NoError(t, err)
+	_, err = am.RequestTaskCompletion(2, task.ID)
+	require.NoError(t, err)
+
+	report, err := am.ParentDigest(1, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, report, 1)
+	assert.Equal(t, WeeklyStats{Completed: 3, Rejected: 1, Earned: 25, Spent: 3}, report[0].Week,
+		"task started before the week is counted when approved")
+	assert.Equal(t, WeeklyStats{Completed: 1, Earned: 10}, report[0].Previous)
+	assert.Equal(t, 32, report[0].Balance)
+	assert.Equal(t, 1, report[0].Pending)
+
+	notifications, err := am.SendDigests(now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(100), notifications[0].ChatID)
+	assert.Contains(t, notifications[0].Text, "Выполнено заданий: 3 (▲ 2 к прошлой неделе)")
+	assert.Contains(t, notifications[0].Text, "Ждут подтверждения: 1")
+
+	notifications, err = am.SendDigests(now.Add(2 * time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "digest is sent once a week")
+}
+
+// backdateLedger moves postings of the transaction to the past, as if it was approved then
+func backdateLedger(t *testing.T, db *BoltDB, txId string, ts time.Time) {
+	err := db.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(ledgerBucketName))
+		entries := map[string]LedgerEntry{}
+		err := bkt.ForEach(func(k, v []byte) error {
+			var e LedgerEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if e.TxID == txId {
+				e.Timestamp = ts
+				entries[string(k)] = e
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for k, e := range entries {
+			buf, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err = bkt.Put([]byte(k), buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
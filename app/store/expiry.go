@@ -0,0 +1,95 @@
+package store
+
+import (
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"time"
+)
+
+// ExpireTask moves overdue open task to EXPIRED and charges its penalty atomically.
+// Assigned task the child never accepted is DECLINED without penalty instead.
+// Returns the expired task and the penalty transaction, zero if the task has no penalty.
+func (b *BoltDB) ExpireTask(userId int64, txId string, now time.Time) (t, penalty Transaction, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if t, err = getTransaction(tx, userId, txId); err != nil {
+			return err
+		}
+		if t.Status != OpenStatus {
+			return fmt.Errorf("task %s is %s, not open", txId, t.Status)
+		}
+		if t.Deadline.IsZero() || t.Deadline.After(now) {
+			return fmt.Errorf("task %s is not overdue", txId)
+		}
+
+		t.Status = ExpiredStatus
+		if t.AssignedBy != 0 && t.AcceptedAt.IsZero() {
+			t.Status = DeclinedStatus
+		}
+		if err = saveTransaction(tx, t); err != nil {
+			return err
+		}
+
+		if t.Status == DeclinedStatus || t.ExpiryPenalty <= 0 {
+			return nil
+		}
+		penalty, err = postTransaction(tx, Transaction{
+			Timestamp: now,
+			Operation: KindPenalty,
+			Kind:      KindPenalty,
+			Cost:      t.ExpiryPenalty,
+			UserId:    userId,
+			Reason:    "просрочено задание " + OperationTitle(t.Operation),
+			Ref:       t.ID,
+		})
+		return err
+	})
+
+	return t, penalty, err
+}
+
+// ExpireTasks moves open tasks with passed deadline to EXPIRED, charges penalties and notifies children and parents.
+// Tasks waiting for parent approval don't expire, the child has finished them in time.
+// Failure of one task is logged and the rest are expired anyway.
+func (am *ActionManager) ExpireTasks(now time.Time) ([]Notification, error) {
+	open, err := am.db.TransactionsByStatus(OpenStatus)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load open tasks: %w", err)
+	}
+
+	var notifications []Notification
+	for _, task := range open {
+		if task.Deadline.IsZero() || task.Deadline.After(now) {
+			continue
+		}
+
+		t, penalty, err := am.db.ExpireTask(task.UserId, task.ID, now)
+		if err != nil {
+			log.Printf("[WARN] unable to expire task %s of %d: %+v", task.ID, task.UserId, err)
+			continue
+		}
+
+		child, err := am.db.FindUser(t.UserId)
+		if err != nil {
+			log.Printf("[WARN] unable to find child %d of expired task %s: %+v", t.UserId, t.ID, err)
+			continue
+		}
+
+		text := fmt.Sprintf("Срок задания %s истек", OperationTitle(t.Operation))
+		if t.Status == DeclinedStatus {
+			text += ", задание так и не было принято"
+		}
+		if penalty.Cost > 0 {
+			text += fmt.Sprintf(", штраф -%d", penalty.Cost)
+		}
+		notifications = append(notifications, Notification{ChatID: child.ChatID, Text: text})
+
+		parents, err := am.notifyParents(child, "@"+child.Nickname+": "+text)
+		if err != nil {
+			log.Printf("[WARN] unable to notify parents about expired task %s: %+v", t.ID, err)
+		}
+		notifications = append(notifications, parents...)
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestActionManager_ExpireTasks(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	require.NoError(t, am.SetMaxOpenTasks(1, 5))
+
+	now := time.Now()
+	deadline := now.Add(2 * time.Hour)
+	walk, _, err := am.AssignTask(1, []string{"@kid", OpWalkDog, deadline.Format("02.01.2006"),
+		deadline.Format("15:04"), "penalty=5"}, now)
+	require.NoError(t, err)
+	_, err = db.RespondAssignment(2, walk.ID, true)
+	require.NoError(t, err)
+	wash, _, err := am.AssignTask(1, []string{"@kid", OpWashFloorInFlat, deadline.Format("02.01.2006"),
+		deadline.Format("15:04"), "penalty=7"}, now)
+	require.NoError(t, err)
+	shop, _, err := am.AssignTask(1, []string{"@kid", OpGoToShop, deadline.Format("02.01.2006"),
+		deadline.Format("15:04")}, now)
+	require.NoError(t, err)
+	_, err = am.RequestTaskCompletion(2, shop.ID)
+	require.NoError(t, err)
+	_, err = am.StartTask(2, OpFreeDish)
+	require.NoError(t, err)
+
+	notifications, err := am.ExpireTasks(now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "deadline is not reached")
+
+	notifications, err = am.ExpireTasks(now.Add(3 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, notifications, 4, "child and parent are notified about both overdue assignments")
+	assert.Equal(t, int64(200), notifications[0].ChatID)
+	assert.Contains(t, notifications[0].Text, "штраф -5")
+	assert.Equal(t, int64(100), notifications[1].ChatID)
+	assert.Contains(t, notifications[2].Text, "не было принято")
+	assert.NotContains(t, notifications[2].Text, "штраф")
+
+	expired, err := db.GetTransaction(2, walk.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ExpiredStatus, expired.Status)
+
+	declined, err := db.GetTransaction(2, wash.ID)
+	require.NoError(t, err)
+	assert.Equal(t, DeclinedStatus, declined.Status, "task never accepted is not penalized")
+
+	pending, err := db.GetTransaction(2, shop.ID)
+	require.NoError(t, err)
+	assert.Equal(t, PendingStatus, pending.Status, "finished task waits for parent")
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, -5, balance)
+
+	tasks, err := db.OpenTasks(2)
+	require.NoError(t, err)
+	assert.Len(t, tasks, 2)
+
+	notifications, err = am.ExpireTasks(now.Add(4 * time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "expired once")
+}
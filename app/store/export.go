@@ -0,0 +1,155 @@
+package store
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"strconv"
+	"time"
+)
+
+const (
+	ExportCSV  = "csv"
+	ExportJSON = "json"
+
+	PeriodWeek    = "week"
+	PeriodMonth   = "month"
+	PeriodQuarter = "quarter"
+	PeriodYear    = "year"
+	PeriodAll     = "all"
+)
+
+// exportRecord is a single row of exported history
+type exportRecord struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Kind      string    `json:"kind"`
+	Operation string    `json:"operation"`
+	Status    string    `json:"status"`
+	Cost      int       `json:"cost"`
+	Delta     int       `json:"balance_delta"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// TransactionsForPeriod returns user transactions created in [from, to), oldest first
+func (b *BoltDB) TransactionsForPeriod(userId int64, from, to time.Time) (transactions []Transaction, err error) {
+	transactions = []Transaction{}
+
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		userBkt := tx.Bucket(itob64(userId))
+		if userBkt == nil {
+			return nil
+		}
+
+		return userBkt.ForEach(func(k, v []byte) error {
+			transaction := Transaction{}
+			if err := json.Unmarshal(v, &transaction); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+
+			if transaction.Timestamp.Before(from) || !transaction.Timestamp.Before(to) {
+				return nil
+			}
+
+			transactions = append(transactions, transaction)
+			return nil
+		})
+	})
+
+	return transactions, err
+}
+
+// ExportTransactions serializes transactions into CSV or JSON document
+func ExportTransactions(transactions []Transaction, format string) ([]byte, error) {
+	records := make([]exportRecord, 0, len(transactions))
+	for _, t := range transactions {
+		records = append(records, exportRecord{
+			ID:        t.ID,
+			Timestamp: t.Timestamp,
+			Kind:      t.EffectiveKind(),
+			Operation: t.Operation,
+			Status:    t.Status,
+			Cost:      t.Cost,
+			Delta:     t.BalanceDelta(),
+			Reason:    t.Reason,
+		})
+	}
+
+	switch format {
+	case ExportJSON:
+		return json.MarshalIndent(records, "", "  ")
+	case ExportCSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write([]string{"id", "timestamp", "kind", "operation", "status", "cost", "balance_delta", "reason"}); err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			row := []string{r.ID, r.Timestamp.Format(time.RFC3339), r.Kind, r.Operation, r.Status,
+				strconv.Itoa(r.Cost), strconv.Itoa(r.Delta), r.Reason}
+			if err := w.Write(row); err != nil {
+				return nil, err
+			}
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	default:
+		return nil, fmt.Errorf("unknown export format %s", format)
+	}
+}
+
+// periodStart returns beginning of the export or statistics period ending at now
+func periodStart(period string, now time.Time) (time.Time, error) {
+	switch period {
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7), nil
+	case PeriodMonth:
+		return now.AddDate(0, -1, 0), nil
+	case PeriodQuarter:
+		return now.AddDate(0, -3, 0), nil
+	case PeriodYear:
+		return now.AddDate(-1, 0, 0), nil
+	case PeriodAll:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown period %s", period)
+	}
+}
+
+// History returns transactions of parent's child for the given period
+func (am *ActionManager) History(parentId int64, childNickName, period string) (User, []Transaction, error) {
+	childUser, err := am.findOwnChild(parentId, childNickName)
+	if err != nil {
+		return User{}, nil, err
+	}
+
+	now := time.Now()
+	from, err := periodStart(period, now)
+	if err != nil {
+		return User{}, nil, err
+	}
+
+	transactions, err := am.db.TransactionsForPeriod(childUser.ID, from, now.Add(time.Second))
+	if err != nil {
+		return User{}, nil, fmt.Errorf("unable to load transactions: %w", err)
+	}
+	return childUser, transactions, nil
+}
+
+// ExportHistory builds a document with child history for the given period, child must belong to the parent
+func (am *ActionManager) ExportHistory(parentId int64, childNickName, period, format string) (string, []byte, error) {
+	childUser, transactions, err := am.History(parentId, childNickName, period)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := ExportTransactions(transactions, format)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to export transactions: %w", err)
+	}
+
+	fileName := fmt.Sprintf("%s-%s.%s", childUser.Nickname, period, format)
+	return fileName, data, nil
+}
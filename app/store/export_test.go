@@ -0,0 +1,47 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportTransactions(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+
+	userID := int64(1)
+	_, err := db.CreateTransaction(OpWalkDog, userID)
+	require.NoError(t, err)
+	_, err = db.CreateTransaction(OpGoToShop, userID)
+	require.NoError(t, err)
+
+	transactions, err := db.TransactionsForPeriod(userID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, OpWalkDog, transactions[0].Operation)
+
+	empty, err := db.TransactionsForPeriod(userID, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	csvData, err := ExportTransactions(transactions, ExportCSV)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(csvData)), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "id,timestamp,kind,operation,status,cost,balance_delta,reason", lines[0])
+	assert.Contains(t, lines[1], OpWalkDog)
+
+	jsonData, err := ExportTransactions(transactions, ExportJSON)
+	require.NoError(t, err)
+	var records []map[string]interface{}
+	require.NoError(t, json.Unmarshal(jsonData, &records))
+	assert.Len(t, records, 2)
+	assert.Equal(t, OpGoToShop, records[1]["operation"])
+
+	_, err = ExportTransactions(transactions, "xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	GoalActiveStatus    = "ACTIVE"
+	GoalRequestedStatus = "REQUESTED" // child asked parents to buy the goal
+	GoalPurchasedStatus = "PURCHASED"
+	GoalArchivedStatus  = "ARCHIVED" // removed by child
+
+	KindGoal = "goal" // goal purchase transaction
+)
+
+var goalMilestones = []int{25, 50, 75, 100}
+
+// Goal is a child's savings target, goals are stored in goals_<userId> bucket, goalId -> goal struct
+type Goal struct {
+	ID       string    `json:"id"`
+	UserID   int64     `json:"user_id"`
+	Name     string    `json:"name"`
+	Target   int       `json:"target"`
+	Deadline time.Time `json:"deadline"` // zero if goal has no deadline
+	Status   string    `json:"status"`
+	Notified int       `json:"notified"` // last progress milestone child was notified about
+	Created  time.Time `json:"created"`
+	Closed   time.Time `json:"closed"`
+}
+
+// Progress returns percent of the target covered by balance, up to 100
+func (g Goal) Progress(balance int) int {
+	if g.Target <= 0 || balance >= g.Target {
+		return 100
+	}
+	if balance <= 0 {
+		return 0
+	}
+	return balance * 100 / g.Target
+}
+
+// IsOpen checks if the goal is still being saved for
+func (g Goal) IsOpen() bool {
+	return g.Status == GoalActiveStatus || g.Status == GoalRequestedStatus
+}
+
+func goalsBucketName(userId int64) []byte {
+	return []byte("goals_" + strconv.FormatInt(userId, 10))
+}
+
+// SaveGoal creates or updates child's goal, new goals get ID from the bucket sequence
+func (b *BoltDB) SaveGoal(g Goal) (Goal, error) {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		return saveGoal(tx, &g)
+	})
+
+	return g, err
+}
+
+func saveGoal(tx *bbolt.Tx, g *Goal) error {
+	bkt, err := tx.CreateBucketIfNotExists(goalsBucketName(g.UserID))
+	if err != nil {
+		return fmt.Errorf("failed to create goals bucket of %d: %w", g.UserID, err)
+	}
+
+	if g.ID == "" {
+		id, _ := bkt.NextSequence()
+		g.ID = fmt.Sprint(id)
+	}
+
+	buf, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+
+	return bkt.Put([]byte(g.ID), buf)
+}
+
+// Goals returns open goals of the child
+func (b *BoltDB) Goals(userId int64) (goals []Goal, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(goalsBucketName(userId))
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			var g Goal
+			if err := json.Unmarshal(v, &g); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if g.IsOpen() {
+				goals = append(goals, g)
+			}
+			return nil
+		})
+	})
+
+	return goals, err
+}
+
+// GetGoal returns child's goal by id
+func (b *BoltDB) GetGoal(userId int64, goalId string) (g Goal, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(goalsBucketName(userId))
+		if bkt == nil {
+			return fmt.Errorf("goal %s not found", goalId)
+		}
+		return b.load(bkt, goalId, &g)
+	})
+
+	return g, err
+}
+
+// PurchaseGoal deducts goal cost from the balance and closes the goal atomically
+func (b *BoltDB) PurchaseGoal(userId int64, goalId string) (g Goal, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(goalsBucketName(userId))
+		if bkt == nil {
+			return fmt.Errorf("goal %s not found", goalId)
+		}
+		if err := b.load(bkt, goalId, &g); err != nil {
+			return err
+		}
+		if !g.IsOpen() {
+			return fmt.Errorf("goal %s is already closed", goalId)
+		}
+
+		if balance := balanceOf(tx, userId); balance < g.Target {
+			return fmt.Errorf("not enough coins for goal %s: %d of %d", goalId, balance, g.Target)
+		}
+
+		if _, err := postTransaction(tx, Transaction{Operation: KindGoal, Kind: KindGoal, Cost: g.Target,
+			UserId: userId, Reason: g.Name, Ref: g.ID}); err != nil {
+			return err
+		}
+
+		g.Status = GoalPurchasedStatus
+		g.Closed = time.Now()
+		return saveGoal(tx, &g)
+	})
+
+	return g, err
+}
+
+// AddGoal creates a goal for the child, args are name words, target and optional deadline (DD.MM.YYYY)
+func (am *ActionManager) AddGoal(childId int64, args []string) (Goal, error) {
+	g := Goal{UserID: childId, Status: GoalActiveStatus, Created: time.Now()}
+
+	if len(args) > 0 {
+		if deadline, err := time.ParseInLocation("02.01.2006", args[len(args)-1], time.Local); err == nil {
+			g.Deadline = deadline
+			args = args[:len(args)-1]
+		}
+	}
+
+	if len(args) < 2 {
+		return Goal{}, fmt.Errorf("goal name and target are required")
+	}
+
+	target, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || target <= 0 {
+		return Goal{}, fmt.Errorf("invalid goal target %s", args[len(args)-1])
+	}
+	g.Target = target
+	g.Name = strings.Join(args[:len(args)-1], " ")
+
+	balance, err := am.db.Balance(childId)
+	if err != nil {
+		return Goal{}, fmt.Errorf("unable to get balance: %w", err)
+	}
+	// milestones already reached are not announced
+	for _, m := range goalMilestones {
+		if g.Progress(balance) >= m {
+			g.Notified = m
+		}
+	}
+
+	return am.db.SaveGoal(g)
+}
+
+// ArchiveGoal removes child's goal from the list
+func (am *ActionManager) ArchiveGoal(childId int64, goalId string) error {
+	g, err := am.db.GetGoal(childId, goalId)
+	if err != nil {
+		return fmt.Errorf("unable to find goal: %w", err)
+	}
+	if !g.IsOpen() {
+		return fmt.Errorf("goal %s is closed", goalId)
+	}
+
+	g.Status = GoalArchivedStatus
+	g.Closed = time.Now()
+	_, err = am.db.SaveGoal(g)
+	return err
+}
+
+// RequestGoalPurchase asks parents to approve buying a fully saved goal
+func (am *ActionManager) RequestGoalPurchase(childId int64, goalId string) ([]Notification, error) {
+	g, err := am.db.GetGoal(childId, goalId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find goal: %w", err)
+	}
+	if !g.IsOpen() {
+		return nil, fmt.Errorf("goal %s is closed", goalId)
+	}
+
+	balance, err := am.db.Balance(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get balance: %w", err)
+	}
+	if balance < g.Target {
+		return nil, fmt.Errorf("not enough coins for goal %s", goalId)
+	}
+
+	g.Status = GoalRequestedStatus
+	if _, err = am.db.SaveGoal(g); err != nil {
+		return nil, fmt.Errorf("unable to save goal: %w", err)
+	}
+
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find child: %w", err)
+	}
+
+	data := fmt.Sprintf("%d:%s", childId, g.ID)
+	return am.notifyParents(child, fmt.Sprintf("%s накопил на цель «%s» (%d dinocoins). Купить?",
+		child.Nickname, g.Name, g.Target), Button{Text: "Одобрить", Data: "goalok:" + data},
+		Button{Text: "Отклонить", Data: "goalno:" + data})
+}
+
+// ApproveGoalPurchase deducts goal cost from child's balance, or returns goal to saving if approve is false
+func (am *ActionManager) ApproveGoalPurchase(parentId, childId int64, goalId string, approve bool) ([]Notification, error) {
+	child, err := am.findOwnChildById(parentId, childId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !approve {
+		g, err := am.db.GetGoal(childId, goalId)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find goal: %w", err)
+		}
+		if g.Status != GoalRequestedStatus {
+			return nil, fmt.Errorf("goal %s purchase was not requested", goalId)
+		}
+		g.Status = GoalActiveStatus
+		if _, err = am.db.SaveGoal(g); err != nil {
+			return nil, fmt.Errorf("unable to save goal: %w", err)
+		}
+		return []Notification{{ChatID: child.ChatID, Text: "Родители отклонили покупку цели «" + g.Name + "»"}}, nil
+	}
+
+	g, err := am.db.PurchaseGoal(childId, goalId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to purchase goal: %w", err)
+	}
+
+	balance, err := am.db.Balance(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get balance: %w", err)
+	}
+
+	return []Notification{{ChatID: child.ChatID, Text: fmt.Sprintf("Цель «%s» куплена! Списано %d dinocoins, баланс: %d",
+		g.Name, g.Target, balance)}}, nil
+}
+
+// GoalProgressNotifications returns notifications about goal milestones reached since the last check
+func (am *ActionManager) GoalProgressNotifications(childId int64) ([]Notification, error) {
+	goals, err := am.db.Goals(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load goals: %w", err)
+	}
+	if len(goals) == 0 {
+		return nil, nil
+	}
+
+	balance, err := am.db.Balance(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get balance: %w", err)
+	}
+
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find child: %w", err)
+	}
+
+	var notifications []Notification
+	for _, g := range goals {
+		reached := 0
+		for _, m := range goalMilestones {
+			if g.Progress(balance) >= m {
+				reached = m
+			}
+		}
+		if reached <= g.Notified {
+			continue
+		}
+
+		g.Notified = reached
+		if _, err = am.db.SaveGoal(g); err != nil {
+			return notifications, fmt.Errorf("unable to save goal: %w", err)
+		}
+
+		text := fmt.Sprintf("Цель «%s»: накоплено %d%%", g.Name, reached)
+		if reached == 100 {
+			text = fmt.Sprintf("Цель «%s» накоплена! Попроси родителей купить ее в разделе «Мои цели»", g.Name)
+		}
+		notifications = append(notifications, Notification{ChatID: child.ChatID, Text: text})
+	}
+
+	return notifications, nil
+}
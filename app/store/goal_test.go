@@ -0,0 +1,88 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestActionManager_Goals(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	_, err = am.AddGoal(2, []string{"Велосипед"})
+	assert.Error(t, err)
+	_, err = am.AddGoal(2, []string{"Велосипед", "-5"})
+	assert.Error(t, err)
+
+	g, err := am.AddGoal(2, []string{"Новый", "велосипед", "40", "31.12.2030"})
+	require.NoError(t, err)
+	assert.Equal(t, "Новый велосипед", g.Name)
+	assert.Equal(t, 40, g.Target)
+	assert.Equal(t, time.Date(2030, 12, 31, 0, 0, 0, 0, time.Local), g.Deadline)
+
+	// goal can't be bought until saved
+	_, err = am.RequestGoalPurchase(2, g.ID)
+	assert.Error(t, err)
+
+	notifications, err := am.GrantBonus(1, "@kid", 20, "за уборку")
+	require.NoError(t, err)
+	require.Len(t, notifications, 2)
+	assert.Contains(t, notifications[1].Text, "50%")
+
+	// milestone is announced once
+	progress, err := am.GoalProgressNotifications(2)
+	require.NoError(t, err)
+	assert.Empty(t, progress)
+
+	notifications, err = am.GrantBonus(1, "@kid", 25, "за уборку")
+	require.NoError(t, err)
+	require.Len(t, notifications, 2)
+	assert.Contains(t, notifications[1].Text, "накоплена")
+
+	notifications, err = am.RequestGoalPurchase(2, g.ID)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(100), notifications[0].ChatID)
+	require.Len(t, notifications[0].Buttons, 2)
+	assert.Equal(t, "goalok:2:"+g.ID, notifications[0].Buttons[0].Data)
+
+	// rejected purchase returns goal to saving
+	_, err = am.ApproveGoalPurchase(1, 2, g.ID, false)
+	require.NoError(t, err)
+	stored, err := db.GetGoal(2, g.ID)
+	require.NoError(t, err)
+	assert.Equal(t, GoalActiveStatus, stored.Status)
+
+	_, err = am.ApproveGoalPurchase(2, 2, g.ID, true)
+	assert.Error(t, err, "only parent can approve")
+
+	_, err = am.ApproveGoalPurchase(1, 2, g.ID, true)
+	require.NoError(t, err)
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 5, balance)
+
+	goals, err := db.Goals(2)
+	require.NoError(t, err)
+	assert.Empty(t, goals, "purchased goal is archived")
+
+	_, err = am.ApproveGoalPurchase(1, 2, g.ID, true)
+	assert.Error(t, err, "goal can't be purchased twice")
+	assert.Error(t, am.ArchiveGoal(2, g.ID), "purchased goal can't be archived")
+	stored, err = db.GetGoal(2, g.ID)
+	require.NoError(t, err)
+	assert.Equal(t, GoalPurchasedStatus, stored.Status)
+
+	transactions, err := db.ShowLastNTransactions(2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, KindGoal, transactions[0].Kind)
+	assert.Equal(t, -40, transactions[0].BalanceDelta())
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// LinkGroupChat binds the group chat to the family, previous group of the family is unlinked
+func (b *BoltDB) LinkGroupChat(familyId, chatId int64) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		settings, err := familySettings(tx, familyId)
+		if err != nil {
+			return err
+		}
+
+		groups := tx.Bucket([]byte(groupChatsBucketName))
+		if settings.GroupChatID != 0 {
+			if err = groups.Delete(itob64(settings.GroupChatID)); err != nil {
+				return err
+			}
+		}
+		if v := groups.Get(itob64(chatId)); v != nil && int64(binary.BigEndian.Uint64(v)) != familyId {
+			return fmt.Errorf("chat %d is linked to another family", chatId)
+		}
+
+		settings.GroupChatID = chatId
+		if err = putFamilySettings(tx, familyId, settings); err != nil {
+			return err
+		}
+		return groups.Put(itob64(chatId), itob64(familyId))
+	})
+}
+
+// UnlinkGroupChat removes binding of the group chat to the family
+func (b *BoltDB) UnlinkGroupChat(familyId int64) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		settings, err := familySettings(tx, familyId)
+		if err != nil {
+			return err
+		}
+		if settings.GroupChatID == 0 {
+			return nil
+		}
+
+		if err = tx.Bucket([]byte(groupChatsBucketName)).Delete(itob64(settings.GroupChatID)); err != nil {
+			return err
+		}
+		settings.GroupChatID = 0
+		return putFamilySettings(tx, familyId, settings)
+	})
+}
+
+// GroupFamily returns family linked to the group chat, false if the chat is not linked
+func (b *BoltDB) GroupFamily(chatId int64) (familyId int64, ok bool, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(groupChatsBucketName)).Get(itob64(chatId))
+		if v == nil {
+			return nil
+		}
+		familyId, ok = int64(binary.BigEndian.Uint64(v)), true
+		return nil
+	})
+
+	return familyId, ok, err
+}
+
+// LinkGroupChat makes the group chat public channel of parent's family
+func (am *ActionManager) LinkGroupChat(parentId, chatId int64) error {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return err
+	}
+	return am.db.LinkGroupChat(familyId, chatId)
+}
+
+// UnlinkGroupChat stops public announcements of parent's family, the parent must belong to the linked family
+func (am *ActionManager) UnlinkGroupChat(parentId, chatId int64) error {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return err
+	}
+
+	groupFamily, ok, err := am.db.GroupFamily(chatId)
+	if err != nil {
+		return fmt.Errorf("unable to find family of chat %d: %w", chatId, err)
+	}
+	if !ok || groupFamily != familyId {
+		return fmt.Errorf("chat %d is not linked to family %d", chatId, familyId)
+	}
+	return am.db.UnlinkGroupChat(familyId)
+}
+
+// GroupMember maps member of the group chat to the registered user of the linked family
+func (am *ActionManager) GroupMember(chatId, userId int64) (User, error) {
+	familyId, ok, err := am.db.GroupFamily(chatId)
+	if err != nil {
+		return User{}, fmt.Errorf("unable to find family of chat %d: %w", chatId, err)
+	}
+	if !ok {
+		return User{}, fmt.Errorf("chat %d is not linked to a family", chatId)
+	}
+
+	user, err := am.db.FindUser(userId)
+	if err != nil {
+		return User{}, fmt.Errorf("unable to find user %d: %w", userId, err)
+	}
+	userFamily, err := am.FamilyID(userId)
+	if err != nil {
+		return User{}, err
+	}
+	if userFamily != familyId {
+		return User{}, fmt.Errorf("user %d is not a member of family %d", userId, familyId)
+	}
+	return user, nil
+}
+
+// announce builds notification for the family group chat, nothing if the family has no group
+func (am *ActionManager) announce(familyId int64, text string, buttons ...Button) []Notification {
+	settings, err := am.db.FamilySettings(familyId)
+	if err != nil || settings.GroupChatID == 0 {
+		return nil
+	}
+	return []Notification{{ChatID: settings.GroupChatID, Text: text, Buttons: buttons}}
+}
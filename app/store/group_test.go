@@ -0,0 +1,67 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestActionManager_GroupChat(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "sis", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 4, ChatID: 400, Nickname: "neighbour", Type: PARENT}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	require.NoError(t, db.BindChildToParent(1, "@sis"))
+
+	const group = int64(-1000)
+	assert.Error(t, am.LinkGroupChat(2, group), "only parents link groups")
+	require.NoError(t, am.LinkGroupChat(1, group))
+	assert.Error(t, am.LinkGroupChat(4, group), "group belongs to another family")
+
+	member, err := am.GroupMember(group, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "sis", member.Nickname)
+	_, err = am.GroupMember(group, 4)
+	assert.Error(t, err, "not a family member")
+	_, err = am.GroupMember(-2000, 1)
+	assert.Error(t, err, "chat is not linked")
+
+	bt, notifications, err := am.PostBoardTask(1, []string{OpGoToShop})
+	require.NoError(t, err)
+	require.Len(t, notifications, 1, "board task is posted to the group only")
+	assert.Equal(t, group, notifications[0].ChatID)
+	assert.Equal(t, "claim:"+bt.ID, notifications[0].Buttons[0].Data)
+
+	task, notifications, err := am.ClaimBoardTask(2, bt.ID)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, group, notifications[0].ChatID)
+
+	_, err = am.RequestTaskCompletion(2, task.ID)
+	require.NoError(t, err)
+	notifications, err = am.DecideTask(1, 2, task.ID, true)
+	require.NoError(t, err)
+	var public []string
+	for _, n := range notifications {
+		if n.ChatID == group {
+			public = append(public, n.Text)
+		}
+	}
+	assert.Equal(t, []string{"✅ @kid выполнил задание Сходить в магазин, +5 dinocoins",
+		"🎉 @kid получил награду 🌱 Первое задание"}, public)
+
+	assert.Error(t, am.UnlinkGroupChat(4, group))
+	require.NoError(t, am.UnlinkGroupChat(1, group))
+	_, ok, err := db.GroupFamily(group)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	settings, err := am.FamilySettings(1)
+	require.NoError(t, err)
+	assert.Zero(t, settings.GroupChatID)
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// ProcessedTTL is how long processed update and callback ids are kept, Telegram doesn't redeliver older updates
+const ProcessedTTL = 24 * time.Hour
+
+// ErrAlreadyConfirmed is returned when parent confirms a task which is already approved
+var ErrAlreadyConfirmed = errors.New("task already confirmed")
+
+// UpdateKey is an idempotency key of the telegram update
+func UpdateKey(updateId int) string {
+	return fmt.Sprintf("update:%d", updateId)
+}
+
+// CallbackKey is an idempotency key of the callback query
+func CallbackKey(callbackId string) string {
+	return "callback:" + callbackId
+}
+
+// MarkProcessed records the key and reports if it was seen for the first time
+func (b *BoltDB) MarkProcessed(key string, ts time.Time) (isNew bool, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(processedBucketName))
+		if bkt.Get([]byte(key)) != nil {
+			return nil
+		}
+
+		isNew = true
+		return bkt.Put([]byte(key), []byte(ts.Format(time.RFC3339)))
+	})
+
+	return isNew, err
+}
+
+// CleanupProcessed removes keys processed before the given time
+func (b *BoltDB) CleanupProcessed(before time.Time) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return deleteWhere(tx.Bucket([]byte(processedBucketName)), func(_, v []byte) bool {
+			return sentBefore(v, before)
+		})
+	})
+}
+
+// CleanupProcessed is the scheduler job forgetting deliveries Telegram won't repeat anymore,
+// call it with now minus ProcessedTTL
+func (am *ActionManager) CleanupProcessed(before time.Time) error {
+	if err := am.db.CleanupProcessed(before); err != nil {
+		return fmt.Errorf("unable to cleanup processed keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBoltDB_MarkProcessed(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+
+	now := time.Now()
+	isNew, err := db.MarkProcessed(UpdateKey(10), now)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+
+	isNew, err = db.MarkProcessed(UpdateKey(10), now)
+	require.NoError(t, err)
+	assert.False(t, isNew, "redelivered update")
+
+	isNew, err = db.MarkProcessed(CallbackKey("10"), now)
+	require.NoError(t, err)
+	assert.True(t, isNew, "callback keys don't clash with update keys")
+
+	require.NoError(t, db.CleanupProcessed(now.Add(time.Second)))
+	isNew, err = db.MarkProcessed(UpdateKey(10), now)
+	require.NoError(t, err)
+	assert.True(t, isNew, "expired key is forgotten")
+	isNew, err = db.MarkProcessed(CallbackKey("10"), now)
+	require.NoError(t, err)
+	assert.True(t, isNew, "all expired keys are forgotten")
+}
+
+func TestActionManager_ConfirmTwice(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	tr, err := am.StartTask(2, OpWalkDog)
+	require.NoError(t, err)
+	_, err = am.StartTask(2, OpWalkDog)
+	assert.True(t, errors.Is(err, ErrTaskInProgress))
+
+	_, err = am.RequestTaskCompletion(2, tr.ID)
+	require.NoError(t, err)
+	_, err = am.DecideTask(1, 2, tr.ID, true)
+	require.NoError(t, err)
+	notifications, err := am.DecideTask(1, 2, tr.ID, true)
+	assert.True(t, errors.Is(err, ErrAlreadyConfirmed))
+	assert.Empty(t, notifications)
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, defaultWalkDogCost, balance, "coins credited once")
+}
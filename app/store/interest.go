@@ -0,0 +1,170 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"time"
+)
+
+const KindInterest = "interest" // weekly interest on saved coins
+
+const snapshotDateFormat = "2006-01-02"
+
+// Users returns all registered users
+func (b *BoltDB) Users() (users []User, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(usersBucketName)).ForEach(func(k, v []byte) error {
+			var u User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			users = append(users, u)
+			return nil
+		})
+	})
+
+	return users, err
+}
+
+// SaveBalanceSnapshot records current user balance as the balance at the end of the day
+func (b *BoltDB) SaveBalanceSnapshot(userId int64, day time.Time) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		key := append(itob64(userId), []byte(day.Format(snapshotDateFormat))...)
+		return tx.Bucket([]byte(snapshotsBucketName)).Put(key, itob(balanceOf(tx, userId)))
+	})
+}
+
+// BalanceSnapshots returns user's daily balances for days in [from, to), day -> balance
+func (b *BoltDB) BalanceSnapshots(userId int64, from, to time.Time) (snapshots map[string]int, err error) {
+	snapshots = map[string]int{}
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		prefix := itob64(userId)
+		fromKey := append(itob64(userId), []byte(from.Format(snapshotDateFormat))...)
+		toKey := append(itob64(userId), []byte(to.Format(snapshotDateFormat))...)
+
+		c := tx.Bucket([]byte(snapshotsBucketName)).Cursor()
+		for k, v := c.Seek(fromKey); k != nil && bytes.HasPrefix(k, prefix) && bytes.Compare(k, toKey) < 0; k, v = c.Next() {
+			snapshots[string(k[len(prefix):])] = int(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+
+	return snapshots, err
+}
+
+// SetInterest configures weekly interest of the parent's family, zero percent disables it
+func (am *ActionManager) SetInterest(parentId int64, percent, maxInterest int) error {
+	if percent < 0 || percent > 100 || maxInterest < 0 {
+		return fmt.Errorf("invalid interest %d%% capped by %d", percent, maxInterest)
+	}
+
+	return am.updateFamilySettings(parentId, func(s *FamilySettings) {
+		s.InterestPercent = percent
+		s.InterestCap = maxInterest
+	})
+}
+
+// SnapshotBalances records balance of every child at the end of yesterday, the first run of the day takes it.
+// Recorded days are kept, so later runs and restarts don't overwrite them.
+func (am *ActionManager) SnapshotBalances(now time.Time) error {
+	users, err := am.db.Users()
+	if err != nil {
+		return fmt.Errorf("unable to load users: %w", err)
+	}
+
+	day := dayStart(now).AddDate(0, 0, -1)
+	for _, u := range users {
+		if u.Type != CHILD {
+			continue
+		}
+
+		recorded, err := am.db.BalanceSnapshots(u.ID, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return fmt.Errorf("unable to load balance snapshots of %d: %w", u.ID, err)
+		}
+		if len(recorded) > 0 {
+			continue
+		}
+		if err = am.db.SaveBalanceSnapshot(u.ID, day); err != nil {
+			return fmt.Errorf("unable to save balance snapshot of %d: %w", u.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// PayInterest credits interest for the previous week to children of families with interest enabled.
+// Interest is calculated from the average of daily balance snapshots, rounded down and capped.
+func (am *ActionManager) PayInterest(now time.Time) ([]Notification, error) {
+	users, err := am.db.Users()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load users: %w", err)
+	}
+
+	to := WeekStart(now)
+	from := to.AddDate(0, 0, -7)
+	period := periodKey(from)
+
+	var notifications []Notification
+	for _, u := range users {
+		if u.Type != CHILD {
+			continue
+		}
+
+		settings, err := am.FamilySettings(u.ID)
+		if err != nil {
+			log.Printf("[WARN] unable to load family settings of %d: %+v", u.ID, err)
+			continue
+		}
+		if settings.InterestPercent == 0 {
+			continue
+		}
+
+		snapshots, err := am.db.BalanceSnapshots(u.ID, from, to)
+		if err != nil {
+			return notifications, fmt.Errorf("unable to load balance snapshots of %d: %w", u.ID, err)
+		}
+		if len(snapshots) == 0 {
+			continue
+		}
+
+		total := 0
+		for _, balance := range snapshots {
+			total += balance
+		}
+		average := total / len(snapshots)
+
+		interest := average * settings.InterestPercent / 100
+		if settings.InterestCap > 0 && interest > settings.InterestCap {
+			interest = settings.InterestCap
+		}
+		if interest <= 0 {
+			continue
+		}
+
+		key := fmt.Sprintf("%s:%d:%s", KindInterest, u.ID, period)
+		posted, err := am.db.PostPeriodicTransaction(key, Transaction{Operation: KindInterest, Kind: KindInterest,
+			Cost: interest, UserId: u.ID, Reason: "Проценты " + period, Ref: period})
+		if err != nil {
+			return notifications, fmt.Errorf("unable to pay interest to %d: %w", u.ID, err)
+		}
+		if !posted {
+			continue
+		}
+
+		text := fmt.Sprintf("Проценты за неделю: +%d dinocoins.\nСредний баланс за неделю %d, ставка %d%%",
+			interest, average, settings.InterestPercent)
+		if interest == settings.InterestCap {
+			text += fmt.Sprintf(", но не больше %d", settings.InterestCap)
+		}
+		text += ". Чем больше копишь, тем больше получаешь!"
+		notifications = append(notifications, Notification{ChatID: u.ChatID, Text: text})
+		notifications = am.withGoalProgress(notifications, u.ID)
+	}
+
+	return notifications, nil
+}
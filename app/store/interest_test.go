@@ -0,0 +1,74 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestActionManager_PayInterest(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	assert.Error(t, am.SetInterest(2, 10, 0), "only parent can set interest")
+	assert.Error(t, am.SetInterest(1, 101, 0))
+	require.NoError(t, am.SetInterest(1, 10, 0))
+
+	// balance is 1000 on monday only and 0 for the rest of the week, average is used, not the last value.
+	// The day is recorded by the first run of the next day.
+	monday := time.Date(2022, 5, 2, 0, 1, 0, 0, time.Local)
+	_, err = db.ChangeBalance(2, 1000)
+	require.NoError(t, err)
+	require.NoError(t, am.SnapshotBalances(monday.AddDate(0, 0, 1)))
+	_, err = db.ChangeBalance(2, -1000)
+	require.NoError(t, err)
+	for i := 2; i <= 7; i++ {
+		require.NoError(t, am.SnapshotBalances(monday.AddDate(0, 0, i)))
+	}
+	_, err = db.ChangeBalance(2, 5000)
+	require.NoError(t, err)
+	require.NoError(t, am.SnapshotBalances(monday.AddDate(0, 0, 7).Add(time.Hour)), "restart later that day")
+
+	snapshots, err := db.BalanceSnapshots(2, WeekStart(monday), WeekStart(monday).AddDate(0, 0, 7))
+	require.NoError(t, err)
+	assert.Len(t, snapshots, 7)
+	assert.Equal(t, 1000, snapshots["2022-05-02"])
+	assert.Equal(t, 0, snapshots["2022-05-08"], "recorded day is not overwritten")
+
+	notifications, err := am.PayInterest(monday)
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "no snapshots for the previous week")
+
+	nextMonday := monday.AddDate(0, 0, 7)
+	notifications, err = am.PayInterest(nextMonday)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Contains(t, notifications[0].Text, "+14 dinocoins") // 1000/7 = 142, 10% rounded down
+
+	notifications, err = am.PayInterest(nextMonday.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "interest is paid once a week")
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 5014, balance)
+
+	// cap
+	require.NoError(t, am.SetInterest(1, 10, 5))
+	require.NoError(t, am.SnapshotBalances(nextMonday.AddDate(0, 0, 1)))
+	notifications, err = am.PayInterest(nextMonday.AddDate(0, 0, 7))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Contains(t, notifications[0].Text, "+5 dinocoins")
+
+	transactions, err := db.ShowLastNTransactions(2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, KindInterest, transactions[0].Kind)
+}
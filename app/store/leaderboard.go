@@ -0,0 +1,346 @@
+package store
+
+import (
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// competitionSummaryHour is when the weekly competition ends on Sunday
+const competitionSummaryHour = 19
+
+// prizeRefPrefix marks prize bonuses, they don't count in the next standings
+const prizeRefPrefix = "competition:"
+
+// Standing is child's result in the family leaderboard
+type Standing struct {
+	Child  User
+	Coins  int // earned with tasks and bonuses during the period
+	Tasks  int // completed tasks during the period
+	Streak int // days in a row with a completed task
+}
+
+// MarkPeriodicRun records the key of a periodic job which doesn't post transactions.
+// Returns false if the key was recorded before.
+func (b *BoltDB) MarkPeriodicRun(key string, ts time.Time) (isNew bool, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(periodicRunsBucketName))
+		if bkt.Get([]byte(key)) != nil {
+			return nil
+		}
+
+		isNew = true
+		return bkt.Put([]byte(key), []byte(ts.Format(time.RFC3339)))
+	})
+
+	return isNew, err
+}
+
+// PeriodicRunDone checks if the key of a periodic job was recorded
+func (b *BoltDB) PeriodicRunDone(key string) (done bool, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		done = tx.Bucket([]byte(periodicRunsBucketName)).Get([]byte(key)) != nil
+		return nil
+	})
+
+	return done, err
+}
+
+// FinishCompetition posts prizes by their periodic keys and records the family run in one transaction.
+// Returns false and posts nothing if the run was recorded before.
+func (b *BoltDB) FinishCompetition(key string, ts time.Time, prizes map[string]Transaction) (isNew bool, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(periodicRunsBucketName))
+		if bkt.Get([]byte(key)) != nil {
+			return nil
+		}
+
+		for prizeKey, t := range prizes {
+			if bkt.Get([]byte(prizeKey)) != nil {
+				continue
+			}
+			stored, err := postTransaction(tx, t)
+			if err != nil {
+				return fmt.Errorf("unable to post prize of %d: %w", t.UserId, err)
+			}
+			if err = bkt.Put([]byte(prizeKey), []byte(stored.ID)); err != nil {
+				return err
+			}
+		}
+
+		isNew = true
+		return bkt.Put([]byte(key), []byte(ts.Format(time.RFC3339)))
+	})
+
+	return isNew, err
+}
+
+// SetCompetitionPrize enables weekly competition with the prize for the winner, zero prize disables it
+func (am *ActionManager) SetCompetitionPrize(parentId int64, prize int) error {
+	if prize < 0 {
+		return fmt.Errorf("prize should not be negative, got %d", prize)
+	}
+
+	return am.updateFamilySettings(parentId, func(s *FamilySettings) {
+		s.CompetitionPrize = prize
+	})
+}
+
+// Leaderboard ranks children of the user's family by coins earned in [from, to), then by completed tasks
+func (am *ActionManager) Leaderboard(userId int64, from, to time.Time) ([]Standing, error) {
+	familyId, err := am.FamilyID(userId)
+	if err != nil {
+		return nil, err
+	}
+	return am.familyLeaderboard(familyId, from, to)
+}
+
+func (am *ActionManager) familyLeaderboard(familyId int64, from, to time.Time) ([]Standing, error) {
+	children, err := am.familyChildren(familyId)
+	if err != nil {
+		return nil, err
+	}
+
+	standings := make([]Standing, 0, len(children))
+	for _, child := range children {
+		s, err := am.standing(child, from, to)
+		if err != nil {
+			return nil, err
+		}
+		standings = append(standings, s)
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Coins != standings[j].Coins {
+			return standings[i].Coins > standings[j].Coins
+		}
+		return standings[i].Tasks > standings[j].Tasks
+	})
+	return standings, nil
+}
+
+// standing sums approved tasks and bonuses of the period, streak is counted back from the end of the period
+func (am *ActionManager) standing(child User, from, to time.Time) (Standing, error) {
+	s := Standing{Child: child}
+
+	// postings are counted when coins were received, a task started before the week and approved in it counts
+	entries, err := am.db.LedgerEntriesForPeriod(child.ID, from, to)
+	if err != nil {
+		return s, fmt.Errorf("unable to load ledger of %d: %w", child.ID, err)
+	}
+	for _, e := range entries {
+		switch e.Reason {
+		case KindTask:
+			if e.Delta > 0 {
+				s.Coins += e.Delta
+				s.Tasks++
+			}
+		case KindBonus:
+			if !strings.HasPrefix(e.Ref, prizeRefPrefix) && !strings.HasPrefix(e.Ref, badgeRefPrefix) {
+				s.Coins += e.Delta
+			}
+		}
+	}
+
+	if s.Streak, err = am.taskStreak(child.ID, to); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// taskStreak returns number of days in a row with an approved task, ending on the day of `to`.
+// Days are taken from the task postings, so a task counts on the day it was approved.
+// The day of `to` doesn't break the streak until it is over.
+func (am *ActionManager) taskStreak(childId int64, to time.Time) (int, error) {
+	const maxStreak = 366
+
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location()).AddDate(0, 0, 1)
+	entries, err := am.db.LedgerEntriesForPeriod(childId, end.AddDate(0, 0, -maxStreak-1), end)
+	if err != nil {
+		return 0, fmt.Errorf("unable to load ledger of %d: %w", childId, err)
+	}
+
+	days := map[string]bool{}
+	for _, e := range entries {
+		if e.Reason == KindTask && e.Delta > 0 {
+			days[e.Timestamp.In(to.Location()).Format(snapshotDateFormat)] = true
+		}
+	}
+
+	day := end.AddDate(0, 0, -1)
+	if !days[day.Format(snapshotDateFormat)] {
+		day = day.AddDate(0, 0, -1)
+	}
+	streak := 0
+	for streak < maxStreak && days[day.Format(snapshotDateFormat)] {
+		streak++
+		day = day.AddDate(0, 0, -1)
+	}
+	return streak, nil
+}
+
+// familyChildren returns registered children of the family
+func (am *ActionManager) familyChildren(familyId int64) ([]User, error) {
+	nicks, err := am.db.FindChildren(familyId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find children of %d: %w", familyId, err)
+	}
+
+	var children []User
+	for _, nick := range nicks {
+		child, err := am.db.FindUserByNickname(strings.TrimPrefix(nick, "@"))
+		if err != nil || child.ID == 0 {
+			continue
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// families returns ids of all families with children
+func (am *ActionManager) families() ([]int64, error) {
+	users, err := am.db.Users()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load users: %w", err)
+	}
+
+	seen := map[int64]bool{}
+	var families []int64
+	for _, u := range users {
+		if u.Type != CHILD {
+			continue
+		}
+		familyId, err := am.FamilyID(u.ID)
+		if err != nil {
+			log.Printf("[WARN] unable to find family of %d: %+v", u.ID, err)
+			continue
+		}
+		if !seen[familyId] {
+			seen[familyId] = true
+			families = append(families, familyId)
+		}
+	}
+	return families, nil
+}
+
+// FinishCompetitions sends the weekly leaderboard to families on Sunday evening, winners of the enabled
+// competition get the prize as a bonus. Standings are fixed at the end of the competition,
+// each family gets the summary and the prizes once per week.
+func (am *ActionManager) FinishCompetitions(now time.Time) ([]Notification, error) {
+	if now.Weekday() != time.Sunday || now.Hour() < competitionSummaryHour {
+		return nil, nil
+	}
+
+	families, err := am.families()
+	if err != nil {
+		return nil, err
+	}
+
+	from := WeekStart(now)
+	to := time.Date(now.Year(), now.Month(), now.Day(), competitionSummaryHour, 0, 0, 0, now.Location())
+	period := periodKey(from)
+
+	var notifications []Notification
+	for _, familyId := range families {
+		key := fmt.Sprintf("competition:%d:%s", familyId, period)
+		done, err := am.db.PeriodicRunDone(key)
+		if err != nil {
+			return notifications, fmt.Errorf("unable to check competition of %d: %w", familyId, err)
+		}
+		if done {
+			continue
+		}
+
+		standings, err := am.familyLeaderboard(familyId, from, to)
+		if err != nil {
+			return notifications, err
+		}
+		if len(standings) == 0 {
+			continue
+		}
+
+		settings, err := am.db.FamilySettings(familyId)
+		if err != nil {
+			return notifications, fmt.Errorf("unable to load family settings: %w", err)
+		}
+
+		var winners []Standing
+		if settings.CompetitionPrize > 0 {
+			winners = competitionWinners(standings)
+		}
+		prizes := map[string]Transaction{}
+		for _, w := range winners {
+			prizes[fmt.Sprintf("prize:%d:%s", w.Child.ID, period)] = Transaction{Operation: KindBonus, Kind: KindBonus,
+				Cost: settings.CompetitionPrize, UserId: w.Child.ID, Reason: "Приз за победу в соревновании недели",
+				Ref: prizeRefPrefix + period}
+		}
+
+		isNew, err := am.db.FinishCompetition(key, now, prizes)
+		if err != nil {
+			return notifications, fmt.Errorf("unable to finish competition of %d: %w", familyId, err)
+		}
+		if !isNew {
+			continue
+		}
+
+		text := competitionSummary(standings, winners, settings.CompetitionPrize)
+		notifications = append(notifications, am.notifyFamily(familyId, text)...)
+		for _, w := range winners {
+			notifications = am.withGoalProgress(notifications, w.Child.ID)
+		}
+	}
+
+	return notifications, nil
+}
+
+// competitionWinners returns leaders of the standings, nobody wins if nothing was earned
+func competitionWinners(standings []Standing) []Standing {
+	var winners []Standing
+	for _, s := range standings {
+		if s.Coins == 0 || s.Coins != standings[0].Coins || s.Tasks != standings[0].Tasks {
+			break
+		}
+		winners = append(winners, s)
+	}
+	return winners
+}
+
+func competitionSummary(standings, winners []Standing, prize int) string {
+	var sb strings.Builder
+	sb.WriteString("Итоги недели:\n")
+	for i, s := range standings {
+		sb.WriteString(fmt.Sprintf("%d. @%s - %d dinocoins, заданий %d", i+1, s.Child.Nickname, s.Coins, s.Tasks))
+		if s.Streak > 1 {
+			sb.WriteString(fmt.Sprintf(", %d дн. подряд", s.Streak))
+		}
+		sb.WriteString("\n")
+	}
+	for _, w := range winners {
+		sb.WriteString(fmt.Sprintf("\n🏆 @%s побеждает и получает приз %d dinocoins", w.Child.Nickname, prize))
+	}
+	return sb.String()
+}
+
+// notifyFamily posts the notification to the family group chat, or builds it for all parents and children
+// of the family if there is no group
+func (am *ActionManager) notifyFamily(familyId int64, text string) []Notification {
+	if group := am.announce(familyId, text); group != nil {
+		return group
+	}
+
+	notifications := am.notifyChildren(familyId, 0, text)
+
+	children, err := am.familyChildren(familyId)
+	if err != nil || len(children) == 0 {
+		log.Printf("[WARN] unable to find children of family %d: %+v", familyId, err)
+		return notifications
+	}
+	parents, err := am.notifyParents(children[0], text)
+	if err != nil {
+		log.Printf("[WARN] unable to notify parents of family %d: %+v", familyId, err)
+	}
+	return append(notifications, parents...)
+}
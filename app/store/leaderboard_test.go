@@ -0,0 +1,137 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bbolt "go.etcd.io/bbolt"
+	"testing"
+	"time"
+)
+
+func TestActionManager_FinishCompetitions(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "sis", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	require.NoError(t, db.BindChildToParent(1, "@sis"))
+	require.NoError(t, am.SetCompetitionPrize(1, 20))
+
+	now := time.Now()
+	for _, op := range []string{OpWalkDog, OpFreeDish} {
+		task, err := am.StartTask(3, op)
+		require.NoError(t, err)
+		_, err = db.ApproveTransaction(3, task.ID)
+		require.NoError(t, err)
+	}
+	task, err := am.StartTask(2, OpWalkDog)
+	require.NoError(t, err)
+	_, err = db.ApproveTransaction(2, task.ID)
+	require.NoError(t, err)
+	_, err = am.GrantBonus(1, "@kid", 5, "помог бабушке")
+	require.NoError(t, err)
+
+	standings, err := am.Leaderboard(2, WeekStart(now), now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, standings, 2)
+	assert.Equal(t, "sis", standings[0].Child.Nickname)
+	assert.Equal(t, 2, standings[0].Tasks)
+	assert.Equal(t, 1, standings[0].Streak)
+	assert.Equal(t, 15, standings[1].Coins, "bonus counts as earned coins")
+
+	sunday := WeekStart(now).AddDate(0, 0, 6)
+	notifications, err := am.FinishCompetitions(sunday.Add(10 * time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "competition ends in the evening")
+
+	evening := sunday.Add(20 * time.Hour)
+	notifications, err = am.FinishCompetitions(evening)
+	require.NoError(t, err)
+	require.Len(t, notifications, 3, "both children and the parent get the summary")
+	assert.Contains(t, notifications[0].Text, "@sis побеждает")
+
+	balance, err := db.Balance(3)
+	require.NoError(t, err)
+	assert.Equal(t, 15+20, balance, "tasks and the prize")
+
+	notifications, err = am.FinishCompetitions(evening.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "summary is sent once a week")
+	balance, err = db.Balance(3)
+	require.NoError(t, err)
+	assert.Equal(t, 35, balance)
+
+	standings, err = am.Leaderboard(3, WeekStart(now), evening.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 15, standings[0].Coins, "prize doesn't count in standings")
+}
+
+func TestActionManager_LeaderboardByApproval(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	now := time.Now()
+	task, err := am.StartTask(2, OpWalkDog)
+	require.NoError(t, err)
+	task.Timestamp = WeekStart(now).AddDate(0, 0, -2)
+	require.NoError(t, db.db.Update(func(tx *bbolt.Tx) error { return saveTransaction(tx, *task) }))
+	_, err = db.ApproveTransaction(2, task.ID)
+	require.NoError(t, err)
+
+	standings, err := am.Leaderboard(2, WeekStart(now), now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, standings, 1)
+	assert.Equal(t, 1, standings[0].Tasks, "task started last week is approved this week")
+	assert.Equal(t, 10, standings[0].Coins)
+
+	standings, err = am.Leaderboard(2, WeekStart(now).AddDate(0, 0, -7), WeekStart(now))
+	require.NoError(t, err)
+	assert.Equal(t, 0, standings[0].Tasks)
+	assert.Equal(t, 0, standings[0].Coins)
+}
+
+func TestActionManager_FinishCompetitionsOnce(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "sis", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	require.NoError(t, db.BindChildToParent(1, "@sis"))
+	require.NoError(t, am.SetCompetitionPrize(1, 20))
+
+	_, err = am.GrantBonus(1, "@sis", 10, "помогла с уборкой")
+	require.NoError(t, err)
+
+	evening := WeekStart(time.Now()).AddDate(0, 0, 6).Add(20 * time.Hour)
+	notifications, err := am.FinishCompetitions(evening)
+	require.NoError(t, err)
+	require.Len(t, notifications, 3)
+	assert.Contains(t, notifications[0].Text, "@sis побеждает")
+
+	_, err = am.GrantBonus(1, "@kid", 50, "починил велосипед")
+	require.NoError(t, err)
+	notifications, err = am.FinishCompetitions(evening.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "new leader after the summary changes nothing")
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 50, balance, "no prize for the late leader")
+	balance, err = db.Balance(3)
+	require.NoError(t, err)
+	assert.Equal(t, 10+20, balance)
+}
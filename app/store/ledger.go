@@ -0,0 +1,276 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	userAccountPrefix   = "user:"
+	systemAccountPrefix = "system:"
+
+	ReasonOpening    = "opening"    // balance existed before the ledger was introduced
+	ReasonAdjustment = "adjustment" // direct balance change
+)
+
+// LedgerEntry is an immutable record of the ledger. Every posting consists of two entries with the same
+// posting id and opposite deltas: one for the user account and one for the system account coins came from.
+type LedgerEntry struct {
+	ID        uint64    `json:"id"`
+	PostingID uint64    `json:"posting_id"`
+	Account   string    `json:"account"`
+	Delta     int       `json:"delta"`
+	Reason    string    `json:"reason"`          // transaction kind or ReasonOpening, ReasonAdjustment
+	TxID      string    `json:"tx_id,omitempty"` // user transaction the posting belongs to
+	Ref       string    `json:"ref,omitempty"`   // related task, withdrawal, purchase etc.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Mismatch is a difference between cached balance and the balance derived from the ledger
+type Mismatch struct {
+	UserID int64
+	Cached int
+	Ledger int
+}
+
+func userAccount(userId int64) string {
+	return userAccountPrefix + strconv.FormatInt(userId, 10)
+}
+
+// posting describes balance change to be recorded in the ledger
+type posting struct {
+	userId int64
+	delta  int
+	reason string
+	txId   string
+	ref    string
+}
+
+// changeBalance records posting in the ledger and updates cached user balance within the transaction
+func changeBalance(tx *bbolt.Tx, p posting) (int, error) {
+	if p.delta != 0 {
+		if err := appendLedger(tx, p, time.Now()); err != nil {
+			return 0, err
+		}
+	}
+
+	val := balanceOf(tx, p.userId) + p.delta
+	if err := tx.Bucket([]byte(balanceBucketName)).Put(itob64(p.userId), itob(val)); err != nil {
+		return 0, fmt.Errorf("failed to update balance of %d: %w", p.userId, err)
+	}
+	return val, nil
+}
+
+func appendLedger(tx *bbolt.Tx, p posting, ts time.Time) error {
+	bkt := tx.Bucket([]byte(ledgerBucketName))
+
+	postingId, _ := bkt.NextSequence()
+	entries := []LedgerEntry{
+		{Account: userAccount(p.userId), Delta: p.delta},
+		{Account: systemAccountPrefix + p.reason, Delta: -p.delta},
+	}
+
+	for _, e := range entries {
+		e.ID, _ = bkt.NextSequence()
+		e.PostingID = postingId
+		e.Reason = p.reason
+		e.TxID = p.txId
+		e.Ref = p.ref
+		e.Timestamp = ts
+
+		buf, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err = bkt.Put(itob64(int64(e.ID)), buf); err != nil {
+			return fmt.Errorf("failed to append ledger entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ledgerBalances derives balances of all user accounts from the ledger
+func ledgerBalances(tx *bbolt.Tx) (map[int64]int, error) {
+	balances := map[int64]int{}
+	err := tx.Bucket([]byte(ledgerBucketName)).ForEach(func(k, v []byte) error {
+		var e LedgerEntry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal: %w", err)
+		}
+		if !strings.HasPrefix(e.Account, userAccountPrefix) {
+			return nil
+		}
+
+		userId, err := strconv.ParseInt(strings.TrimPrefix(e.Account, userAccountPrefix), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ledger account %s: %w", e.Account, err)
+		}
+		balances[userId] += e.Delta
+		return nil
+	})
+
+	return balances, err
+}
+
+// LedgerEntries returns ledger entries of the user account, oldest first
+func (b *BoltDB) LedgerEntries(userId int64) (entries []LedgerEntry, err error) {
+	account := userAccount(userId)
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(ledgerBucketName)).ForEach(func(k, v []byte) error {
+			var e LedgerEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if e.Account == account {
+				entries = append(entries, e)
+			}
+			return nil
+		})
+	})
+
+	return entries, err
+}
+
+// LedgerEntriesForPeriod returns entries of the user account posted within [from, to), oldest first.
+// Ledger is append-only, so it is scanned from the end until the period starts.
+func (b *BoltDB) LedgerEntriesForPeriod(userId int64, from, to time.Time) (entries []LedgerEntry, err error) {
+	account := userAccount(userId)
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket([]byte(ledgerBucketName)).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var e LedgerEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if e.Timestamp.Before(from) {
+				break
+			}
+			if e.Account == account && e.Timestamp.Before(to) {
+				entries = append(entries, e)
+			}
+		}
+		return nil
+	})
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, err
+}
+
+// LedgerBalance returns user balance derived from the ledger
+func (b *BoltDB) LedgerBalance(userId int64) (balance int, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		balances, err := ledgerBalances(tx)
+		balance = balances[userId]
+		return err
+	})
+
+	return balance, err
+}
+
+// Reconcile compares cached balances with the ledger and returns mismatches
+func (b *BoltDB) Reconcile() (mismatches []Mismatch, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		balances, err := ledgerBalances(tx)
+		if err != nil {
+			return err
+		}
+
+		// accounts present in the cache only
+		err = tx.Bucket([]byte(balanceBucketName)).ForEach(func(k, v []byte) error {
+			userId := int64(binary.BigEndian.Uint64(k))
+			if _, ok := balances[userId]; !ok {
+				balances[userId] = 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for userId, ledger := range balances {
+			if cached := balanceOf(tx, userId); cached != ledger {
+				mismatches = append(mismatches, Mismatch{UserID: userId, Cached: cached, Ledger: ledger})
+			}
+		}
+		return nil
+	})
+
+	return mismatches, err
+}
+
+// RebuildBalances replaces cached balances with the ones derived from the ledger
+func (b *BoltDB) RebuildBalances() error {
+	return b.db.Update(rebuildBalances)
+}
+
+// rebuildBalances recreates balance cache as the projection of the ledger
+func rebuildBalances(tx *bbolt.Tx) error {
+	balances, err := ledgerBalances(tx)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.DeleteBucket([]byte(balanceBucketName)); err != nil {
+		return fmt.Errorf("failed to drop balance cache: %w", err)
+	}
+	bkt, err := tx.CreateBucket([]byte(balanceBucketName))
+	if err != nil {
+		return fmt.Errorf("failed to create balance cache: %w", err)
+	}
+
+	for userId, balance := range balances {
+		if err = bkt.Put(itob64(userId), itob(balance)); err != nil {
+			return fmt.Errorf("failed to update balance of %d: %w", userId, err)
+		}
+	}
+	return nil
+}
+
+// migrateLedger records opening entries for balances existing before the ledger was introduced
+func migrateLedger(tx *bbolt.Tx) error {
+	ledger := tx.Bucket([]byte(ledgerBucketName))
+	if k, _ := ledger.Cursor().First(); k != nil {
+		return nil
+	}
+
+	now := time.Now()
+	return tx.Bucket([]byte(balanceBucketName)).ForEach(func(k, v []byte) error {
+		userId := int64(binary.BigEndian.Uint64(k))
+		balance := int(binary.BigEndian.Uint64(v))
+		if balance == 0 {
+			return nil
+		}
+
+		log.Printf("[INFO] opening ledger balance %d for user %d", balance, userId)
+		return appendLedger(tx, posting{userId: userId, delta: balance, reason: ReasonOpening}, now)
+	})
+}
+
+// ReconcileBalances compares cached balances with the ledger and rebuilds the cache if they drifted apart
+func (am *ActionManager) ReconcileBalances() error {
+	mismatches, err := am.db.Reconcile()
+	if err != nil {
+		return fmt.Errorf("unable to reconcile balances: %w", err)
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	for _, m := range mismatches {
+		log.Printf("[WARN] balance mismatch for user %d: cached %d, ledger %d", m.UserID, m.Cached, m.Ledger)
+	}
+	if err = am.db.RebuildBalances(); err != nil {
+		return fmt.Errorf("unable to rebuild balances: %w", err)
+	}
+	log.Printf("[INFO] balances rebuilt from the ledger")
+	return nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bbolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltDB_Ledger(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+
+	_, err := db.ChangeBalance(1, 100)
+	require.NoError(t, err)
+	_, err = db.PostTransaction(Transaction{UserId: 1, Kind: KindPenalty, Cost: 30, Status: CompletedStatus, Reason: "late"})
+	require.NoError(t, err)
+
+	entries, err := db.LedgerEntries(1)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, ReasonAdjustment, entries[0].Reason)
+	assert.Equal(t, KindPenalty, entries[1].Reason)
+	assert.Equal(t, -30, entries[1].Delta)
+
+	balance, err := db.LedgerBalance(1)
+	require.NoError(t, err)
+	assert.Equal(t, 70, balance)
+
+	mismatches, err := db.Reconcile()
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	// corrupt cached balance, reconciliation detects it and rebuild restores it from the ledger
+	require.NoError(t, db.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(balanceBucketName)).Put(itob64(1), itob(500))
+	}))
+	mismatches, err = db.Reconcile()
+	require.NoError(t, err)
+	assert.Equal(t, []Mismatch{{UserID: 1, Cached: 500, Ledger: 70}}, mismatches)
+
+	require.NoError(t, db.RebuildBalances())
+	balance, err = db.Balance(1)
+	require.NoError(t, err)
+	assert.Equal(t, 70, balance)
+}
+
+func TestActionManager_ReconcileBalances(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	_, err = db.ChangeBalance(1, 100)
+	require.NoError(t, err)
+	require.NoError(t, db.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(balanceBucketName)).Put(itob64(1), itob(500))
+	}))
+
+	require.NoError(t, am.ReconcileBalances())
+	balance, err := db.Balance(1)
+	require.NoError(t, err)
+	assert.Equal(t, 100, balance, "drifted cache is rebuilt from the ledger")
+}
+
+func TestNewBoltDB_RebuildBalances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rebuild.db")
+	db, err := NewBoltDB(path)
+	require.NoError(t, err)
+	_, err = db.ChangeBalance(1, 100)
+	require.NoError(t, err)
+	require.NoError(t, db.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(balanceBucketName)).Put(itob64(1), itob(500))
+	}))
+	require.NoError(t, db.Close())
+
+	db, err = NewBoltDB(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	balance, err := db.Balance(1)
+	require.NoError(t, err)
+	assert.Equal(t, 100, balance, "balance cache is rebuilt on startup")
+}
+
+func TestMigrateLedger(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+
+	// balance recorded before the ledger existed
+	require.NoError(t, db.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(balanceBucketName)).Put(itob64(2), itob(250))
+	}))
+	require.NoError(t, db.db.Update(migrateLedger))
+
+	entries, err := db.LedgerEntries(2)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, ReasonOpening, entries[0].Reason)
+
+	mismatches, err := db.Reconcile()
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	// migration runs once
+	require.NoError(t, db.db.Update(migrateLedger))
+	entries, err = db.LedgerEntries(2)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// ErrPhotoRequired is returned when child finishes a task which needs a photo proof without one
+var ErrPhotoRequired = errors.New("photo proof required")
+
+// AttachPhoto stores photo proof on the task user finished last (or the only open one)
+// and marks it as waiting for parent approval
+func (b *BoltDB) AttachPhoto(userId int64, photoId string) (t Transaction, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if t, err = photoTarget(tx, userId); err != nil {
+			return err
+		}
+
+		t.Status = PendingStatus
+		t.RequestedAt = time.Now()
+		t.PhotoID = photoId
+		return saveTransaction(tx, t)
+	})
+
+	return t, err
+}
+
+// RejectCompletion returns pending transaction back to work, rejected photo proof is dropped
+func (b *BoltDB) RejectCompletion(userId int64, txId string) (t Transaction, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if t, err = getTransaction(tx, userId, txId); err != nil {
+			return err
+		}
+		if t.Status != PendingStatus {
+			return fmt.Errorf("transaction %s is %s, not pending", txId, t.Status)
+		}
+
+		t.Status = OpenStatus
+		t.RequestedAt = time.Time{}
+		t.PhotoID = ""
+		t.Rejections++
+		if err = clearReminders(tx, userId, txId); err != nil {
+			return err
+		}
+		return saveTransaction(tx, t)
+	})
+
+	return t, err
+}
+
+// ApproveCompletion approves the task the child finished and posts its reward,
+// open tasks can't be approved before the child asks to check them
+func (b *BoltDB) ApproveCompletion(userId int64, txId string) (t Transaction, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if t, err = getTransaction(tx, userId, txId); err != nil {
+			return err
+		}
+		if t.Status == CompletedStatus {
+			return ErrAlreadyConfirmed
+		}
+		if t.Status != PendingStatus {
+			return fmt.Errorf("transaction %s is %s, not pending", txId, t.Status)
+		}
+
+		if err = clearReminders(tx, userId, txId); err != nil {
+			return err
+		}
+		return approveTransaction(tx, &t)
+	})
+
+	return t, err
+}
+
+// SetPhotoRequired makes photo proof mandatory or optional for the operation in parent's family
+func (am *ActionManager) SetPhotoRequired(parentId int64, op string, required bool) error {
+	if _, err := am.db.GetOperationCost(op); err != nil {
+		return fmt.Errorf("unknown operation %s: %w", op, err)
+	}
+
+	return am.updateFamilySettings(parentId, func(s *FamilySettings) {
+		ops := make([]string, 0, len(s.PhotoRequired)+1)
+		for _, o := range s.PhotoRequired {
+			if o != op {
+				ops = append(ops, o)
+			}
+		}
+		if required {
+			ops = append(ops, op)
+		}
+		s.PhotoRequired = ops
+	})
+}
+
+// PhotoRequired checks if the operation can be completed by the child with a photo proof only
+func (am *ActionManager) PhotoRequired(childId int64, op string) (bool, error) {
+	settings, err := am.FamilySettings(childId)
+	if err != nil {
+		return false, fmt.Errorf("unable to load family settings: %w", err)
+	}
+
+	for _, o := range settings.PhotoRequired {
+		if o == op {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SubmitPhotoProof attaches photo to the finished task of the child and sends it to parents for approval
+func (am *ActionManager) SubmitPhotoProof(childId int64, photoId string) ([]Notification, error) {
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find child: %w", err)
+	}
+	if child.Type != CHILD {
+		return nil, fmt.Errorf("user %d is not a child", childId)
+	}
+
+	t, err := am.db.AttachPhoto(childId, photoId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to attach photo: %w", err)
+	}
+
+	data := fmt.Sprintf("%d:%s", childId, t.ID)
+	return am.notifyParentsWithPhoto(child,
+		fmt.Sprintf("@%s закончил задание %s. Подтвердите", child.Nickname, OperationTitle(t.Operation)), photoId,
+		Button{Text: "Подтвердить", Data: "taskok:" + data}, Button{Text: "Отклонить", Data: "taskno:" + data})
+}
+
+// DecideTask approves or rejects completion of the child's task by the parent
+func (am *ActionManager) DecideTask(parentId, childId int64, txId string, approve bool) ([]Notification, error) {
+	child, err := am.findOwnChildById(parentId, childId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !approve {
+		t, err := am.db.RejectCompletion(childId, txId)
+		if err != nil {
+			return nil, fmt.Errorf("unable to reject task: %w", err)
+		}
+		return []Notification{{ChatID: child.ChatID, Text: fmt.Sprintf("Родители не приняли задание %s. "+
+			"Доделай его и отправь снова", OperationTitle(t.Operation))}}, nil
+	}
+
+	t, err := am.db.ApproveCompletion(childId, txId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to approve task: %w", err)
+	}
+
+	notifications := []Notification{{ChatID: child.ChatID,
+		Text: fmt.Sprintf("Задание %s подтверждено, +%d dinocoins", OperationTitle(t.Operation), t.Cost)}}
+	if familyId, err := am.FamilyID(childId); err == nil {
+		text := fmt.Sprintf("✅ @%s выполнил задание %s, +%d dinocoins", child.Nickname, OperationTitle(t.Operation), t.Cost)
+		notifications = append(notifications, am.announce(familyId, text)...)
+	}
+	notifications = am.withAchievements(notifications, childId)
+	return am.withGoalProgress(notifications, childId), nil
+}
+
+// TransactionPhoto returns transaction with photo proof, available to the user and their parents
+func (am *ActionManager) TransactionPhoto(requesterId, userId int64, txId string) (Transaction, error) {
+	if requesterId != userId {
+		if _, err := am.findOwnChildById(requesterId, userId); err != nil {
+			return Transaction{}, err
+		}
+	}
+
+	t, err := am.db.GetTransaction(userId, txId)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("unable to find transaction: %w", err)
+	}
+	if t.PhotoID == "" {
+		return Transaction{}, fmt.Errorf("transaction %s has no photo", txId)
+	}
+	return t, nil
+}
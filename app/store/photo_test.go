@@ -0,0 +1,76 @@
+package store
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestActionManager_PhotoProof(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "stranger", Type: PARENT}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	assert.Error(t, am.SetPhotoRequired(2, OpWashFloorInFlat, true), "only parent can change settings")
+	assert.Error(t, am.SetPhotoRequired(1, "unknown", true))
+	require.NoError(t, am.SetPhotoRequired(1, OpWashFloorInFlat, true))
+
+	current, err := db.CreateTransaction(OpWashFloorInFlat, 2)
+	require.NoError(t, err)
+	_, err = db.CreateTransaction(OpWalkDog, 2)
+	require.NoError(t, err)
+	_, err = am.RequestTaskCompletion(2, current.ID)
+	assert.True(t, errors.Is(err, ErrPhotoRequired))
+
+	notifications, err := am.SubmitPhotoProof(2, "file-1")
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(100), notifications[0].ChatID)
+	assert.Equal(t, "file-1", notifications[0].PhotoID)
+	require.Len(t, notifications[0].Buttons, 2)
+
+	stored, err := db.GetTransaction(2, current.ID)
+	require.NoError(t, err)
+	assert.Equal(t, PendingStatus, stored.Status, "photo is attached to the finished task")
+
+	_, err = am.DecideTask(3, 2, current.ID, true)
+	assert.Error(t, err, "stranger can't approve")
+
+	// rejected task returns to work without the photo
+	_, err = am.DecideTask(1, 2, current.ID, false)
+	require.NoError(t, err)
+	stored, err = db.GetTransaction(2, current.ID)
+	require.NoError(t, err)
+	assert.Equal(t, OpenStatus, stored.Status)
+	assert.Empty(t, stored.PhotoID)
+
+	_, err = am.SubmitPhotoProof(2, "file-2")
+	require.NoError(t, err)
+	notifications, err = am.DecideTask(1, 2, current.ID, true)
+	require.NoError(t, err)
+	assert.Contains(t, notifications[0].Text, "+30 dinocoins")
+
+	_, err = am.DecideTask(1, 2, current.ID, true)
+	assert.True(t, errors.Is(err, ErrAlreadyConfirmed))
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 30, balance)
+
+	tr, err := am.TransactionPhoto(1, 2, current.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "file-2", tr.PhotoID)
+	_, err = am.TransactionPhoto(3, 2, current.ID)
+	assert.Error(t, err)
+
+	require.NoError(t, am.SetPhotoRequired(1, OpWashFloorInFlat, false))
+	required, err := am.PhotoRequired(2, OpWashFloorInFlat)
+	require.NoError(t, err)
+	assert.False(t, required)
+}
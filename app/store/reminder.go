@@ -0,0 +1,159 @@
+package store
+
+import (
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"time"
+)
+
+const remindersTTL = 30 * 24 * time.Hour // sent reminder records are kept for this long
+
+// SetReminders updates reminder delays of the parent's family, zero delay disables reminder
+func (am *ActionManager) SetReminders(parentId int64, childAfter, parentAfter time.Duration) error {
+	if childAfter < 0 || parentAfter < 0 {
+		return fmt.Errorf("negative reminder delay")
+	}
+
+	return am.updateFamilySettings(parentId, func(s *FamilySettings) {
+		s.ChildReminderAfter = childAfter
+		s.ParentReminderAfter = parentAfter
+	})
+}
+
+// SendReminders scans active transactions and nudges children about open tasks and parents about pending approvals.
+// If the first parent ignores approval request for twice the delay, it is escalated to the second parent.
+// Each reminder is sent once, sent reminders are recorded in the store.
+func (am *ActionManager) SendReminders(now time.Time) ([]Notification, error) {
+	transactions, err := am.db.ActiveTransactions()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load active transactions: %w", err)
+	}
+
+	var notifications []Notification
+	for _, t := range transactions {
+		child, err := am.db.FindUser(t.UserId)
+		if err != nil {
+			log.Printf("[WARN] unable to find user %d: %+v", t.UserId, err)
+			continue
+		}
+
+		parentIds, err := am.db.FindParentIdsByChildNickName(child.Nickname)
+		if err != nil || len(parentIds) == 0 {
+			log.Printf("[WARN] unable to find parents of %s: %+v", child.Nickname, err)
+			continue
+		}
+
+		settings, err := am.db.FamilySettings(parentIds[0])
+		if err != nil {
+			return notifications, fmt.Errorf("unable to load family settings: %w", err)
+		}
+
+		title := OperationTitle(t.Operation)
+		key := reminderKey(t.UserId, t.ID)
+
+		switch t.Status {
+		case OpenStatus:
+			if settings.ChildReminderAfter == 0 || now.Sub(t.Timestamp) < settings.ChildReminderAfter {
+				continue
+			}
+			n := Notification{ChatID: child.ChatID, Text: "Не забудь закончить задание " + title}
+			notifications, err = am.remind(notifications, "child:"+key, n, now)
+		case PendingStatus:
+			if settings.ParentReminderAfter == 0 || now.Sub(t.RequestedAt) < settings.ParentReminderAfter {
+				continue
+			}
+			text := fmt.Sprintf("%s ждет подтверждения задания %s", child.Nickname, title)
+			if n, ok := am.parentNotification(parentIds[0], text); ok {
+				notifications, err = am.remind(notifications, "parent:"+key, n, now)
+			}
+			if err != nil || len(parentIds) < 2 || now.Sub(t.RequestedAt) < 2*settings.ParentReminderAfter {
+				break
+			}
+			if n, ok := am.parentNotification(parentIds[1], text); ok {
+				notifications, err = am.remind(notifications, "escalate:"+key, n, now)
+			}
+		}
+
+		if err != nil {
+			return notifications, err
+		}
+	}
+
+	if err = am.db.CleanupReminders(now.Add(-remindersTTL)); err != nil {
+		return notifications, fmt.Errorf("unable to cleanup reminders: %w", err)
+	}
+
+	return notifications, nil
+}
+
+// remind adds notification if reminder with the key was not sent yet
+func (am *ActionManager) remind(notifications []Notification, key string, n Notification, now time.Time) ([]Notification, error) {
+	isNew, err := am.db.MarkReminderSent(key, now)
+	if err != nil {
+		return notifications, fmt.Errorf("unable to mark reminder %s: %w", key, err)
+	}
+	if isNew {
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+func (am *ActionManager) parentNotification(parentId int64, text string) (Notification, bool) {
+	parent, err := am.db.FindUser(parentId)
+	if err != nil {
+		log.Printf("[WARN] unable to find parent %d: %+v", parentId, err)
+		return Notification{}, false
+	}
+	return Notification{ChatID: parent.ChatID, Text: text}, true
+}
+
+// ActiveTransactions returns open and pending transactions of all users
+func (b *BoltDB) ActiveTransactions() ([]Transaction, error) {
+	open, err := b.TransactionsByStatus(OpenStatus)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := b.TransactionsByStatus(PendingStatus)
+	return append(open, pending...), err
+}
+
+// MarkReminderSent records reminder, returns false if it was recorded before
+func (b *BoltDB) MarkReminderSent(key string, ts time.Time) (isNew bool, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(remindersBucketName))
+		if bkt.Get([]byte(key)) != nil {
+			return nil
+		}
+
+		isNew = true
+		return bkt.Put([]byte(key), []byte(ts.Format(time.RFC3339)))
+	})
+
+	return isNew, err
+}
+
+// CleanupReminders removes reminder records sent before the given time
+func (b *BoltDB) CleanupReminders(before time.Time) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return deleteWhere(tx.Bucket([]byte(remindersBucketName)), func(_, v []byte) bool {
+			return sentBefore(v, before)
+		})
+	})
+}
+
+// clearReminders forgets reminders sent about the task, so they are sent again once it waits for someone anew
+func clearReminders(tx *bbolt.Tx, userId int64, txId string) error {
+	bkt := tx.Bucket([]byte(remindersBucketName))
+	key := reminderKey(userId, txId)
+	for _, prefix := range []string{"child:", "parent:", "escalate:"} {
+		if err := bkt.Delete([]byte(prefix + key)); err != nil {
+			return fmt.Errorf("failed to delete reminder %s: %w", prefix+key, err)
+		}
+	}
+	return nil
+}
+
+func reminderKey(userId int64, txId string) string {
+	return fmt.Sprintf("%d:%s", userId, txId)
+}
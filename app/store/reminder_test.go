@@ -0,0 +1,153 @@
+package store
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestActionManager_SendReminders(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "mom", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	require.NoError(t, db.BindChildToParent(2, "@kid"))
+
+	tr, err := db.CreateTransaction(OpWalkDog, 3)
+	require.NoError(t, err)
+	start := time.Now()
+
+	notifications, err := am.SendReminders(start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, notifications)
+
+	notifications, err = am.SendReminders(start.Add(3 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(300), notifications[0].ChatID)
+
+	// already sent, no spam
+	notifications, err = am.SendReminders(start.Add(4 * time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, notifications)
+
+	notifications, err = am.RequestTaskCompletion(3, tr.ID)
+	require.NoError(t, err)
+	assert.Len(t, notifications, 2, "both parents are asked")
+	stored, err := db.GetTransaction(3, tr.ID)
+	require.NoError(t, err)
+	assert.Equal(t, PendingStatus, stored.Status)
+
+	notifications, err = am.SendReminders(start.Add(7 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(100), notifications[0].ChatID)
+
+	// escalated to the second parent
+	notifications, err = am.SendReminders(start.Add(13 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(200), notifications[0].ChatID)
+
+	// disabled reminders
+	require.NoError(t, am.SetReminders(1, 0, 0))
+	settings, err := am.FamilySettings(2)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), settings.ParentReminderAfter)
+
+	// approved transaction is not active anymore
+	_, err = am.DecideTask(1, 3, tr.ID, true)
+	require.NoError(t, err)
+	active, err := db.ActiveTransactions()
+	require.NoError(t, err)
+	assert.Empty(t, active)
+	balance, err := db.Balance(3)
+	require.NoError(t, err)
+	assert.Equal(t, 10, balance)
+}
+
+func TestActionManager_SendRemindersAfterReject(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "mom", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 3, ChatID: 300, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	tr, err := db.CreateTransaction(OpWalkDog, 3)
+	require.NoError(t, err)
+	_, err = am.RequestTaskCompletion(3, tr.ID)
+	require.NoError(t, err)
+
+	notifications, err := am.SendReminders(time.Now().Add(7 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(100), notifications[0].ChatID)
+
+	_, err = am.DecideTask(1, 3, tr.ID, false)
+	require.NoError(t, err)
+	_, err = am.RequestTaskCompletion(3, tr.ID)
+	require.NoError(t, err)
+
+	notifications, err = am.SendReminders(time.Now().Add(7 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, notifications, 1, "re-submitted task nudges the parent again")
+	assert.Equal(t, int64(100), notifications[0].ChatID)
+}
+
+func TestBoltDB_CleanupReminders(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		_, err := db.MarkReminderSent(fmt.Sprintf("child:%d", i), now.Add(-time.Hour))
+		require.NoError(t, err)
+	}
+	_, err := db.MarkReminderSent("child:fresh", now)
+	require.NoError(t, err)
+
+	require.NoError(t, db.CleanupReminders(now.Add(-time.Minute)))
+	isNew, err := db.MarkReminderSent("child:5", now)
+	require.NoError(t, err)
+	assert.True(t, isNew, "every expired record is removed")
+	isNew, err = db.MarkReminderSent("child:6", now)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	isNew, err = db.MarkReminderSent("child:fresh", now)
+	require.NoError(t, err)
+	assert.False(t, isNew)
+}
+
+func TestBoltDB_CancelTask(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+
+	tr, err := db.CreateTransaction(OpWalkDog, 1)
+	require.NoError(t, err)
+	other, err := db.CreateTransaction(OpGoToShop, 1)
+	require.NoError(t, err)
+	require.NoError(t, db.CancelTask(1, tr.ID))
+
+	tasks, err := db.OpenTasks(1)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, other.ID, tasks[0].ID)
+
+	transactions, err := db.ShowLastNTransactions(1, 10)
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, tr.ID, transactions[1].ID)
+	assert.Equal(t, CanceledStatus, transactions[1].Status)
+
+	assert.Error(t, db.CancelTask(1, tr.ID))
+}
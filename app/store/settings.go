@@ -0,0 +1,117 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"strings"
+	"time"
+)
+
+// FamilySettings keeps parents' configuration applied to all their children.
+// Family is identified by id of the first parent of its children, see ActionManager.FamilyID
+type FamilySettings struct {
+	ChildReminderAfter  time.Duration  `json:"child_reminder_after"`     // nudge child about open task, 0 disables
+	ParentReminderAfter time.Duration  `json:"parent_reminder_after"`    // nudge parent about pending approval, 0 disables
+	InterestPercent     int            `json:"interest_percent"`         // weekly interest on saved coins, 0 disables
+	InterestCap         int            `json:"interest_cap"`             // max weekly interest, 0 if not limited
+	PhotoRequired       []string       `json:"photo_required,omitempty"` // operations completed with a photo only
+	MaxOpenTasks        int            `json:"max_open_tasks"`           // tasks a child can hold at once
+	CompetitionPrize    int            `json:"competition_prize"`        // weekly prize for the best child, 0 disables
+	BadgeBonus          int            `json:"badge_bonus"`              // coins granted with every badge, 0 disables
+	GroupChatID         int64          `json:"group_chat_id,omitempty"`  // family group chat for public announcements
+	Costs               map[string]int `json:"costs,omitempty"`          // family costs of built-in operations
+}
+
+// DefaultFamilySettings used for families without stored settings and for missing fields
+var DefaultFamilySettings = FamilySettings{
+	ChildReminderAfter:  2 * time.Hour,
+	ParentReminderAfter: 6 * time.Hour,
+	MaxOpenTasks:        3,
+}
+
+// FamilySettings returns settings of the family
+func (b *BoltDB) FamilySettings(familyId int64) (settings FamilySettings, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		settings, err = familySettings(tx, familyId)
+		return err
+	})
+
+	return settings, err
+}
+
+// SaveFamilySettings stores settings of the family
+func (b *BoltDB) SaveFamilySettings(familyId int64, settings FamilySettings) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return putFamilySettings(tx, familyId, settings)
+	})
+}
+
+// familySettings returns stored settings of the family, defaults are used for missing fields
+func familySettings(tx *bbolt.Tx, familyId int64) (FamilySettings, error) {
+	settings := DefaultFamilySettings
+	v := tx.Bucket([]byte(familySettingsBucketName)).Get(itob64(familyId))
+	if v == nil {
+		return settings, nil
+	}
+	if err := json.Unmarshal(v, &settings); err != nil {
+		return settings, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	return settings, nil
+}
+
+func putFamilySettings(tx *bbolt.Tx, familyId int64, settings FamilySettings) error {
+	buf, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(familySettingsBucketName)).Put(itob64(familyId), buf)
+}
+
+// FamilyID returns family of the user: the first parent of a child, or of the first child of a parent.
+// Parent without children is a family on their own.
+func (am *ActionManager) FamilyID(userId int64) (int64, error) {
+	user, err := am.db.FindUser(userId)
+	if err != nil {
+		return 0, fmt.Errorf("unable to find user %d: %w", userId, err)
+	}
+
+	if user.Type == CHILD {
+		return am.db.FindParentIdByChildNickName(user.Nickname)
+	}
+
+	children, err := am.db.FindChildren(userId)
+	if err != nil {
+		return 0, fmt.Errorf("unable to find children of %d: %w", userId, err)
+	}
+	if len(children) == 0 {
+		return userId, nil
+	}
+
+	return am.db.FindParentIdByChildNickName(strings.TrimPrefix(children[0], "@"))
+}
+
+// FamilySettings returns settings of the user's family
+func (am *ActionManager) FamilySettings(userId int64) (FamilySettings, error) {
+	familyId, err := am.FamilyID(userId)
+	if err != nil {
+		return FamilySettings{}, err
+	}
+	return am.db.FamilySettings(familyId)
+}
+
+// updateFamilySettings applies changes to the settings of the parent's family
+func (am *ActionManager) updateFamilySettings(parentId int64, update func(s *FamilySettings)) error {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return err
+	}
+
+	settings, err := am.db.FamilySettings(familyId)
+	if err != nil {
+		return fmt.Errorf("unable to load family settings: %w", err)
+	}
+
+	update(&settings)
+	return am.db.SaveFamilySettings(familyId, settings)
+}
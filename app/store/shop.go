@@ -0,0 +1,428 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PurchasePendingStatus  = "PENDING"
+	PurchaseApprovedStatus = "APPROVED"
+	PurchaseRejectedStatus = "REJECTED"
+
+	KindPurchase = "purchase" // reward redemption transaction
+
+	UnlimitedStock = -1
+)
+
+// Reward is a privilege parents sell for coins, rewards are stored in rewards_<familyId> bucket, rewardId -> reward
+type Reward struct {
+	ID          string `json:"id"`
+	FamilyID    int64  `json:"family_id"`
+	Name        string `json:"name"`
+	Price       int    `json:"price"`
+	Stock       int    `json:"stock"`        // UnlimitedStock if not limited
+	WeeklyLimit int    `json:"weekly_limit"` // purchases per child per week, 0 if not limited
+}
+
+// Purchase is child's request to buy a reward
+type Purchase struct {
+	ID       string    `json:"id"`
+	ChildID  int64     `json:"child_id"`
+	FamilyID int64     `json:"family_id"`
+	RewardID string    `json:"reward_id"`
+	Name     string    `json:"name"`
+	Price    int       `json:"price"`
+	Status   string    `json:"status"`
+	Created  time.Time `json:"created"`
+	Decided  time.Time `json:"decided"`
+}
+
+func rewardsBucketName(familyId int64) []byte {
+	return []byte("rewards_" + strconv.FormatInt(familyId, 10))
+}
+
+// WeekStart returns monday 00:00 of the week of t
+func WeekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	d := t.AddDate(0, 0, -offset)
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// SaveReward creates or updates reward, new rewards get ID from the bucket sequence
+func (b *BoltDB) SaveReward(r Reward) (Reward, error) {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		return saveReward(tx, &r)
+	})
+
+	return r, err
+}
+
+func saveReward(tx *bbolt.Tx, r *Reward) error {
+	bkt, err := tx.CreateBucketIfNotExists(rewardsBucketName(r.FamilyID))
+	if err != nil {
+		return fmt.Errorf("failed to create rewards bucket of %d: %w", r.FamilyID, err)
+	}
+
+	if r.ID == "" {
+		id, _ := bkt.NextSequence()
+		r.ID = fmt.Sprint(id)
+	}
+
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return bkt.Put([]byte(r.ID), buf)
+}
+
+// Rewards returns family's reward catalog
+func (b *BoltDB) Rewards(familyId int64) (rewards []Reward, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(rewardsBucketName(familyId))
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			var r Reward
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			rewards = append(rewards, r)
+			return nil
+		})
+	})
+
+	return rewards, err
+}
+
+// GetReward returns family's reward by id
+func (b *BoltDB) GetReward(familyId int64, rewardId string) (r Reward, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(rewardsBucketName(familyId))
+		if bkt == nil {
+			return fmt.Errorf("reward %s not found", rewardId)
+		}
+		return b.load(bkt, rewardId, &r)
+	})
+
+	return r, err
+}
+
+// DeleteReward removes reward from family's catalog
+func (b *BoltDB) DeleteReward(familyId int64, rewardId string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(rewardsBucketName(familyId))
+		if bkt == nil || bkt.Get([]byte(rewardId)) == nil {
+			return fmt.Errorf("reward %s not found", rewardId)
+		}
+		return bkt.Delete([]byte(rewardId))
+	})
+}
+
+// SavePurchase creates or updates purchase request
+func (b *BoltDB) SavePurchase(p Purchase) (Purchase, error) {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		return savePurchase(tx, &p)
+	})
+
+	return p, err
+}
+
+func savePurchase(tx *bbolt.Tx, p *Purchase) error {
+	bkt := tx.Bucket([]byte(purchasesBucketName))
+
+	if p.ID == "" {
+		id, _ := bkt.NextSequence()
+		p.ID = fmt.Sprint(id)
+	}
+
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	return bkt.Put([]byte(p.ID), buf)
+}
+
+// GetPurchase returns purchase request by id
+func (b *BoltDB) GetPurchase(purchaseId string) (p Purchase, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		return b.load(tx.Bucket([]byte(purchasesBucketName)), purchaseId, &p)
+	})
+
+	return p, err
+}
+
+// Purchases returns purchase requests of the family, oldest first
+func (b *BoltDB) Purchases(familyId int64) (purchases []Purchase, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(purchasesBucketName)).ForEach(func(k, v []byte) error {
+			var p Purchase
+			if err := json.Unmarshal(v, &p); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if p.FamilyID == familyId {
+				purchases = append(purchases, p)
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(purchases, func(i, j int) bool { return purchases[i].Created.Before(purchases[j].Created) })
+	return purchases, err
+}
+
+// ApprovePurchase checks stock, weekly limit and balance, then deducts the price shown in the request, decrements stock
+// and closes the request atomically
+func (b *BoltDB) ApprovePurchase(purchaseId string, now time.Time) (p Purchase, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if err := b.load(tx.Bucket([]byte(purchasesBucketName)), purchaseId, &p); err != nil {
+			return err
+		}
+		if p.Status != PurchasePendingStatus {
+			return fmt.Errorf("purchase %s is already %s", purchaseId, p.Status)
+		}
+
+		var r Reward
+		bkt := tx.Bucket(rewardsBucketName(p.FamilyID))
+		if bkt == nil {
+			return fmt.Errorf("reward %s not found", p.RewardID)
+		}
+		if err := b.load(bkt, p.RewardID, &r); err != nil {
+			return err
+		}
+
+		// the child agreed to the price shown in the request
+		r.Price = p.Price
+		if err := checkPurchase(tx, r, p.ChildID, now, 0); err != nil {
+			return err
+		}
+
+		if _, err := postTransaction(tx, Transaction{Operation: KindPurchase, Kind: KindPurchase, Cost: r.Price,
+			UserId: p.ChildID, Reason: r.Name, Ref: r.ID}); err != nil {
+			return err
+		}
+
+		if r.Stock != UnlimitedStock {
+			r.Stock--
+			if err := saveReward(tx, &r); err != nil {
+				return err
+			}
+		}
+
+		p.Status = PurchaseApprovedStatus
+		p.Decided = now
+		return savePurchase(tx, &p)
+	})
+
+	return p, err
+}
+
+// CheckPurchase verifies that the child can buy the reward now, pending requests count toward the weekly limit
+func (b *BoltDB) CheckPurchase(r Reward, childId int64, now time.Time) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		pending, err := pendingPurchases(tx, r.ID, childId)
+		if err != nil {
+			return err
+		}
+		return checkPurchase(tx, r, childId, now, pending)
+	})
+}
+
+// RequestPurchase checks the purchase like CheckPurchase and saves the request in the same transaction
+func (b *BoltDB) RequestPurchase(r Reward, p Purchase, now time.Time) (Purchase, error) {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		pending, err := pendingPurchases(tx, r.ID, p.ChildID)
+		if err != nil {
+			return err
+		}
+		if err = checkPurchase(tx, r, p.ChildID, now, pending); err != nil {
+			return err
+		}
+		return savePurchase(tx, &p)
+	})
+
+	return p, err
+}
+
+// pendingPurchases counts child's requests of the reward waiting for parents
+func pendingPurchases(tx *bbolt.Tx, rewardId string, childId int64) (int, error) {
+	count := 0
+	err := tx.Bucket([]byte(purchasesBucketName)).ForEach(func(k, v []byte) error {
+		var p Purchase
+		if err := json.Unmarshal(v, &p); err != nil {
+			return fmt.Errorf("failed to unmarshal: %w", err)
+		}
+		if p.ChildID == childId && p.RewardID == rewardId && p.Status == PurchasePendingStatus {
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// checkPurchase verifies stock, balance and weekly limit, pending requests are added to the purchases of the week
+func checkPurchase(tx *bbolt.Tx, r Reward, childId int64, now time.Time, pending int) error {
+	if r.Stock == 0 {
+		return fmt.Errorf("reward %s is out of stock", r.Name)
+	}
+
+	if balance := balanceOf(tx, childId); balance < r.Price {
+		return fmt.Errorf("not enough coins for %s: %d of %d", r.Name, balance, r.Price)
+	}
+
+	if r.WeeklyLimit == 0 {
+		return nil
+	}
+
+	count := pending
+	if userBkt := tx.Bucket(itob64(childId)); userBkt != nil {
+		from := WeekStart(now)
+		err := userBkt.ForEach(func(k, v []byte) error {
+			var t Transaction
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if t.EffectiveKind() == KindPurchase && t.Ref == r.ID && !t.Timestamp.Before(from) {
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if count >= r.WeeklyLimit {
+		return fmt.Errorf("weekly limit of %s is reached: %d", r.Name, r.WeeklyLimit)
+	}
+	return nil
+}
+
+// AddReward adds reward to the parent's family catalog, args are price followed by name words,
+// stock=N and limit=N options can be placed anywhere
+func (am *ActionManager) AddReward(parentId int64, args []string) (Reward, error) {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return Reward{}, err
+	}
+
+	r := Reward{FamilyID: familyId, Stock: UnlimitedStock}
+	var name []string
+	for i, arg := range args {
+		switch {
+		case i == 0:
+			if r.Price, err = strconv.Atoi(arg); err != nil || r.Price <= 0 {
+				return Reward{}, fmt.Errorf("invalid price %s", arg)
+			}
+		case strings.HasPrefix(arg, "stock="):
+			if r.Stock, err = strconv.Atoi(strings.TrimPrefix(arg, "stock=")); err != nil || r.Stock < 0 {
+				return Reward{}, fmt.Errorf("invalid stock %s", arg)
+			}
+		case strings.HasPrefix(arg, "limit="):
+			if r.WeeklyLimit, err = strconv.Atoi(strings.TrimPrefix(arg, "limit=")); err != nil || r.WeeklyLimit < 0 {
+				return Reward{}, fmt.Errorf("invalid weekly limit %s", arg)
+			}
+		default:
+			name = append(name, arg)
+		}
+	}
+
+	if len(name) == 0 {
+		return Reward{}, fmt.Errorf("price and name are required")
+	}
+	r.Name = strings.Join(name, " ")
+
+	return am.db.SaveReward(r)
+}
+
+// DeleteReward removes reward from the parent's family catalog
+func (am *ActionManager) DeleteReward(parentId int64, rewardId string) error {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return err
+	}
+	return am.db.DeleteReward(familyId, rewardId)
+}
+
+// Rewards returns catalog of the user's family
+func (am *ActionManager) Rewards(userId int64) ([]Reward, error) {
+	familyId, err := am.FamilyID(userId)
+	if err != nil {
+		return nil, err
+	}
+	return am.db.Rewards(familyId)
+}
+
+// RequestPurchase creates child's purchase request and returns approval requests for parents
+func (am *ActionManager) RequestPurchase(childId int64, rewardId string) ([]Notification, error) {
+	familyId, err := am.FamilyID(childId)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := am.db.GetReward(familyId, rewardId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find reward: %w", err)
+	}
+
+	p, err := am.db.RequestPurchase(r, Purchase{ChildID: childId, FamilyID: familyId, RewardID: r.ID, Name: r.Name,
+		Price: r.Price, Status: PurchasePendingStatus, Created: time.Now()}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find child: %w", err)
+	}
+
+	return am.notifyParents(child, fmt.Sprintf("%s хочет купить «%s» за %d dinocoins", child.Nickname, r.Name, r.Price),
+		Button{Text: "Одобрить", Data: "shopok:" + p.ID}, Button{Text: "Отклонить", Data: "shopno:" + p.ID})
+}
+
+// DecidePurchase approves or rejects child's purchase request, returns notifications for the child
+func (am *ActionManager) DecidePurchase(parentId int64, purchaseId string, approve bool) ([]Notification, error) {
+	p, err := am.db.GetPurchase(purchaseId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find purchase: %w", err)
+	}
+
+	child, err := am.findOwnChildById(parentId, p.ChildID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !approve {
+		if p.Status != PurchasePendingStatus {
+			return nil, fmt.Errorf("purchase %s is already %s", purchaseId, p.Status)
+		}
+		p.Status = PurchaseRejectedStatus
+		p.Decided = time.Now()
+		if _, err = am.db.SavePurchase(p); err != nil {
+			return nil, fmt.Errorf("unable to save purchase: %w", err)
+		}
+		return []Notification{{ChatID: child.ChatID, Text: "Родители отклонили покупку «" + p.Name + "»"}}, nil
+	}
+
+	if p, err = am.db.ApprovePurchase(purchaseId, time.Now()); err != nil {
+		return nil, fmt.Errorf("unable to approve purchase: %w", err)
+	}
+
+	balance, err := am.db.Balance(p.ChildID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get balance: %w", err)
+	}
+
+	return []Notification{{ChatID: child.ChatID, Text: fmt.Sprintf("Покупка «%s» одобрена! Списано %d dinocoins, баланс: %d",
+		p.Name, p.Price, balance)}}, nil
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestActionManager_Shop(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	_, err = am.AddReward(2, []string{"10", "Мультики"})
+	assert.Error(t, err, "child can't add rewards")
+	_, err = am.AddReward(1, []string{"10"})
+	assert.Error(t, err)
+
+	games, err := am.AddReward(1, []string{"30", "30", "минут", "игр", "limit=1"})
+	require.NoError(t, err)
+	assert.Equal(t, "30 минут игр", games.Name)
+	assert.Equal(t, UnlimitedStock, games.Stock)
+	dinner, err := am.AddReward(1, []string{"20", "Выбрать", "ужин", "stock=1"})
+	require.NoError(t, err)
+
+	rewards, err := am.Rewards(2)
+	require.NoError(t, err)
+	assert.Len(t, rewards, 2)
+
+	_, err = am.RequestPurchase(2, games.ID)
+	assert.Error(t, err, "not enough coins")
+
+	_, err = am.GrantBonus(1, "@kid", 100, "подарок")
+	require.NoError(t, err)
+
+	notifications, err := am.RequestPurchase(2, games.ID)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	require.Len(t, notifications[0].Buttons, 2)
+	purchaseId := notifications[0].Buttons[0].Data[len("shopok:"):]
+
+	_, err = am.DecidePurchase(2, purchaseId, true)
+	assert.Error(t, err, "child can't approve")
+
+	notifications, err = am.DecidePurchase(1, purchaseId, true)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, int64(200), notifications[0].ChatID)
+
+	_, err = am.DecidePurchase(1, purchaseId, true)
+	assert.Error(t, err, "purchase can't be approved twice")
+
+	_, err = am.RequestPurchase(2, games.ID)
+	assert.Error(t, err, "weekly limit reached")
+	assert.NoError(t, db.CheckPurchase(games, 2, time.Now().AddDate(0, 0, 7)), "limit is reset next week")
+
+	notifications, err = am.RequestPurchase(2, dinner.ID)
+	require.NoError(t, err)
+	_, err = am.DecidePurchase(1, notifications[0].Buttons[0].Data[len("shopok:"):], true)
+	require.NoError(t, err)
+	dinner, err = db.GetReward(1, dinner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, dinner.Stock)
+	_, err = am.RequestPurchase(2, dinner.ID)
+	assert.Error(t, err, "out of stock")
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 50, balance)
+
+	transactions, err := db.ShowLastNTransactions(2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, KindPurchase, transactions[0].Kind)
+	assert.Equal(t, dinner.ID, transactions[0].Ref)
+
+	require.NoError(t, am.DeleteReward(1, dinner.ID))
+	rewards, err = am.Rewards(1)
+	require.NoError(t, err)
+	assert.Len(t, rewards, 1)
+}
+
+func TestActionManager_ShopPendingRequests(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	_, err = am.GrantBonus(1, "@kid", 100, "подарок")
+	require.NoError(t, err)
+
+	games, err := am.AddReward(1, []string{"30", "Игры", "limit=1"})
+	require.NoError(t, err)
+
+	notifications, err := am.RequestPurchase(2, games.ID)
+	require.NoError(t, err)
+	purchaseId := notifications[0].Buttons[0].Data[len("shopok:"):]
+	_, err = am.RequestPurchase(2, games.ID)
+	assert.Error(t, err, "pending request counts toward the weekly limit")
+
+	games.Price = 50
+	_, err = db.SaveReward(games)
+	require.NoError(t, err)
+	_, err = am.DecidePurchase(1, purchaseId, true)
+	require.NoError(t, err)
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 70, balance, "the price shown in the request is charged")
+}
+
+func TestWeekStart(t *testing.T) {
+	assert.Equal(t, time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC), WeekStart(time.Date(2022, 5, 8, 23, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC), WeekStart(time.Date(2022, 5, 2, 1, 0, 0, 0, time.UTC)))
+}
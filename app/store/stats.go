@@ -0,0 +1,123 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Statistics is chart data of the children for the period
+type Statistics struct {
+	From     time.Time
+	To       time.Time
+	Weeks    []time.Time // starts of the weeks in the period
+	Days     []time.Time // days of the period
+	Children []ChildStats
+}
+
+// ChildStats is chart data of one child
+type ChildStats struct {
+	Child    User
+	Earnings []int          // coins added to the balance in each week
+	TaskMix  map[string]int // completed tasks by operation
+	Balance  []int          // balance at the end of each day
+}
+
+// Statistics collects chart data for the period ending at now: the child gets own data,
+// the parent gets data of all children
+func (am *ActionManager) Statistics(userId int64, period string, now time.Time) (Statistics, error) {
+	from, err := periodStart(period, now)
+	if err != nil {
+		return Statistics{}, err
+	}
+	if from.IsZero() {
+		return Statistics{}, fmt.Errorf("period %s is not limited", period)
+	}
+
+	children, err := am.statisticsChildren(userId)
+	if err != nil {
+		return Statistics{}, err
+	}
+
+	s := Statistics{From: from, To: now}
+	for w := WeekStart(from); w.Before(now); w = w.AddDate(0, 0, 7) {
+		s.Weeks = append(s.Weeks, w)
+	}
+	for d := dayStart(from); d.Before(now); d = d.AddDate(0, 0, 1) {
+		s.Days = append(s.Days, d)
+	}
+
+	for _, child := range children {
+		cs, err := am.childStats(child, s)
+		if err != nil {
+			return Statistics{}, err
+		}
+		s.Children = append(s.Children, cs)
+	}
+	return s, nil
+}
+
+func (am *ActionManager) statisticsChildren(userId int64) ([]User, error) {
+	user, err := am.db.FindUser(userId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find user %d: %w", userId, err)
+	}
+	if user.Type == CHILD {
+		return []User{user}, nil
+	}
+
+	return am.OwnChildren(userId)
+}
+
+// childStats groups ledger postings by weeks and days, so coins count when they reached the balance,
+// completed tasks are grouped by operation
+func (am *ActionManager) childStats(child User, s Statistics) (ChildStats, error) {
+	cs := ChildStats{Child: child, Earnings: make([]int, len(s.Weeks)), TaskMix: map[string]int{},
+		Balance: make([]int, len(s.Days))}
+
+	entries, err := am.db.LedgerEntries(child.ID)
+	if err != nil {
+		return cs, fmt.Errorf("unable to load ledger of %d: %w", child.ID, err)
+	}
+
+	balance, dayDelta := 0, make([]int, len(s.Days))
+	for _, e := range entries {
+		if e.Timestamp.After(s.To) {
+			continue
+		}
+		if e.Timestamp.Before(s.Days[0]) {
+			balance += e.Delta
+			continue
+		}
+		if week := daysBetween(s.Weeks[0], e.Timestamp) / 7; e.Delta > 0 && week < len(s.Weeks) {
+			cs.Earnings[week] += e.Delta
+		}
+		if day := daysBetween(s.Days[0], e.Timestamp); day < len(s.Days) {
+			dayDelta[day] += e.Delta
+		}
+	}
+	for i := range s.Days {
+		balance += dayDelta[i]
+		cs.Balance[i] = balance
+	}
+
+	transactions, err := am.db.TransactionsForPeriod(child.ID, s.From, s.To.Add(time.Second))
+	if err != nil {
+		return cs, fmt.Errorf("unable to load transactions of %d: %w", child.ID, err)
+	}
+	for _, t := range transactions {
+		if t.Status == CompletedStatus && t.EffectiveKind() == KindTask {
+			cs.TaskMix[t.Operation]++
+		}
+	}
+	return cs, nil
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// daysBetween counts calendar days from the day `from` to the day of t, rounding absorbs DST shifts
+func daysBetween(from, t time.Time) int {
+	return int(math.Round(dayStart(t.In(from.Location())).Sub(from).Hours() / 24))
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"testing"
+	"time"
+)
+
+func TestActionManager_Statistics(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	post := func(op, kind string, cost int, ts time.Time) {
+		tr, err := db.PostTransaction(Transaction{Operation: op, Kind: kind, Cost: cost, UserId: 2, Timestamp: ts})
+		require.NoError(t, err)
+		backdateLedger(t, db, tr.ID, ts)
+	}
+	post(OpWalkDog, "", 10, now.AddDate(0, 0, -40))
+	post(OpWalkDog, "", 10, now.AddDate(0, 0, -20))
+	post(OpFreeDish, "", 5, now.AddDate(0, 0, -20))
+	post(KindPenalty, KindPenalty, 3, now.AddDate(0, 0, -1))
+	post(OpWalkDog, "", 10, now.Add(-time.Hour))
+
+	task, err := am.StartTask(2, OpWalkDog)
+	require.NoError(t, err)
+	task.Timestamp = now.AddDate(0, 0, -20)
+	require.NoError(t, db.db.Update(func(tx *bbolt.Tx) error { return saveTransaction(tx, *task) }))
+	_, err = db.ApproveTransaction(2, task.ID)
+	require.NoError(t, err)
+	backdateLedger(t, db, task.ID, now.Add(-time.Minute))
+
+	_, err = am.Statistics(1, PeriodAll, now)
+	assert.Error(t, err)
+
+	parentStats, err := am.Statistics(1, PeriodMonth, now)
+	require.NoError(t, err)
+	childStats, err := am.Statistics(2, PeriodMonth, now)
+	require.NoError(t, err)
+	assert.Equal(t, parentStats, childStats, "parent sees the same data as the child")
+
+	s := childStats
+	assert.Len(t, s.Weeks, 6, "19.09 - 19.10 touches six weeks")
+	assert.Len(t, s.Days, 31)
+	require.Len(t, s.Children, 1)
+
+	cs := s.Children[0]
+	assert.Equal(t, []int{0, 0, 15, 0, 0, 20}, cs.Earnings, "task started long ago is earned when approved")
+	assert.Equal(t, map[string]int{OpWalkDog: 3, OpFreeDish: 1}, cs.TaskMix)
+	assert.Equal(t, 10, cs.Balance[0], "opening balance of the period")
+	assert.Equal(t, 42, cs.Balance[len(cs.Balance)-1])
+	assert.Equal(t, 22, cs.Balance[len(cs.Balance)-2])
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+)
+
+var (
+	// ErrTaskInProgress is returned when child starts a task which is already open, e.g. button pressed twice
+	ErrTaskInProgress = errors.New("task in progress")
+	// ErrTooManyTasks is returned when child already holds as many open tasks as the family allows
+	ErrTooManyTasks = errors.New("too many open tasks")
+)
+
+// SetMaxOpenTasks changes number of tasks a child of parent's family can hold at once
+func (am *ActionManager) SetMaxOpenTasks(parentId int64, n int) error {
+	if n < 1 {
+		return fmt.Errorf("at least one open task must be allowed")
+	}
+
+	return am.updateFamilySettings(parentId, func(s *FamilySettings) {
+		s.MaxOpenTasks = n
+	})
+}
+
+// canStartTask checks if the child may open one more task with the operation
+func (am *ActionManager) canStartTask(childId int64, op string) error {
+	tasks, err := am.db.OpenTasks(childId)
+	if err != nil {
+		return fmt.Errorf("unable to load open tasks of %d: %w", childId, err)
+	}
+	for _, t := range tasks {
+		if t.Operation == op {
+			return ErrTaskInProgress
+		}
+	}
+
+	settings, err := am.FamilySettings(childId)
+	if err != nil {
+		return fmt.Errorf("unable to load family settings: %w", err)
+	}
+	if len(tasks) >= settings.MaxOpenTasks {
+		return ErrTooManyTasks
+	}
+	return nil
+}
+
+// StartTask opens a new task for the child, repeated button presses don't create duplicates
+func (am *ActionManager) StartTask(childId int64, op string) (*Transaction, error) {
+	if err := am.canStartTask(childId, op); err != nil {
+		return nil, err
+	}
+
+	return am.createTask(childId, op)
+}
+
+// CancelTask cancels open task of the child, reminders about it stop with the status change
+func (am *ActionManager) CancelTask(childId int64, txId string) error {
+	if err := am.db.CancelTask(childId, txId); err != nil {
+		return fmt.Errorf("unable to cancel task %s: %w", txId, err)
+	}
+	return nil
+}
+
+// RequestTaskCompletion asks parents to approve the task finished by the child.
+// The task becomes the target of the next photo proof sent by the child.
+func (am *ActionManager) RequestTaskCompletion(childId int64, txId string) ([]Notification, error) {
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find child: %w", err)
+	}
+
+	t, err := am.db.GetTransaction(childId, txId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find task: %w", err)
+	}
+	if !t.IsActive() {
+		return nil, fmt.Errorf("task %s is %s", txId, t.Status)
+	}
+	if err = am.db.SetPhotoTarget(childId, txId); err != nil {
+		return nil, fmt.Errorf("unable to remember photo target: %w", err)
+	}
+
+	required, err := am.PhotoRequired(childId, t.Operation)
+	if err != nil {
+		return nil, err
+	}
+	if required {
+		return nil, ErrPhotoRequired
+	}
+
+	if t, err = am.db.RequestCompletion(childId, txId); err != nil {
+		return nil, fmt.Errorf("unable to request completion: %w", err)
+	}
+
+	data := fmt.Sprintf("%d:%s", childId, t.ID)
+	return am.notifyParents(child,
+		fmt.Sprintf("@%s закончил задание %s. Подтвердите", child.Nickname, OperationTitle(t.Operation)),
+		Button{Text: "Подтвердить", Data: "taskok:" + data}, Button{Text: "Отклонить", Data: "taskno:" + data})
+}
+
+// SetPhotoTarget remembers the task the next photo of the user belongs to
+func (b *BoltDB) SetPhotoTarget(userId int64, txId string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(photoTargetsBucketName)).Put(itob64(userId), []byte(txId))
+	})
+}
+
+// photoTarget returns active task the next photo of the user belongs to: the last one the user finished,
+// or the only open task
+func photoTarget(tx *bbolt.Tx, userId int64) (Transaction, error) {
+	if v := tx.Bucket([]byte(photoTargetsBucketName)).Get(itob64(userId)); v != nil {
+		if t, err := activeTask(tx, userId, string(v)); err == nil {
+			return t, nil
+		}
+	}
+
+	tasks, err := openTasks(tx, userId)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if len(tasks) != 1 {
+		return Transaction{}, fmt.Errorf("%d open tasks of %d, photo target is unknown", len(tasks), userId)
+	}
+	return tasks[0], nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestActionManager_StartTask(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	assert.Error(t, am.SetMaxOpenTasks(2, 5), "only parent can change the limit")
+	assert.Error(t, am.SetMaxOpenTasks(1, 0))
+	require.NoError(t, am.SetMaxOpenTasks(1, 2))
+
+	walk, err := am.StartTask(2, OpWalkDog)
+	require.NoError(t, err)
+	shop, err := am.StartTask(2, OpGoToShop)
+	require.NoError(t, err)
+	_, err = am.StartTask(2, OpFreeDish)
+	assert.True(t, errors.Is(err, ErrTooManyTasks))
+
+	tasks, err := db.OpenTasks(2)
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+	assert.Equal(t, walk.ID, tasks[0].ID)
+	assert.Equal(t, shop.ID, tasks[1].ID)
+
+	// finished task keeps its slot until parent decides, the other one can be finished independently
+	notifications, err := am.RequestTaskCompletion(2, shop.ID)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "taskok:2:"+shop.ID, notifications[0].Buttons[0].Data)
+	_, err = am.StartTask(2, OpFreeDish)
+	assert.True(t, errors.Is(err, ErrTooManyTasks))
+
+	require.NoError(t, db.CancelTask(2, walk.ID))
+	_, err = am.StartTask(2, OpFreeDish)
+	require.NoError(t, err)
+
+	_, err = am.DecideTask(1, 2, shop.ID, true)
+	require.NoError(t, err)
+	tasks, err = db.OpenTasks(2)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, OpFreeDish, tasks[0].Operation)
+}
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"log"
+	"sort"
+	"strconv"
+)
+
+// transactionKey is a key of the transaction in the user bucket, big endian sequence id keeps creation order
+func transactionKey(id string) ([]byte, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction id %q: %w", id, err)
+	}
+	return itob64(int64(n)), nil
+}
+
+// statusKey is a key of the status index, status/userId/txId
+func statusKey(status string, userId int64, txKey []byte) []byte {
+	key := append([]byte(status+"/"), itob64(userId)...)
+	return append(key, txKey...)
+}
+
+// putTransaction stores transaction in the user bucket and keeps the status index in sync,
+// new transactions get the next id of the user bucket
+func putTransaction(tx *bbolt.Tx, t *Transaction) error {
+	userBkt, err := tx.CreateBucketIfNotExists(itob64(t.UserId))
+	if err != nil {
+		return fmt.Errorf("failed to create user bucket %d: %w", t.UserId, err)
+	}
+
+	if t.ID == "" {
+		id, _ := userBkt.NextSequence()
+		t.ID = strconv.FormatUint(id, 10)
+	}
+
+	key, err := transactionKey(t.ID)
+	if err != nil {
+		return err
+	}
+
+	idx := tx.Bucket([]byte(statusIndexBucketName))
+	if v := userBkt.Get(key); v != nil {
+		var stored Transaction
+		if err = json.Unmarshal(v, &stored); err != nil {
+			return fmt.Errorf("failed to unmarshal: %w", err)
+		}
+		if err = idx.Delete(statusKey(stored.Status, t.UserId, key)); err != nil {
+			return fmt.Errorf("failed to update status index: %w", err)
+		}
+	}
+
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err = userBkt.Put(key, buf); err != nil {
+		return fmt.Errorf("failed to store transaction: %w", err)
+	}
+	if err = idx.Put(statusKey(t.Status, t.UserId, key), nil); err != nil {
+		return fmt.Errorf("failed to update status index: %w", err)
+	}
+	return nil
+}
+
+// getTransaction loads transaction of the user by id
+func getTransaction(tx *bbolt.Tx, userId int64, txId string) (t Transaction, err error) {
+	key, err := transactionKey(txId)
+	if err != nil {
+		return t, err
+	}
+
+	userBkt := tx.Bucket(itob64(userId))
+	if userBkt == nil {
+		return t, fmt.Errorf("transactions of user %d not found", userId)
+	}
+
+	v := userBkt.Get(key)
+	if v == nil {
+		return t, fmt.Errorf("transaction %s of user %d not found", txId, userId)
+	}
+	if err = json.Unmarshal(v, &t); err != nil {
+		return t, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	return t, nil
+}
+
+// GetTransaction returns transaction of the user by id
+func (b *BoltDB) GetTransaction(userId int64, txId string) (t Transaction, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		t, err = getTransaction(tx, userId, txId)
+		return err
+	})
+
+	return t, err
+}
+
+// TransactionsByStatus returns transactions of all users with the given status, ordered by user and id
+func (b *BoltDB) TransactionsByStatus(status string) (transactions []Transaction, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		transactions, err = scanStatusIndex(tx, []byte(status+"/"))
+		return err
+	})
+
+	return transactions, err
+}
+
+// userTransactionsByStatus returns transactions of the user with the given status, ordered by id
+func userTransactionsByStatus(tx *bbolt.Tx, userId int64, status string) ([]Transaction, error) {
+	return scanStatusIndex(tx, statusKey(status, userId, nil))
+}
+
+// scanStatusIndex loads transactions referenced by status index keys with the prefix
+func scanStatusIndex(tx *bbolt.Tx, prefix []byte) (transactions []Transaction, err error) {
+	c := tx.Bucket([]byte(statusIndexBucketName)).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		rest := k[bytes.IndexByte(k, '/')+1:]
+		if len(rest) != 16 {
+			continue
+		}
+
+		userBkt := tx.Bucket(rest[:8])
+		if userBkt == nil {
+			continue
+		}
+		v := userBkt.Get(rest[8:])
+		if v == nil {
+			continue
+		}
+
+		var t Transaction
+		if err := json.Unmarshal(v, &t); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, nil
+}
+
+// lessID compares transaction ids in creation order
+func lessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// isUserBucket checks if the top level bucket keeps user transactions, its name is big endian user id
+func isUserBucket(name []byte) bool {
+	return len(name) == 8 && name[0] == 0
+}
+
+// migrateTransactions rekeys transactions stored by timestamp with their sequence ids and builds the status index.
+// It runs once, while the status index is empty.
+func migrateTransactions(tx *bbolt.Tx) error {
+	idx := tx.Bucket([]byte(statusIndexBucketName))
+	if k, _ := idx.Cursor().First(); k != nil {
+		return nil
+	}
+
+	var userBuckets [][]byte
+	err := tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+		if isUserBucket(name) {
+			userBuckets = append(userBuckets, append([]byte{}, name...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range userBuckets {
+		if err = migrateUserTransactions(tx, name); err != nil {
+			return fmt.Errorf("failed to migrate transactions of %x: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func migrateUserTransactions(tx *bbolt.Tx, name []byte) error {
+	userBkt := tx.Bucket(name)
+
+	var transactions []Transaction
+	var oldKeys [][]byte
+	err := userBkt.ForEach(func(k, v []byte) error {
+		var t Transaction
+		if err := json.Unmarshal(v, &t); err != nil {
+			return fmt.Errorf("failed to unmarshal: %w", err)
+		}
+		transactions = append(transactions, t)
+		oldKeys = append(oldKeys, append([]byte{}, k...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range oldKeys {
+		if err = userBkt.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	// keep existing ids, records without a valid or with a duplicated id get new ones in creation order
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Timestamp.Before(transactions[j].Timestamp)
+	})
+	seen := map[string]bool{}
+	maxId := userBkt.Sequence()
+	for i, t := range transactions {
+		n, err := strconv.ParseUint(t.ID, 10, 64)
+		if err != nil || n == 0 || seen[t.ID] {
+			transactions[i].ID = ""
+			continue
+		}
+		seen[t.ID] = true
+		if n > maxId {
+			maxId = n
+		}
+	}
+	if err = userBkt.SetSequence(maxId); err != nil {
+		return err
+	}
+
+	for _, t := range transactions {
+		t.UserId = int64(binary.BigEndian.Uint64(name))
+		if t.ID == "" {
+			log.Printf("[INFO] transaction of %d at %s got a new id", t.UserId, t.Timestamp)
+		}
+		if err = putTransaction(tx, &t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bbolt "go.etcd.io/bbolt"
+	"testing"
+	"time"
+)
+
+func TestBoltDB_GetTransaction(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+
+	tr, err := db.CreateTransaction(OpWalkDog, 1)
+	require.NoError(t, err)
+
+	stored, err := db.GetTransaction(1, tr.ID)
+	require.NoError(t, err)
+	assert.Equal(t, OpWalkDog, stored.Operation)
+
+	_, err = db.GetTransaction(1, "100")
+	assert.Error(t, err)
+	_, err = db.GetTransaction(2, tr.ID)
+	assert.Error(t, err)
+
+	open, err := db.TransactionsByStatus(OpenStatus)
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+	assert.Equal(t, tr.ID, open[0].ID)
+
+	_, err = db.ApproveTransaction(1, tr.ID)
+	require.NoError(t, err)
+
+	open, err = db.TransactionsByStatus(OpenStatus)
+	require.NoError(t, err)
+	assert.Empty(t, open)
+	completed, err := db.TransactionsByStatus(CompletedStatus)
+	require.NoError(t, err)
+	assert.Len(t, completed, 1)
+}
+
+func TestMigrateTransactions(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+
+	// transactions keyed by timestamp with zone offsets, the order of keys doesn't match creation order
+	moscow := time.FixedZone("MSK", 3*3600)
+	first := time.Date(2022, 5, 2, 10, 0, 0, 0, moscow)
+	second := time.Date(2022, 5, 2, 8, 0, 0, 0, time.UTC)
+	require.NoError(t, db.db.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists(itob64(1))
+		require.NoError(t, err)
+		require.NoError(t, bkt.SetSequence(2))
+		for _, tr := range []Transaction{
+			{ID: "1", Timestamp: first, Operation: OpWalkDog, Status: CompletedStatus, UserId: 1},
+			{ID: "2", Timestamp: second, Operation: OpGoToShop, Status: OpenStatus, UserId: 1},
+			{Timestamp: second.Add(time.Minute), Operation: OpFreeDish, Status: CanceledStatus, UserId: 1},
+		} {
+			buf, err := json.Marshal(tr)
+			require.NoError(t, err)
+			require.NoError(t, bkt.Put([]byte(tr.Timestamp.Format(TSNano)), buf))
+		}
+		return nil
+	}))
+
+	require.NoError(t, db.db.Update(migrateTransactions))
+
+	transactions, err := db.ShowLastNTransactions(1, 10)
+	require.NoError(t, err)
+	require.Len(t, transactions, 3)
+	assert.Equal(t, []string{"3", "2", "1"}, []string{transactions[0].ID, transactions[1].ID, transactions[2].ID})
+	assert.Equal(t, OpFreeDish, transactions[0].Operation, "record without id got the next one")
+
+	stored, err := db.GetTransaction(1, "2")
+	require.NoError(t, err)
+	assert.Equal(t, OpGoToShop, stored.Operation)
+
+	open, err := db.TransactionsByStatus(OpenStatus)
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+	assert.Equal(t, "2", open[0].ID)
+
+	tr, err := db.CreateTransaction(OpWalkDog, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "4", tr.ID)
+}
@@ -7,6 +7,16 @@ const (
 	CompletedStatus = "COMPLETED"
 	CanceledStatus  = "CANCELED"
 	ApprovedStatus  = "APPROVED"
+	PendingStatus   = "PENDING"  // completed by child, waits for parent approval
+	DeclinedStatus  = "DECLINED" // task assigned by parent was declined by child
+	ExpiredStatus   = "EXPIRED"  // task was not completed before the deadline
+)
+
+// transaction kinds, empty kind is a task
+const (
+	KindTask    = "task"
+	KindBonus   = "bonus"
+	KindPenalty = "penalty"
 )
 
 type Transaction struct {
@@ -15,5 +25,44 @@ type Transaction struct {
 	Operation string    `json:"operation"`
 	Cost      int       `json:"cost"`
 	UserId    int64     `json:"user_id"`
-	Status    string    `json: "status"`
+	Status    string    `json:"status"`
+
+	RequestedAt time.Time `json:"requested_at"` // when child asked parent to approve completion
+	Kind        string    `json:"kind,omitempty"`
+	Reason      string    `json:"reason,omitempty"`   // why parent granted bonus or penalty
+	Ref         string    `json:"ref,omitempty"`      // id of the related goal, reward etc.
+	PhotoID     string    `json:"photo_id,omitempty"` // telegram file id of the completion proof
+
+	AssignedBy int64     `json:"assigned_by,omitempty"` // parent who assigned the task, 0 if child took it
+	AcceptedAt time.Time `json:"accepted_at,omitempty"` // when child accepted assigned task
+	Deadline   time.Time `json:"deadline,omitempty"`    // open task expires after
+
+	ExpiryPenalty int    `json:"expiry_penalty,omitempty"` // charged when the task expires
+	Board         string `json:"board,omitempty"`          // familyId:boardTaskId of the task claimed from the board
+	Rejections    int    `json:"rejections,omitempty"`     // times parent sent the finished task back
+}
+
+// EffectiveKind returns transaction kind, legacy transactions without kind are tasks
+func (t Transaction) EffectiveKind() string {
+	if t.Kind == "" {
+		return KindTask
+	}
+	return t.Kind
+}
+
+// BalanceDelta returns the amount by which the transaction changed the balance
+func (t Transaction) BalanceDelta() int {
+	if t.Status != CompletedStatus && t.Status != ApprovedStatus {
+		return 0
+	}
+	switch t.EffectiveKind() {
+	case KindPenalty, KindGoal, KindPurchase, KindWithdrawal:
+		return -t.Cost
+	}
+	return t.Cost
+}
+
+// IsActive checks if the transaction is not finished yet
+func (t Transaction) IsActive() bool {
+	return t.Status == OpenStatus || t.Status == PendingStatus
 }
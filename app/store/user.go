@@ -13,4 +13,5 @@ type User struct {
 	Nickname       string    `json:"nickname"`
 	Type           int       `json:"type"`
 	RegistrationTS time.Time `json:"registration_ts" bson:"time"`
+	Badges         []Badge   `json:"badges,omitempty"` // achievements earned by the child
 }
@@ -0,0 +1,343 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WithdrawalPendingStatus  = "PENDING"
+	WithdrawalApprovedStatus = "APPROVED" // coins deducted, money is owed to the child
+	WithdrawalPaidStatus     = "PAID"
+	WithdrawalRejectedStatus = "REJECTED"
+
+	KindWithdrawal = "withdrawal" // coins exchanged to money
+)
+
+// Rate is a family's exchange rate, rates are stored in rates_<familyId> bucket, since -> rate
+type Rate struct {
+	Kopecks    int       `json:"kopecks"`     // price of one coin
+	MinCashOut int       `json:"min_cashout"` // min coins in one withdrawal
+	Since      time.Time `json:"since"`
+}
+
+// Withdrawal is child's request to exchange coins to money, the rate is fixed at request time
+type Withdrawal struct {
+	ID          string    `json:"id"`
+	ChildID     int64     `json:"child_id"`
+	FamilyID    int64     `json:"family_id"`
+	Coins       int       `json:"coins"`
+	RateKopecks int       `json:"rate_kopecks"`
+	Kopecks     int       `json:"kopecks"`
+	Status      string    `json:"status"`
+	Created     time.Time `json:"created"`
+	Decided     time.Time `json:"decided"`
+	Paid        time.Time `json:"paid"`
+}
+
+// CashSummary is money owed and paid to children of a family
+type CashSummary struct {
+	OwedKopecks int
+	PaidKopecks int
+	Owed        []Withdrawal
+}
+
+// FormatRubles formats kopecks as rubles, e.g. 12.50 ₽
+func FormatRubles(kopecks int) string {
+	sign := ""
+	if kopecks < 0 {
+		sign, kopecks = "-", -kopecks
+	}
+	return fmt.Sprintf("%s%d.%02d ₽", sign, kopecks/100, kopecks%100)
+}
+
+// ParseRubles parses amount like 1.5 or 1,50 into kopecks
+func ParseRubles(s string) (int, error) {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid amount %s", s)
+	}
+	return int(math.Round(f * 100)), nil
+}
+
+func ratesBucketName(familyId int64) []byte {
+	return []byte("rates_" + strconv.FormatInt(familyId, 10))
+}
+
+// AddRate appends rate to the family's rate history
+func (b *BoltDB) AddRate(familyId int64, r Rate) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists(ratesBucketName(familyId))
+		if err != nil {
+			return fmt.Errorf("failed to create rates bucket of %d: %w", familyId, err)
+		}
+
+		buf, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return bkt.Put(itob64(r.Since.UnixNano()), buf)
+	})
+}
+
+// Rates returns family's rate history, the latest rate first
+func (b *BoltDB) Rates(familyId int64) (rates []Rate, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(ratesBucketName(familyId))
+		if bkt == nil {
+			return nil
+		}
+
+		c := bkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var r Rate
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			rates = append(rates, r)
+		}
+		return nil
+	})
+
+	return rates, err
+}
+
+// SaveWithdrawal creates or updates withdrawal
+func (b *BoltDB) SaveWithdrawal(w Withdrawal) (Withdrawal, error) {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		return saveWithdrawal(tx, &w)
+	})
+
+	return w, err
+}
+
+func saveWithdrawal(tx *bbolt.Tx, w *Withdrawal) error {
+	bkt := tx.Bucket([]byte(withdrawalsBucketName))
+
+	if w.ID == "" {
+		id, _ := bkt.NextSequence()
+		w.ID = fmt.Sprint(id)
+	}
+
+	buf, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	return bkt.Put([]byte(w.ID), buf)
+}
+
+// GetWithdrawal returns withdrawal by id
+func (b *BoltDB) GetWithdrawal(withdrawalId string) (w Withdrawal, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		return b.load(tx.Bucket([]byte(withdrawalsBucketName)), withdrawalId, &w)
+	})
+
+	return w, err
+}
+
+// Withdrawals returns withdrawals of the family
+func (b *BoltDB) Withdrawals(familyId int64) (withdrawals []Withdrawal, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(withdrawalsBucketName)).ForEach(func(k, v []byte) error {
+			var w Withdrawal
+			if err := json.Unmarshal(v, &w); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			if w.FamilyID == familyId {
+				withdrawals = append(withdrawals, w)
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(withdrawals, func(i, j int) bool { return withdrawals[i].Created.Before(withdrawals[j].Created) })
+	return withdrawals, err
+}
+
+// ApproveWithdrawal deducts withdrawn coins from child's balance and marks money as owed atomically
+func (b *BoltDB) ApproveWithdrawal(withdrawalId string, now time.Time) (w Withdrawal, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		if err := b.load(tx.Bucket([]byte(withdrawalsBucketName)), withdrawalId, &w); err != nil {
+			return err
+		}
+		if w.Status != WithdrawalPendingStatus {
+			return fmt.Errorf("withdrawal %s is already %s", withdrawalId, w.Status)
+		}
+
+		if balance := balanceOf(tx, w.ChildID); balance < w.Coins {
+			return fmt.Errorf("not enough coins for withdrawal %s: %d of %d", withdrawalId, balance, w.Coins)
+		}
+
+		if _, err := postTransaction(tx, Transaction{Operation: KindWithdrawal, Kind: KindWithdrawal, Cost: w.Coins,
+			UserId: w.ChildID, Reason: FormatRubles(w.Kopecks), Ref: w.ID}); err != nil {
+			return err
+		}
+
+		w.Status = WithdrawalApprovedStatus
+		w.Decided = now
+		return saveWithdrawal(tx, &w)
+	})
+
+	return w, err
+}
+
+// SetRate adds new exchange rate to the parent's family history
+func (am *ActionManager) SetRate(parentId int64, kopecks, minCashOut int) error {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return err
+	}
+
+	if kopecks <= 0 || minCashOut < 0 {
+		return fmt.Errorf("invalid rate %d with min cash-out %d", kopecks, minCashOut)
+	}
+
+	return am.db.AddRate(familyId, Rate{Kopecks: kopecks, MinCashOut: minCashOut, Since: time.Now()})
+}
+
+// Rates returns exchange rate history of the user's family, the latest rate first
+func (am *ActionManager) Rates(userId int64) ([]Rate, error) {
+	familyId, err := am.FamilyID(userId)
+	if err != nil {
+		return nil, err
+	}
+	return am.db.Rates(familyId)
+}
+
+// CurrentRate returns the latest exchange rate of the user's family
+func (am *ActionManager) CurrentRate(userId int64) (Rate, error) {
+	rates, err := am.Rates(userId)
+	if err != nil {
+		return Rate{}, fmt.Errorf("unable to load rates: %w", err)
+	}
+	if len(rates) == 0 {
+		return Rate{}, fmt.Errorf("exchange rate of user %d family is not set", userId)
+	}
+
+	return rates[0], nil
+}
+
+// RequestWithdrawal creates child's request to exchange coins to money at the current rate
+func (am *ActionManager) RequestWithdrawal(childId int64, coins int) ([]Notification, error) {
+	rate, err := am.CurrentRate(childId)
+	if err != nil {
+		return nil, err
+	}
+
+	if coins <= 0 || coins < rate.MinCashOut {
+		return nil, fmt.Errorf("withdrawal of %d coins is less than minimum %d", coins, rate.MinCashOut)
+	}
+
+	balance, err := am.db.Balance(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get balance: %w", err)
+	}
+	if balance < coins {
+		return nil, fmt.Errorf("not enough coins for withdrawal: %d of %d", balance, coins)
+	}
+
+	familyId, err := am.FamilyID(childId)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := am.db.SaveWithdrawal(Withdrawal{ChildID: childId, FamilyID: familyId, Coins: coins, RateKopecks: rate.Kopecks,
+		Kopecks: coins * rate.Kopecks, Status: WithdrawalPendingStatus, Created: time.Now()})
+	if err != nil {
+		return nil, fmt.Errorf("unable to save withdrawal: %w", err)
+	}
+
+	child, err := am.db.FindUser(childId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find child: %w", err)
+	}
+
+	return am.notifyParents(child, fmt.Sprintf("%s хочет обменять %d dinocoins на %s (курс %s)", child.Nickname,
+		w.Coins, FormatRubles(w.Kopecks), FormatRubles(w.RateKopecks)),
+		Button{Text: "Одобрить", Data: "wdok:" + w.ID}, Button{Text: "Отклонить", Data: "wdno:" + w.ID})
+}
+
+// DecideWithdrawal approves or rejects child's withdrawal, returns notifications for the child
+func (am *ActionManager) DecideWithdrawal(parentId int64, withdrawalId string, approve bool) (Withdrawal, []Notification, error) {
+	w, err := am.db.GetWithdrawal(withdrawalId)
+	if err != nil {
+		return Withdrawal{}, nil, fmt.Errorf("unable to find withdrawal: %w", err)
+	}
+
+	child, err := am.findOwnChildById(parentId, w.ChildID)
+	if err != nil {
+		return Withdrawal{}, nil, err
+	}
+
+	if !approve {
+		if w.Status != WithdrawalPendingStatus {
+			return Withdrawal{}, nil, fmt.Errorf("withdrawal %s is already %s", withdrawalId, w.Status)
+		}
+		w.Status = WithdrawalRejectedStatus
+		w.Decided = time.Now()
+		if w, err = am.db.SaveWithdrawal(w); err != nil {
+			return Withdrawal{}, nil, fmt.Errorf("unable to save withdrawal: %w", err)
+		}
+		return w, []Notification{{ChatID: child.ChatID, Text: "Родители отклонили обмен динокоинов"}}, nil
+	}
+
+	if w, err = am.db.ApproveWithdrawal(withdrawalId, time.Now()); err != nil {
+		return Withdrawal{}, nil, fmt.Errorf("unable to approve withdrawal: %w", err)
+	}
+
+	return w, []Notification{{ChatID: child.ChatID, Text: fmt.Sprintf("Обмен одобрен: %d dinocoins = %s",
+		w.Coins, FormatRubles(w.Kopecks))}}, nil
+}
+
+// MarkWithdrawalPaid records that parent gave the money to the child
+func (am *ActionManager) MarkWithdrawalPaid(parentId int64, withdrawalId string) (Withdrawal, error) {
+	w, err := am.db.GetWithdrawal(withdrawalId)
+	if err != nil {
+		return Withdrawal{}, fmt.Errorf("unable to find withdrawal: %w", err)
+	}
+
+	if _, err = am.findOwnChildById(parentId, w.ChildID); err != nil {
+		return Withdrawal{}, err
+	}
+
+	if w.Status != WithdrawalApprovedStatus {
+		return Withdrawal{}, fmt.Errorf("withdrawal %s is %s, can't be paid", withdrawalId, w.Status)
+	}
+
+	w.Status = WithdrawalPaidStatus
+	w.Paid = time.Now()
+	return am.db.SaveWithdrawal(w)
+}
+
+// CashSummary returns money owed and paid to the children of the parent's family
+func (am *ActionManager) CashSummary(parentId int64) (CashSummary, error) {
+	familyId, err := am.familyOfParent(parentId)
+	if err != nil {
+		return CashSummary{}, err
+	}
+
+	withdrawals, err := am.db.Withdrawals(familyId)
+	if err != nil {
+		return CashSummary{}, fmt.Errorf("unable to load withdrawals: %w", err)
+	}
+
+	var summary CashSummary
+	for _, w := range withdrawals {
+		switch w.Status {
+		case WithdrawalApprovedStatus:
+			summary.OwedKopecks += w.Kopecks
+			summary.Owed = append(summary.Owed, w)
+		case WithdrawalPaidStatus:
+			summary.PaidKopecks += w.Kopecks
+		}
+	}
+
+	return summary, nil
+}
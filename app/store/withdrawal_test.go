@@ -0,0 +1,94 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestActionManager_Withdrawals(t *testing.T) {
+	var db, teardown = prepare(t)
+	defer teardown()
+	am, err := NewActionManager(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RegisterUser(User{ID: 1, ChatID: 100, Nickname: "dad", Type: PARENT}))
+	require.NoError(t, db.RegisterUser(User{ID: 2, ChatID: 200, Nickname: "kid", Type: CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+	_, err = db.ChangeBalance(2, 500)
+	require.NoError(t, err)
+
+	_, err = am.RequestWithdrawal(2, 100)
+	assert.Error(t, err, "rate is not set")
+
+	assert.Error(t, am.SetRate(2, 50, 0), "only parent can set rate")
+	require.NoError(t, am.SetRate(1, 50, 100))
+
+	_, err = am.RequestWithdrawal(2, 50)
+	assert.Error(t, err, "less than minimum")
+	_, err = am.RequestWithdrawal(2, 600)
+	assert.Error(t, err, "not enough coins")
+
+	notifications, err := am.RequestWithdrawal(2, 200)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Contains(t, notifications[0].Text, "100.00 ₽")
+	first := notifications[0].Buttons[0].Data[len("wdok:"):]
+
+	// new rate doesn't change requested withdrawal
+	require.NoError(t, am.SetRate(1, 150, 100))
+	rates, err := am.Rates(2)
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+	assert.Equal(t, 150, rates[0].Kopecks)
+
+	w, _, err := am.DecideWithdrawal(1, first, true)
+	require.NoError(t, err)
+	assert.Equal(t, 10000, w.Kopecks)
+	assert.Equal(t, 50, w.RateKopecks)
+	_, _, err = am.DecideWithdrawal(1, first, true)
+	assert.Error(t, err, "can't be approved twice")
+
+	notifications, err = am.RequestWithdrawal(2, 100)
+	require.NoError(t, err)
+	second := notifications[0].Buttons[0].Data[len("wdok:"):]
+	_, _, err = am.DecideWithdrawal(1, second, false)
+	require.NoError(t, err)
+
+	balance, err := db.Balance(2)
+	require.NoError(t, err)
+	assert.Equal(t, 300, balance)
+
+	summary, err := am.CashSummary(1)
+	require.NoError(t, err)
+	assert.Equal(t, 10000, summary.OwedKopecks)
+	assert.Len(t, summary.Owed, 1)
+
+	_, err = am.MarkWithdrawalPaid(1, second)
+	assert.Error(t, err, "rejected withdrawal can't be paid")
+	_, err = am.MarkWithdrawalPaid(1, first)
+	require.NoError(t, err)
+
+	summary, err = am.CashSummary(1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, summary.OwedKopecks)
+	assert.Equal(t, 10000, summary.PaidKopecks)
+
+	transactions, err := db.ShowLastNTransactions(2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, KindWithdrawal, transactions[0].Kind)
+	assert.Equal(t, -200, transactions[0].BalanceDelta())
+}
+
+func TestParseRubles(t *testing.T) {
+	for s, kopecks := range map[string]int{"1": 100, "1.5": 150, "0,35": 35, "2.999": 300} {
+		v, err := ParseRubles(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, kopecks, v, s)
+	}
+	_, err := ParseRubles("abc")
+	assert.Error(t, err)
+	assert.Equal(t, "12.05 ₽", FormatRubles(1205))
+	assert.Equal(t, "-1.50 ₽", FormatRubles(-150))
+	assert.Equal(t, "-0.05 ₽", FormatRubles(-5))
+}
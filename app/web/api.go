@@ -0,0 +1,397 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"main/store"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const apiPrefix = "/api/v1/"
+
+// apiRoute is a handler of the api path, "*" segments of the pattern are passed to the handler as params
+type apiRoute struct {
+	method  string
+	pattern []string
+	handle  func(r *http.Request, parent store.User, params []string) (int, interface{}, error)
+}
+
+// apiError is an error with http status of the api response
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e apiError) Error() string {
+	return e.err.Error()
+}
+
+type userResponse struct {
+	ID       int64  `json:"id"`
+	Nickname string `json:"nickname"`
+}
+
+type childResponse struct {
+	ID       int64  `json:"id"`
+	Nickname string `json:"nickname"`
+	Balance  int    `json:"balance"`
+}
+
+type familyResponse struct {
+	ID       int64           `json:"id"`
+	Parent   userResponse    `json:"parent"`
+	Children []childResponse `json:"children"`
+	Costs    map[string]int  `json:"costs"`
+}
+
+type balanceResponse struct {
+	Balance int `json:"balance"`
+}
+
+type taskRequest struct {
+	Operation string    `json:"operation"`
+	Reward    int       `json:"reward"`
+	Deadline  time.Time `json:"deadline"`
+	Penalty   int       `json:"penalty"`
+}
+
+type adjustmentRequest struct {
+	Type   string `json:"type"` // bonus or penalty
+	Amount int    `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{http.MethodGet, []string{"family"}, s.apiFamily},
+		{http.MethodGet, []string{"children"}, s.apiChildren},
+		{http.MethodGet, []string{"children", "*"}, s.apiChild},
+		{http.MethodGet, []string{"children", "*", "balance"}, s.apiBalance},
+		{http.MethodGet, []string{"children", "*", "transactions"}, s.apiTransactions},
+		{http.MethodGet, []string{"children", "*", "tasks"}, s.apiTasks},
+		{http.MethodPost, []string{"children", "*", "tasks"}, s.apiAssignTask},
+		{http.MethodPost, []string{"children", "*", "tasks", "*", "approve"}, s.apiDecideTask(true)},
+		{http.MethodPost, []string{"children", "*", "tasks", "*", "reject"}, s.apiDecideTask(false)},
+		{http.MethodPost, []string{"children", "*", "adjustments"}, s.apiAdjust},
+		{http.MethodGet, []string{"withdrawals"}, s.apiWithdrawals},
+		{http.MethodPost, []string{"withdrawals", "*", "approve"}, s.apiDecideWithdrawal(true)},
+		{http.MethodPost, []string{"withdrawals", "*", "reject"}, s.apiDecideWithdrawal(false)},
+		{http.MethodPost, []string{"withdrawals", "*", "paid"}, s.apiWithdrawalPaid},
+	}
+}
+
+// api authorizes request with family token from "Authorization: Bearer <token>" and routes it
+func (s *Server) api(w http.ResponseWriter, r *http.Request) {
+	var parent store.User
+	err := fmt.Errorf("no bearer token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		parent, err = s.am.AuthorizeAPIToken(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if err != nil {
+		log.Printf("[WARN] api request %s rejected: %+v", r.URL.Path, err)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid api token"})
+		return
+	}
+
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+	methodAllowed := false
+	for _, route := range s.apiRoutes() {
+		params, ok := matchPath(route.pattern, path)
+		if !ok {
+			continue
+		}
+		if route.method != r.Method {
+			methodAllowed = true
+			continue
+		}
+
+		status, body, err := route.handle(r, parent, params)
+		if err != nil {
+			status = http.StatusBadRequest
+			var e apiError
+			if errors.As(err, &e) {
+				status = e.status
+			}
+			log.Printf("[WARN] api %s %s by %d: %+v", r.Method, r.URL.Path, parent.ID, err)
+			body = map[string]string{"error": err.Error()}
+		}
+		writeJSON(w, status, body)
+		return
+	}
+
+	if methodAllowed {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+}
+
+// matchPath checks path segments against the pattern and returns values of "*" segments
+func matchPath(pattern, path []string) ([]string, bool) {
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+
+	var params []string
+	for i, p := range pattern {
+		switch {
+		case p == "*" && path[i] != "":
+			params = append(params, path[i])
+		case p != path[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("[WARN] unable to write api response: %+v", err)
+	}
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// findChild returns parent's child by nickname, without "@"
+func (s *Server) findChild(parentId int64, nickname string) (store.User, error) {
+	children, err := s.am.OwnChildren(parentId)
+	if err != nil {
+		return store.User{}, apiError{http.StatusInternalServerError, err}
+	}
+	for _, c := range children {
+		if c.Nickname == nickname {
+			return c, nil
+		}
+	}
+	return store.User{}, apiError{http.StatusNotFound, fmt.Errorf("child %s not found", nickname)}
+}
+
+func (s *Server) childResponse(u store.User) (childResponse, error) {
+	balance, err := s.db.Balance(u.ID)
+	if err != nil {
+		return childResponse{}, apiError{http.StatusInternalServerError, fmt.Errorf("unable to load balance: %w", err)}
+	}
+	return childResponse{ID: u.ID, Nickname: u.Nickname, Balance: balance}, nil
+}
+
+func (s *Server) apiFamily(_ *http.Request, parent store.User, _ []string) (int, interface{}, error) {
+	familyId, err := s.am.FamilyID(parent.ID)
+	if err != nil {
+		return 0, nil, apiError{http.StatusInternalServerError, err}
+	}
+
+	resp := familyResponse{ID: familyId, Parent: userResponse{ID: parent.ID, Nickname: parent.Nickname},
+		Costs: map[string]int{}}
+	if resp.Children, err = s.childResponses(parent.ID); err != nil {
+		return 0, nil, err
+	}
+
+	for _, op := range store.TaskOperations {
+		if resp.Costs[op], err = s.am.OperationCost(parent.ID, op); err != nil {
+			return 0, nil, apiError{http.StatusInternalServerError, err}
+		}
+	}
+	return http.StatusOK, resp, nil
+}
+
+// childResponses returns parent's children with their balances
+func (s *Server) childResponses(parentId int64) ([]childResponse, error) {
+	children, err := s.am.OwnChildren(parentId)
+	if err != nil {
+		return nil, apiError{http.StatusInternalServerError, err}
+	}
+
+	resp := make([]childResponse, 0, len(children))
+	for _, c := range children {
+		child, err := s.childResponse(c)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, child)
+	}
+	return resp, nil
+}
+
+func (s *Server) apiChildren(_ *http.Request, parent store.User, _ []string) (int, interface{}, error) {
+	resp, err := s.childResponses(parent.ID)
+	return http.StatusOK, resp, err
+}
+
+func (s *Server) apiChild(_ *http.Request, parent store.User, params []string) (int, interface{}, error) {
+	child, err := s.findChild(parent.ID, params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := s.childResponse(child)
+	return http.StatusOK, resp, err
+}
+
+func (s *Server) apiBalance(_ *http.Request, parent store.User, params []string) (int, interface{}, error) {
+	child, err := s.findChild(parent.ID, params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := s.childResponse(child)
+	return http.StatusOK, balanceResponse{Balance: resp.Balance}, err
+}
+
+func (s *Server) apiTransactions(r *http.Request, parent store.User, params []string) (int, interface{}, error) {
+	child, err := s.findChild(parent.ID, params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = store.PeriodMonth
+	}
+	_, transactions, err := s.am.History(parent.ID, "@"+child.Nickname, period)
+	if err != nil {
+		return 0, nil, err
+	}
+	if transactions == nil {
+		transactions = []store.Transaction{}
+	}
+	return http.StatusOK, transactions, nil
+}
+
+func (s *Server) apiTasks(_ *http.Request, parent store.User, params []string) (int, interface{}, error) {
+	child, err := s.findChild(parent.ID, params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tasks, err := s.db.OpenTasks(child.ID)
+	if err != nil {
+		return 0, nil, apiError{http.StatusInternalServerError, fmt.Errorf("unable to load tasks: %w", err)}
+	}
+	if tasks == nil {
+		tasks = []store.Transaction{}
+	}
+	return http.StatusOK, tasks, nil
+}
+
+// apiAssignTask gives the task to the child the same way /assign does
+func (s *Server) apiAssignTask(r *http.Request, parent store.User, params []string) (int, interface{}, error) {
+	child, err := s.findChild(parent.ID, params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var req taskRequest
+	if err = readJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	t, notifications, err := s.am.Assign(parent.ID, store.Assignment{ChildNickName: "@" + child.Nickname,
+		Operation: req.Operation, Reward: req.Reward, Penalty: req.Penalty, Deadline: req.Deadline}, time.Now())
+	if err != nil {
+		return 0, nil, err
+	}
+	s.notify(notifications)
+	return http.StatusCreated, t, nil
+}
+
+func (s *Server) apiDecideTask(approve bool) func(*http.Request, store.User, []string) (int, interface{}, error) {
+	return func(_ *http.Request, parent store.User, params []string) (int, interface{}, error) {
+		child, err := s.findChild(parent.ID, params[0])
+		if err != nil {
+			return 0, nil, err
+		}
+
+		notifications, err := s.am.DecideTask(parent.ID, child.ID, params[1], approve)
+		if err != nil {
+			return 0, nil, err
+		}
+		s.notify(notifications)
+
+		t, err := s.db.GetTransaction(child.ID, params[1])
+		if err != nil {
+			return 0, nil, apiError{http.StatusInternalServerError, err}
+		}
+		return http.StatusOK, t, nil
+	}
+}
+
+// apiAdjust grants bonus or fine to the child and returns the new balance
+func (s *Server) apiAdjust(r *http.Request, parent store.User, params []string) (int, interface{}, error) {
+	child, err := s.findChild(parent.ID, params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var req adjustmentRequest
+	if err = readJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	var notifications []store.Notification
+	switch req.Type {
+	case store.KindBonus:
+		notifications, err = s.am.GrantBonus(parent.ID, "@"+child.Nickname, req.Amount, req.Reason)
+	case store.KindPenalty:
+		notifications, err = s.am.Fine(parent.ID, "@"+child.Nickname, req.Amount, req.Reason)
+	default:
+		return 0, nil, fmt.Errorf("type should be %s or %s", store.KindBonus, store.KindPenalty)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	s.notify(notifications)
+
+	resp, err := s.childResponse(child)
+	return http.StatusOK, balanceResponse{Balance: resp.Balance}, err
+}
+
+func (s *Server) apiWithdrawals(r *http.Request, parent store.User, _ []string) (int, interface{}, error) {
+	familyId, err := s.am.FamilyID(parent.ID)
+	if err != nil {
+		return 0, nil, apiError{http.StatusInternalServerError, err}
+	}
+
+	withdrawals, err := s.db.Withdrawals(familyId)
+	if err != nil {
+		return 0, nil, apiError{http.StatusInternalServerError, fmt.Errorf("unable to load withdrawals: %w", err)}
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	resp := make([]store.Withdrawal, 0, len(withdrawals))
+	for _, wd := range withdrawals {
+		if status == "" || wd.Status == status {
+			resp = append(resp, wd)
+		}
+	}
+	return http.StatusOK, resp, nil
+}
+
+func (s *Server) apiDecideWithdrawal(approve bool) func(*http.Request, store.User, []string) (int, interface{}, error) {
+	return func(_ *http.Request, parent store.User, params []string) (int, interface{}, error) {
+		wd, notifications, err := s.am.DecideWithdrawal(parent.ID, params[0], approve)
+		if err != nil {
+			return 0, nil, err
+		}
+		s.notify(notifications)
+		return http.StatusOK, wd, nil
+	}
+}
+
+func (s *Server) apiWithdrawalPaid(_ *http.Request, parent store.User, params []string) (int, interface{}, error) {
+	wd, err := s.am.MarkWithdrawalPaid(parent.ID, params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, wd, nil
+}
@@ -0,0 +1,134 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"main/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func apiCall(t *testing.T, srv *Server, method, path, token, body string, resp interface{}) int {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := serve(srv, r, nil)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	if resp != nil {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp), w.Body.String())
+	}
+	return w.Code
+}
+
+func TestServer_APIAuth(t *testing.T) {
+	srv, am, _ := prepare(t)
+
+	assert.Equal(t, http.StatusUnauthorized, apiCall(t, srv, http.MethodGet, "/api/v1/family", "", "", nil))
+	assert.Equal(t, http.StatusUnauthorized, apiCall(t, srv, http.MethodGet, "/api/v1/family", "bad", "", nil))
+
+	token, _, err := am.IssueAPIToken(1, "dashboard", time.Now())
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/family", nil)
+	r.Header.Set("Authorization", token)
+	assert.Equal(t, http.StatusUnauthorized, serve(srv, r, nil).Code, "bearer scheme is required")
+
+	var family familyResponse
+	assert.Equal(t, http.StatusOK, apiCall(t, srv, http.MethodGet, "/api/v1/family", token, "", &family))
+	assert.Equal(t, int64(1), family.ID)
+	require.Len(t, family.Children, 1)
+	assert.Equal(t, "kid", family.Children[0].Nickname)
+	assert.Equal(t, 10, family.Costs[store.OpWalkDog])
+
+	assert.Equal(t, http.StatusNotFound, apiCall(t, srv, http.MethodGet, "/api/v1/children/stranger", token, "", nil))
+	assert.Equal(t, http.StatusNotFound, apiCall(t, srv, http.MethodGet, "/api/v1/unknown", token, "", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, apiCall(t, srv, http.MethodDelete, "/api/v1/children", token, "", nil))
+}
+
+func TestServer_APITasks(t *testing.T) {
+	srv, am, sent := prepare(t)
+	token, _, err := am.IssueAPIToken(1, "script", time.Now())
+	require.NoError(t, err)
+
+	var task store.Transaction
+	code := apiCall(t, srv, http.MethodPost, "/api/v1/children/kid/tasks", token,
+		`{"operation": "wash_floor_in_flat", "reward": 40}`, &task)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, 40, task.Cost)
+	assert.Equal(t, int64(1), task.AssignedBy)
+	require.Len(t, *sent, 1)
+	assert.Equal(t, int64(200), (*sent)[0].ChatID, "child is asked to accept the task")
+
+	deadline := time.Now().Add(3*time.Hour + 30*time.Second).UTC()
+	var shop store.Transaction
+	code = apiCall(t, srv, http.MethodPost, "/api/v1/children/kid/tasks", token,
+		`{"operation": "go_to_shop", "deadline": "`+deadline.Format(time.RFC3339Nano)+`", "penalty": 5}`, &shop)
+	require.Equal(t, http.StatusCreated, code)
+	assert.True(t, deadline.Equal(shop.Deadline), "deadline is kept as sent, %s", shop.Deadline)
+	assert.Equal(t, 5, shop.ExpiryPenalty)
+
+	code = apiCall(t, srv, http.MethodPost, "/api/v1/children/kid/tasks", token, `{"operation": "custom"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, code, "custom task requires reward")
+	code = apiCall(t, srv, http.MethodPost, "/api/v1/children/kid/tasks", token, `{"unknown": 1}`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = apiCall(t, srv, http.MethodPost, "/api/v1/children/kid/tasks", token, `{"operation": "walk_dog", "reward": -1}`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	var tasks []store.Transaction
+	assert.Equal(t, http.StatusOK, apiCall(t, srv, http.MethodGet, "/api/v1/children/kid/tasks", token, "", &tasks))
+	require.Len(t, tasks, 2)
+
+	_, err = am.RequestTaskCompletion(2, task.ID)
+	require.NoError(t, err)
+	code = apiCall(t, srv, http.MethodPost, "/api/v1/children/kid/tasks/"+task.ID+"/approve", token, "", &task)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, store.CompletedStatus, task.Status)
+	code = apiCall(t, srv, http.MethodPost, "/api/v1/children/kid/tasks/"+task.ID+"/approve", token, "", nil)
+	assert.Equal(t, http.StatusBadRequest, code, "task is already approved")
+
+	var balance balanceResponse
+	code = apiCall(t, srv, http.MethodPost, "/api/v1/children/kid/adjustments", token,
+		`{"type": "penalty", "amount": 15, "reason": "разбил чашку"}`, &balance)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 25, balance.Balance)
+
+	var transactions []store.Transaction
+	code = apiCall(t, srv, http.MethodGet, "/api/v1/children/kid/transactions?period=week", token, "", &transactions)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, transactions, 3)
+}
+
+func TestServer_APIWithdrawals(t *testing.T) {
+	srv, am, _ := prepare(t)
+	token, _, err := am.IssueAPIToken(1, "script", time.Now())
+	require.NoError(t, err)
+
+	require.NoError(t, am.SetRate(1, 100, 1))
+	_, err = am.GrantBonus(1, "@kid", 50, "табель")
+	require.NoError(t, err)
+	_, err = am.RequestWithdrawal(2, 20)
+	require.NoError(t, err)
+
+	var withdrawals []store.Withdrawal
+	code := apiCall(t, srv, http.MethodGet, "/api/v1/withdrawals?status=pending", token, "", &withdrawals)
+	assert.Equal(t, http.StatusOK, code)
+	require.Len(t, withdrawals, 1)
+
+	var w store.Withdrawal
+	code = apiCall(t, srv, http.MethodPost, "/api/v1/withdrawals/"+withdrawals[0].ID+"/approve", token, "", &w)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, store.WithdrawalApprovedStatus, w.Status)
+
+	code = apiCall(t, srv, http.MethodPost, "/api/v1/withdrawals/"+w.ID+"/paid", token, "", &w)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, store.WithdrawalPaidStatus, w.Status)
+
+	var balance balanceResponse
+	assert.Equal(t, http.StatusOK, apiCall(t, srv, http.MethodGet, "/api/v1/children/kid/balance", token, "", &balance))
+	assert.Equal(t, 30, balance.Balance)
+}
@@ -0,0 +1,286 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"main/store"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var periods = []string{store.PeriodWeek, store.PeriodMonth, store.PeriodQuarter, store.PeriodYear, store.PeriodAll}
+
+// childRow is a child with the current balance
+type childRow struct {
+	store.User
+	Balance int
+}
+
+// costRow is a built-in operation with the family cost
+type costRow struct {
+	Op   string
+	Cost int
+}
+
+type dashboardData struct {
+	Parent     store.User
+	CSRF       string
+	Message    string
+	Error      string
+	Children   []childRow
+	Names      map[int64]string
+	Pending    store.Pending
+	Costs      []costRow
+	Chores     []store.Chore
+	Rewards    []store.Reward
+	Allowances []store.Allowance
+	Operations []string
+	Periods    []string
+}
+
+type historyData struct {
+	CSRF         string
+	Children     []childRow
+	Child        store.User
+	Period       string
+	Periods      []string
+	Transactions []store.Transaction
+}
+
+func (s *Server) dashboard(w http.ResponseWriter, r *http.Request, sess session) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := s.dashboardData(sess)
+	if err != nil {
+		log.Printf("[ERROR] unable to load dashboard of %d: %+v", sess.parentId, err)
+		http.Error(w, "unable to load family", http.StatusInternalServerError)
+		return
+	}
+	data.Message, data.Error = r.URL.Query().Get("msg"), r.URL.Query().Get("err")
+	s.render(w, http.StatusOK, "dashboard.html", data)
+}
+
+func (s *Server) dashboardData(sess session) (data dashboardData, err error) {
+	data = dashboardData{CSRF: sess.csrf, Names: map[int64]string{}, Operations: store.TaskOperations, Periods: periods}
+
+	if data.Parent, err = s.db.FindUser(sess.parentId); err != nil {
+		return data, fmt.Errorf("unable to find parent: %w", err)
+	}
+	if data.Children, err = s.children(sess.parentId); err != nil {
+		return data, err
+	}
+	for _, c := range data.Children {
+		data.Names[c.ID] = "@" + c.Nickname
+	}
+
+	if data.Pending, err = s.am.Pending(sess.parentId); err != nil {
+		return data, fmt.Errorf("unable to load pending items: %w", err)
+	}
+
+	for _, op := range store.TaskOperations {
+		cost, err := s.am.OperationCost(sess.parentId, op)
+		if err != nil {
+			return data, fmt.Errorf("unable to load cost of %s: %w", op, err)
+		}
+		data.Costs = append(data.Costs, costRow{Op: op, Cost: cost})
+	}
+
+	if data.Chores, err = s.db.Chores(sess.parentId); err != nil {
+		return data, fmt.Errorf("unable to load chores: %w", err)
+	}
+	if data.Rewards, err = s.am.Rewards(sess.parentId); err != nil {
+		return data, fmt.Errorf("unable to load rewards: %w", err)
+	}
+
+	familyId, err := s.am.FamilyID(sess.parentId)
+	if err != nil {
+		return data, fmt.Errorf("unable to find family: %w", err)
+	}
+	if data.Allowances, err = s.db.Allowances(familyId); err != nil {
+		return data, fmt.Errorf("unable to load allowances: %w", err)
+	}
+	return data, nil
+}
+
+// children returns parent's children with their balances
+func (s *Server) children(parentId int64) ([]childRow, error) {
+	children, err := s.am.OwnChildren(parentId)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]childRow, 0, len(children))
+	for _, c := range children {
+		balance, err := s.db.Balance(c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load balance of %d: %w", c.ID, err)
+		}
+		rows = append(rows, childRow{User: c, Balance: balance})
+	}
+	return rows, nil
+}
+
+func (s *Server) history(w http.ResponseWriter, r *http.Request, sess session) {
+	data := historyData{CSRF: sess.csrf, Period: r.URL.Query().Get("period"), Periods: periods}
+	if data.Period == "" {
+		data.Period = store.PeriodMonth
+	}
+
+	var err error
+	if data.Children, err = s.children(sess.parentId); err != nil {
+		log.Printf("[ERROR] unable to load children of %d: %+v", sess.parentId, err)
+		http.Error(w, "unable to load children", http.StatusInternalServerError)
+		return
+	}
+
+	if child := r.URL.Query().Get("child"); child != "" {
+		data.Child, data.Transactions, err = s.am.History(sess.parentId, child, data.Period)
+		if err != nil {
+			log.Printf("[WARN] unable to load history of %s for %d: %+v", child, sess.parentId, err)
+			http.Error(w, "unable to load history", http.StatusBadRequest)
+			return
+		}
+	}
+	s.render(w, http.StatusOK, "history.html", data)
+}
+
+func (s *Server) export(w http.ResponseWriter, r *http.Request, sess session) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	name, body, err := s.am.ExportHistory(sess.parentId, q.Get("child"), q.Get("period"), format)
+	if err != nil {
+		log.Printf("[WARN] unable to export history for %d: %+v", sess.parentId, err)
+		http.Error(w, "unable to export history", http.StatusBadRequest)
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == store.ExportJSON {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if _, err = w.Write(body); err != nil {
+		log.Printf("[WARN] unable to write export: %+v", err)
+	}
+}
+
+func (s *Server) logout(_ *http.Request, id string, _ session) (string, error) {
+	s.lock.Lock()
+	delete(s.sessions, id)
+	s.lock.Unlock()
+	return "", nil
+}
+
+func (s *Server) decideTask(r *http.Request, _ string, sess session) (string, error) {
+	childId, err := strconv.ParseInt(r.PostFormValue("child"), 10, 64)
+	if err != nil {
+		return "Неизвестный ребенок", err
+	}
+
+	approve := r.PostFormValue("approve") == "1"
+	notifications, err := s.am.DecideTask(sess.parentId, childId, r.PostFormValue("id"), approve)
+	if err != nil {
+		return "Невозможно принять решение по заданию", err
+	}
+	s.notify(notifications)
+	return decision(approve, "Задание подтверждено", "Задание отправлено на доработку"), nil
+}
+
+func (s *Server) decidePurchase(r *http.Request, _ string, sess session) (string, error) {
+	approve := r.PostFormValue("approve") == "1"
+	notifications, err := s.am.DecidePurchase(sess.parentId, r.PostFormValue("id"), approve)
+	if err != nil {
+		return "Невозможно принять решение по покупке", err
+	}
+	s.notify(notifications)
+	return decision(approve, "Покупка подтверждена", "Покупка отклонена"), nil
+}
+
+func (s *Server) decideWithdrawal(r *http.Request, _ string, sess session) (string, error) {
+	approve := r.PostFormValue("approve") == "1"
+	w, notifications, err := s.am.DecideWithdrawal(sess.parentId, r.PostFormValue("id"), approve)
+	if err != nil {
+		return "Невозможно принять решение по обмену", err
+	}
+	s.notify(notifications)
+	return decision(approve, "Обмен подтвержден, к выплате "+store.FormatRubles(w.Kopecks), "Обмен отклонен"), nil
+}
+
+func (s *Server) setCost(r *http.Request, _ string, sess session) (string, error) {
+	op := r.PostFormValue("op")
+	cost, err := strconv.Atoi(r.PostFormValue("cost"))
+	if err != nil {
+		return "Неверная стоимость", err
+	}
+	if err = s.am.SetOperationCost(sess.parentId, op, cost); err != nil {
+		return "Невозможно изменить стоимость", err
+	}
+	return fmt.Sprintf("Стоимость %s: %d dinocoins", store.OperationTitle(op), cost), nil
+}
+
+func (s *Server) addChore(r *http.Request, _ string, sess session) (string, error) {
+	c, err := s.am.AddChore(sess.parentId, r.PostFormValue("child"), r.PostFormValue("op"),
+		strings.Fields(r.PostFormValue("schedule")))
+	if err != nil {
+		return "Невозможно добавить регулярное задание", err
+	}
+	return fmt.Sprintf("Регулярное задание #%s добавлено", c.ID), nil
+}
+
+func (s *Server) deleteChore(r *http.Request, _ string, sess session) (string, error) {
+	if err := s.db.DeleteChore(sess.parentId, r.PostFormValue("id")); err != nil {
+		return "Невозможно удалить регулярное задание", err
+	}
+	return "Регулярное задание удалено", nil
+}
+
+func (s *Server) addReward(r *http.Request, _ string, sess session) (string, error) {
+	args := append([]string{r.PostFormValue("price")}, strings.Fields(r.PostFormValue("name"))...)
+	if stock := r.PostFormValue("stock"); stock != "" {
+		args = append(args, "stock="+stock)
+	}
+	if limit := r.PostFormValue("limit"); limit != "" {
+		args = append(args, "limit="+limit)
+	}
+
+	reward, err := s.am.AddReward(sess.parentId, args)
+	if err != nil {
+		return "Невозможно добавить награду", err
+	}
+	return fmt.Sprintf("Награда «%s» добавлена в магазин", reward.Name), nil
+}
+
+func (s *Server) deleteReward(r *http.Request, _ string, sess session) (string, error) {
+	if err := s.am.DeleteReward(sess.parentId, r.PostFormValue("id")); err != nil {
+		return "Невозможно удалить награду", err
+	}
+	return "Награда удалена", nil
+}
+
+func (s *Server) setAllowance(r *http.Request, _ string, sess session) (string, error) {
+	child, amount := r.PostFormValue("child"), r.PostFormValue("amount")
+	args := []string{amount}
+	if amount != "0" {
+		args = append(args, r.PostFormValue("day"), r.PostFormValue("time"))
+	}
+
+	if _, err := s.am.SetAllowance(sess.parentId, child, args); err != nil {
+		return "Невозможно настроить карманные деньги", err
+	}
+	if amount == "0" {
+		return "Карманные деньги для " + child + " отключены", nil
+	}
+	return "Карманные деньги для " + child + " настроены", nil
+}
+
+func decision(approve bool, approved, rejected string) string {
+	if approve {
+		return approved
+	}
+	return rejected
+}
@@ -0,0 +1,242 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"main/store"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionTTL is how long the parent stays logged in to the admin panel
+const SessionTTL = 12 * time.Hour
+
+const sessionCookie = "dinocoins_session"
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+var funcs = template.FuncMap{
+	"title":  store.OperationTitle,
+	"rubles": store.FormatRubles,
+	"date": func(t time.Time) string {
+		return t.Format("02.01.2006 15:04")
+	},
+	"delta": func(t store.Transaction) string {
+		if d := t.BalanceDelta(); d > 0 {
+			return "+" + strconv.Itoa(d)
+		} else if d < 0 {
+			return strconv.Itoa(d)
+		}
+		return "0"
+	},
+	"weekday": func(d time.Weekday) string {
+		return strings.ToLower(d.String()[:3])
+	},
+}
+
+// Server is HTML admin panel where parents manage their family and JSON api for external integrations
+type Server struct {
+	am     *store.ActionManager
+	db     *store.BoltDB
+	notify func([]store.Notification)
+	tmpl   *template.Template
+
+	lock     sync.Mutex
+	sessions map[string]session
+}
+
+// session of the parent logged in with one-time link
+type session struct {
+	parentId int64
+	csrf     string
+	expires  time.Time
+}
+
+// New makes admin panel, notify delivers messages produced by parent's decisions to telegram
+func New(am *store.ActionManager, db *store.BoltDB, notify func([]store.Notification)) (*Server, error) {
+	tmpl, err := template.New("").Funcs(funcs).ParseFS(templatesFS, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse templates: %w", err)
+	}
+	return &Server{am: am, db: db, notify: notify, tmpl: tmpl, sessions: map[string]session{}}, nil
+}
+
+// Run serves admin panel and api on the address until context canceled
+func (s *Server) Run(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		if err := srv.Shutdown(context.Background()); err != nil {
+			log.Printf("[WARN] unable to shutdown http server: %+v", err)
+		}
+	}()
+
+	log.Printf("[INFO] http server listens on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler returns routes of the admin panel and api
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", s.login)
+	mux.HandleFunc("/", s.page(s.dashboard))
+	mux.HandleFunc("/history", s.page(s.history))
+	mux.HandleFunc("/export", s.page(s.export))
+
+	mux.HandleFunc(apiPrefix, s.api)
+
+	mux.HandleFunc("/logout", s.action(s.logout))
+	mux.HandleFunc("/tasks/decide", s.action(s.decideTask))
+	mux.HandleFunc("/purchases/decide", s.action(s.decidePurchase))
+	mux.HandleFunc("/withdrawals/decide", s.action(s.decideWithdrawal))
+	mux.HandleFunc("/costs", s.action(s.setCost))
+	mux.HandleFunc("/chores", s.action(s.addChore))
+	mux.HandleFunc("/chores/delete", s.action(s.deleteChore))
+	mux.HandleFunc("/rewards", s.action(s.addReward))
+	mux.HandleFunc("/rewards/delete", s.action(s.deleteReward))
+	mux.HandleFunc("/allowances", s.action(s.setAllowance))
+	return mux
+}
+
+// login asks to confirm the one-time link sent by the bot, the token is redeemed on POST only,
+// so link previews and url scanners fetching the link don't use it up
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.render(w, http.StatusOK, "confirm.html", r.URL.Query().Get("token"))
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parent, err := s.am.RedeemLoginToken(r.PostFormValue("token"), time.Now())
+	if err != nil {
+		log.Printf("[WARN] admin panel login failed: %+v", err)
+		s.render(w, http.StatusUnauthorized, "login.html", nil)
+		return
+	}
+
+	id, err := randomString()
+	if err != nil {
+		http.Error(w, "unable to start session", http.StatusInternalServerError)
+		return
+	}
+	csrf, err := randomString()
+	if err != nil {
+		http.Error(w, "unable to start session", http.StatusInternalServerError)
+		return
+	}
+
+	s.lock.Lock()
+	now := time.Now()
+	for k, v := range s.sessions {
+		if !v.expires.After(now) {
+			delete(s.sessions, k)
+		}
+	}
+	s.sessions[id] = session{parentId: parent.ID, csrf: csrf, expires: now.Add(SessionTTL)}
+	s.lock.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/", MaxAge: int(SessionTTL.Seconds()),
+		HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// session returns session of the request, false if the parent is not logged in
+func (s *Server) session(r *http.Request) (string, session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", session{}, false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sess, ok := s.sessions[cookie.Value]
+	if !ok || !sess.expires.After(time.Now()) {
+		delete(s.sessions, cookie.Value)
+		return "", session{}, false
+	}
+	return cookie.Value, sess, true
+}
+
+// page wraps GET handler of the logged in parent
+func (s *Server) page(h func(w http.ResponseWriter, r *http.Request, sess session)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		_, sess, ok := s.session(r)
+		if !ok {
+			s.render(w, http.StatusUnauthorized, "login.html", nil)
+			return
+		}
+		h(w, r, sess)
+	}
+}
+
+// action wraps form POST of the logged in parent, the handler returns message shown on the dashboard
+func (s *Server) action(h func(r *http.Request, id string, sess session) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, sess, ok := s.session(r)
+		if !ok {
+			s.render(w, http.StatusUnauthorized, "login.html", nil)
+			return
+		}
+		if r.PostFormValue("csrf") != sess.csrf {
+			http.Error(w, "invalid form token", http.StatusForbidden)
+			return
+		}
+
+		q := url.Values{}
+		msg, err := h(r, id, sess)
+		if err != nil {
+			log.Printf("[ERROR] admin panel %s by %d: %+v", r.URL.Path, sess.parentId, err)
+			q.Set("err", msg)
+		} else if msg != "" {
+			q.Set("msg", msg)
+		}
+
+		target := "/"
+		if len(q) > 0 {
+			target += "?" + q.Encode()
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
+	}
+}
+
+func (s *Server) render(w http.ResponseWriter, status int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := s.tmpl.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("[ERROR] unable to render %s: %+v", name, err)
+	}
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
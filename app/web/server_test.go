@@ -0,0 +1,143 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"main/store"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var csrfRe = regexp.MustCompile(`name="csrf" value="([0-9a-f]+)"`)
+
+func prepare(t *testing.T) (*Server, *store.ActionManager, *[]store.Notification) {
+	dir, err := os.MkdirTemp("", "dinocoins-web")
+	require.NoError(t, err)
+	db, err := store.NewBoltDB(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+		_ = os.RemoveAll(dir)
+	})
+
+	am, err := store.NewActionManager(db)
+	require.NoError(t, err)
+	require.NoError(t, db.RegisterUser(store.User{ID: 1, ChatID: 100, Nickname: "dad", Type: store.PARENT}))
+	require.NoError(t, db.RegisterUser(store.User{ID: 2, ChatID: 200, Nickname: "kid", Type: store.CHILD}))
+	require.NoError(t, db.BindChildToParent(1, "@kid"))
+
+	var sent []store.Notification
+	srv, err := New(am, db, func(notifications []store.Notification) {
+		sent = append(sent, notifications...)
+	})
+	require.NoError(t, err)
+	return srv, am, &sent
+}
+
+func serve(srv *Server, r *http.Request, cookie *http.Cookie) *httptest.ResponseRecorder {
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func post(srv *Server, path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return serve(srv, r, cookie)
+}
+
+func login(t *testing.T, srv *Server, am *store.ActionManager) (*http.Cookie, string) {
+	token, err := am.IssueLoginToken(1, time.Now())
+	require.NoError(t, err)
+
+	w := post(srv, "/login", url.Values{"token": {token}}, nil)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite, "login link is opened cross-site from telegram")
+
+	w = serve(srv, httptest.NewRequest(http.MethodGet, "/", nil), cookies[0])
+	require.Equal(t, http.StatusOK, w.Code)
+	m := csrfRe.FindStringSubmatch(w.Body.String())
+	require.Len(t, m, 2)
+	return cookies[0], m[1]
+}
+
+func TestServer_Login(t *testing.T) {
+	srv, am, _ := prepare(t)
+
+	w := serve(srv, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = post(srv, "/login", url.Values{"token": {"bad"}}, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	token, err := am.IssueLoginToken(1, time.Now())
+	require.NoError(t, err)
+	w = serve(srv, httptest.NewRequest(http.MethodGet, "/login?token="+token, nil), nil)
+	assert.Equal(t, http.StatusOK, w.Code, "link preview doesn't redeem the token")
+	assert.Contains(t, w.Body.String(), `value="`+token+`"`)
+	assert.Empty(t, w.Result().Cookies())
+	w = post(srv, "/login", url.Values{"token": {token}}, nil)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	w = post(srv, "/login", url.Values{"token": {token}}, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "link works once")
+
+	cookie, csrf := login(t, srv, am)
+	w = serve(srv, httptest.NewRequest(http.MethodGet, "/", nil), cookie)
+	assert.Contains(t, w.Body.String(), "@kid")
+
+	w = post(srv, "/logout", url.Values{"csrf": {csrf}}, cookie)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	w = serve(srv, httptest.NewRequest(http.MethodGet, "/", nil), cookie)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestServer_Actions(t *testing.T) {
+	srv, am, sent := prepare(t)
+	cookie, csrf := login(t, srv, am)
+
+	w := post(srv, "/costs", url.Values{"op": {store.OpWalkDog}, "cost": {"30"}}, cookie)
+	assert.Equal(t, http.StatusForbidden, w.Code, "form token is required")
+
+	w = post(srv, "/costs", url.Values{"csrf": {csrf}, "op": {store.OpWalkDog}, "cost": {"30"}}, cookie)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "msg=")
+	cost, err := am.OperationCost(2, store.OpWalkDog)
+	require.NoError(t, err)
+	assert.Equal(t, 30, cost)
+
+	w = post(srv, "/costs", url.Values{"csrf": {csrf}, "op": {"unknown"}, "cost": {"30"}}, cookie)
+	assert.Contains(t, w.Header().Get("Location"), "err=")
+
+	task, err := am.StartTask(2, store.OpWalkDog)
+	require.NoError(t, err)
+	_, err = am.RequestTaskCompletion(2, task.ID)
+	require.NoError(t, err)
+
+	w = serve(srv, httptest.NewRequest(http.MethodGet, "/", nil), cookie)
+	assert.Contains(t, w.Body.String(), `value="`+task.ID+`"`)
+
+	w = post(srv, "/tasks/decide", url.Values{"csrf": {csrf}, "child": {"2"}, "id": {task.ID}, "approve": {"1"}}, cookie)
+	assert.Contains(t, w.Header().Get("Location"), "msg=")
+	require.NotEmpty(t, *sent)
+	assert.Equal(t, int64(200), (*sent)[0].ChatID)
+
+	w = serve(srv, httptest.NewRequest(http.MethodGet, "/history?child=@kid&period=week", nil), cookie)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "&#43;30", "approved task in history")
+
+	w = serve(srv, httptest.NewRequest(http.MethodGet, "/export?child=@kid&period=week&format=csv", nil), cookie)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "kid-week.csv")
+}